@@ -123,14 +123,22 @@ func RootCmd(ctx context.Context, o *krewOptions) *cobra.Command {
 	// preq options
 	cmd.Flags().StringVarP(&cli.Options.Action, "action", "a", "", ux.HelpAction)
 	cmd.Flags().BoolVarP(&cli.Options.Disabled, "disabled", "d", false, ux.HelpDisabled)
+	cmd.Flags().StringVarP(&cli.Options.Explain, "explain", "e", "", ux.HelpExplain)
+	cmd.Flags().StringVarP(&cli.Options.Exclude, "exclude", "x", "", ux.HelpExclude)
+	cmd.Flags().StringVarP(&cli.Options.Format, "format", "f", ux.FormatJSON, ux.HelpFormat)
+	cmd.Flags().StringVarP(&cli.Options.Include, "include", "i", "", ux.HelpInclude)
 	cmd.Flags().BoolVarP(&cli.Options.Cron, "cron", "j", false, ux.HelpCron)
 	cmd.Flags().BoolVarP(&cli.Options.Generate, "generate", "g", false, ux.HelpGenerate)
 	cmd.Flags().StringVarP(&cli.Options.Level, "level", "l", "", ux.HelpLevel)
 	cmd.Flags().StringVarP(&cli.Options.Name, "name", "o", "", ux.HelpName)
 	cmd.Flags().BoolVarP(&cli.Options.Quiet, "quiet", "q", false, ux.HelpQuiet)
 	cmd.Flags().StringVarP(&cli.Options.Rules, "rules", "r", "", ux.HelpRules)
+	cmd.Flags().StringVarP(&cli.Options.Severity, "severity", "S", "", ux.HelpSeverity)
+	cmd.Flags().StringVarP(&cli.Options.Synthetic, "synthetic", "t", "", ux.HelpSynthetic)
+	cmd.Flags().StringVarP(&cli.Options.Tail, "tail", "T", "", ux.HelpTail)
 	cmd.Flags().BoolVarP(&cli.Options.Version, "version", "v", false, ux.HelpVersion)
 	cmd.Flags().BoolVarP(&cli.Options.AcceptUpdates, "accept-updates", "y", false, ux.HelpAcceptUpdates)
+	cmd.Flags().BoolVar(&cli.Options.Offline, "offline", false, ux.HelpOffline)
 
 	cobra.OnInitialize(initConfig)
 
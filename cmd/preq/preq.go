@@ -18,6 +18,7 @@ var vars = kong.Vars{
 	"disabledHelp":      ux.HelpDisabled,
 	"generateHelp":      ux.HelpGenerate,
 	"cronHelp":          ux.HelpCron,
+	"formatHelp":        ux.HelpFormat,
 	"levelHelp":         ux.HelpLevel,
 	"nameHelp":          ux.HelpName,
 	"quietHelp":         ux.HelpQuiet,
@@ -25,6 +26,55 @@ var vars = kong.Vars{
 	"sourceHelp":        ux.HelpSource,
 	"versionHelp":       ux.HelpVersion,
 	"acceptUpdatesHelp": ux.HelpAcceptUpdates,
+	"syntheticHelp":     ux.HelpSynthetic,
+	"tailHelp":          ux.HelpTail,
+	"includeHelp":       ux.HelpInclude,
+	"excludeHelp":       ux.HelpExclude,
+	"severityHelp":      ux.HelpSeverity,
+	"offlineHelp":       ux.HelpOffline,
+	"explainHelp":       ux.HelpExplain,
+
+	"detectFormatHelp":      ux.HelpDetectFormat,
+	"detectFormatPathHelp":  ux.HelpDetectFormatPath,
+	"detectFormatLinesHelp": ux.HelpDetectFormatLines,
+	"lintHelp":              ux.HelpLint,
+	"lintPathsHelp":         ux.HelpLintPaths,
+	"testHelp":              ux.HelpTest,
+	"testSpecsHelp":         ux.HelpTestSpecs,
+	"rulesCmdHelp":          ux.HelpRulesCmd,
+	"rulesListHelp":         ux.HelpRulesList,
+	"rulesUseHelp":          ux.HelpRulesUse,
+	"rulesUseVersionHelp":   ux.HelpRulesUseVersion,
+	"rulesRollbackHelp":     ux.HelpRulesRollback,
+	"rulesImportHelp":       ux.HelpRulesImport,
+	"rulesImportPathHelp":   ux.HelpRulesImportPath,
+	"rulesSignHelp":         ux.HelpRulesSign,
+	"rulesSignKeyHelp":      ux.HelpRulesSignKey,
+	"rulesSignPathsHelp":    ux.HelpRulesSignPaths,
+	"rulesVerifyHelp":       ux.HelpRulesVerify,
+	"rulesVerifyKeyHelp":    ux.HelpRulesVerifyKey,
+	"rulesVerifyPathsHelp":  ux.HelpRulesVerifyPaths,
+	"mirrorHelp":            ux.HelpMirror,
+	"mirrorDirHelp":         ux.HelpMirrorDir,
+	"mirrorListenHelp":      ux.HelpMirrorListen,
+	"mirrorUdpListenHelp":   ux.HelpMirrorUdpListen,
+	"mirrorTlsCertHelp":     ux.HelpMirrorTlsCert,
+	"mirrorTlsKeyHelp":      ux.HelpMirrorTlsKey,
+	"mirrorUrlHelp":         ux.HelpMirrorUrl,
+	"mirrorTokenHelp":       ux.HelpMirrorToken,
+	"newRuleHelp":           ux.HelpNewRule,
+	"newRulePathHelp":       ux.HelpNewRulePath,
+	"newRuleLinesHelp":      ux.HelpNewRuleLines,
+	"newRuleMatchHelp":      ux.HelpNewRuleMatch,
+	"newRuleKindHelp":       ux.HelpNewRuleKind,
+	"newRuleIdHelp":         ux.HelpNewRuleId,
+	"newRuleSourceHelp":     ux.HelpNewRuleSource,
+	"newRuleOutHelp":        ux.HelpNewRuleOut,
+	"benchHelp":             ux.HelpBench,
+	"benchRulesHelp":        ux.HelpBenchRules,
+	"benchCorpusHelp":       ux.HelpBenchCorpus,
+	"benchSourceHelp":       ux.HelpBenchSource,
+	"benchLineTimeHelp":     ux.HelpBenchLineTime,
 }
 
 func main() {
@@ -32,13 +82,15 @@ func main() {
 	var (
 		ctx    = sigs.InitSignals()
 		parser = kong.Must(
-			&cli.Options,
+			&cli.Commands,
+			kong.Embed(&cli.Options),
 			kong.Name(ux.ProcessName()),
 			kong.Description(ux.AppDesc),
 			kong.UsageOnError(),
 			kong.Vars(vars),
 		)
-		err error
+		kctx *kong.Context
+		err  error
 	)
 
 	// Run kongplete.Complete to handle completion requests
@@ -46,7 +98,8 @@ func main() {
 		kongplete.WithPredictor("file", complete.PredictFiles("*")),
 	)
 
-	kong.Parse(&cli.Options, vars)
+	kctx, err = parser.Parse(os.Args[1:])
+	parser.FatalIfErrorf(err)
 
 	logOpts := []logs.InitOpt{
 		logs.WithLevel(cli.Options.Level),
@@ -56,7 +109,7 @@ func main() {
 	// Initialize logger first before any other logging
 	logs.InitLogger(logOpts...)
 
-	if err = cli.InitAndExecute(ctx); err != nil {
+	if err = cli.Execute(ctx, kctx.Selected().Name); err != nil {
 		os.Exit(1)
 	}
 }
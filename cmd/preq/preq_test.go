@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/prequel-dev/preq/internal/pkg/cli"
+)
+
+// The root --format flag is shared with the subcommands; a subcommand flag of the same
+// name would be shadowed by it.
+func TestFormatFlag(t *testing.T) {
+
+	parser, err := kong.New(&cli.Commands, kong.Embed(&cli.Options), kong.Vars(vars))
+	if err != nil {
+		t.Fatalf("kong.New failed: %v", err)
+	}
+
+	tests := map[string]struct {
+		args []string
+		cmd  string
+		want string
+	}{
+		"detection":     {args: []string{"--format", "sarif"}, cmd: "run", want: "sarif"},
+		"old flag name": {args: []string{"--report-format", "sarif"}, cmd: "run", want: "sarif"},
+		"lint":          {args: []string{"lint", "--format", "json", "rules.yaml"}, cmd: "lint <paths>", want: "json"},
+		"bench":         {args: []string{"bench", "-c", "preq.go", "-f", "json", "rules.yaml"}, cmd: "bench <rules>", want: "json"},
+		"unset":         {args: []string{"lint", "rules.yaml"}, cmd: "lint <paths>", want: ""},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			cli.Options.Format = ""
+
+			kctx, err := parser.Parse(tc.args)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if kctx.Command() != tc.cmd {
+				t.Errorf("Expected command %q, got %q", tc.cmd, kctx.Command())
+			}
+			if cli.Options.Format != tc.want {
+				t.Errorf("Expected format %q, got %q", tc.want, cli.Options.Format)
+			}
+		})
+	}
+}
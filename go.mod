@@ -19,7 +19,7 @@ require (
 	github.com/goccy/go-json v0.10.5 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
-	github.com/icza/backscanner v0.0.0-20241124160932-dff01ac50250 // indirect
+	github.com/icza/backscanner v0.0.0-20241124160932-dff01ac50250
 	github.com/mattn/go-runewidth v0.0.16 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
 	github.com/riywo/loginshell v0.0.0-20200815045211-7d26008be1ab // indirect
@@ -30,6 +30,7 @@ require (
 require (
 	github.com/cqroot/prompt v0.9.4
 	github.com/fatih/color v1.18.0
+	github.com/klauspost/compress v1.18.0
 	github.com/prequel-dev/prequel-compiler v0.0.14
 	github.com/spf13/cobra v1.8.1
 	github.com/spf13/viper v1.20.1
@@ -0,0 +1,125 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/prequel-dev/preq/internal/pkg/config"
+	"github.com/prequel-dev/preq/internal/pkg/engine"
+	"github.com/prequel-dev/preq/internal/pkg/resolve"
+	"github.com/prequel-dev/preq/internal/pkg/timez"
+	"github.com/prequel-dev/preq/internal/pkg/utils"
+	"github.com/prequel-dev/preq/internal/pkg/ux"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	benchSrcAny = "*"
+)
+
+var (
+	ErrBenchSlow = errors.New("rules flagged as slow")
+)
+
+// Bench measures each rule on its own against a sample log. Returns ErrBenchSlow if any rule is flagged.
+func Bench(ctx context.Context, cmd BenchCmdT) error {
+
+	var (
+		c     *config.Config
+		paths []utils.RulePathT
+		err   error
+	)
+
+	format, err := outputFormat(ux.FormatText, ux.FormatText, ux.FormatJSON)
+	if err != nil {
+		return ux.Error(err)
+	}
+
+	files, err := expandRulesPaths(cmd.Rules)
+	if err != nil {
+		ux.RulesError(err)
+		return err
+	}
+
+	for _, fn := range files {
+		paths = append(paths, utils.RulePathT{Path: fn, Type: utils.RuleTypeUser})
+	}
+
+	if c, err = config.LoadConfig(defaultConfigDir, configFile); err != nil {
+		log.Error().Err(err).Msg("Failed to load config")
+		ux.ConfigError(err)
+		return err
+	}
+
+	if c.Skip == 0 {
+		c.Skip = timez.DefaultSkip
+	}
+
+	data, err := os.ReadFile(cmd.Corpus)
+	if err != nil {
+		log.Error().Err(err).Str("path", cmd.Corpus).Msg("Failed to read corpus")
+		ux.DataError(err)
+		return err
+	}
+
+	var (
+		name    = filepath.Base(cmd.Corpus)
+		srcType = cmd.SrcType
+		opts    = tsOpts(c)
+	)
+
+	if srcType == "" {
+		srcType = benchSrcAny
+	}
+
+	// Each rule scans the corpus from the start
+	sourcesF := func() ([]*engine.LogData, error) {
+		ld, err := resolve.PipeEvalSource(name, srcType, [][]byte{data}, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return []*engine.LogData{ld}, nil
+	}
+
+	r := engine.New(utils.GetStopTime(), ux.NewUxEval())
+	defer r.Close()
+
+	r.Bench = true
+
+	matchers, err := r.LoadRulesPaths(ux.NewReport(nil), paths)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load rules")
+		ux.RulesError(err)
+		return err
+	}
+
+	rows, err := r.RunBench(ctx, matchers, sourcesF, cmd.LineTime)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to bench rules")
+		return err
+	}
+
+	switch format {
+	case ux.FormatJSON:
+		data, err := json.MarshalIndent(rows, "", "  ")
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to marshal bench results")
+			return err
+		}
+		fmt.Fprintln(os.Stdout, string(data))
+	default:
+		ux.PrintBench(rows)
+	}
+
+	for _, row := range rows {
+		if row.Pathological() {
+			return ErrBenchSlow
+		}
+	}
+
+	return nil
+}
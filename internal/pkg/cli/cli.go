@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/Masterminds/semver"
 	"github.com/prequel-dev/preq/internal/pkg/auth"
@@ -16,22 +17,29 @@ import (
 	"github.com/prequel-dev/preq/internal/pkg/timez"
 	"github.com/prequel-dev/preq/internal/pkg/utils"
 	"github.com/prequel-dev/preq/internal/pkg/ux"
-	"github.com/prequel-dev/prequel-compiler/pkg/datasrc"
 	"github.com/rs/zerolog/log"
 )
 
 var Options struct {
 	Action        string `short:"a" help:"${actionHelp}"`
 	Disabled      bool   `short:"d" help:"${disabledHelp}"`
+	Explain       string `short:"e" help:"${explainHelp}"`
+	Exclude       string `short:"x" help:"${excludeHelp}"`
+	Format        string `short:"f" aliases:"report-format" help:"${formatHelp}"`
 	Generate      bool   `short:"g" help:"${generateHelp}"`
+	Include       string `short:"i" help:"${includeHelp}"`
 	Cron          bool   `short:"j" help:"${cronHelp}"`
 	Level         string `short:"l" help:"${levelHelp}"`
 	Name          string `short:"o" help:"${nameHelp}"`
 	Quiet         bool   `short:"q" help:"${quietHelp}"`
 	Rules         string `short:"r" help:"${rulesHelp}"`
 	Source        string `short:"s" help:"${sourceHelp}"`
+	Severity      string `short:"S" help:"${severityHelp}"`
+	Synthetic     string `short:"t" help:"${syntheticHelp}"`
+	Tail          string `short:"T" help:"${tailHelp}"`
 	Version       bool   `short:"v" help:"${versionHelp}"`
 	AcceptUpdates bool   `short:"y" help:"${acceptUpdatesHelp}"`
+	Offline       bool   `help:"${offlineHelp}"`
 }
 
 var (
@@ -57,6 +65,8 @@ const (
 	defStop    = "+inf"
 	baseAddr   = "app-beta.prequel.dev"
 	configFile = "config.yaml"
+	explainExt = ".explain.json"
+	summaryExt = ".summary.json"
 )
 
 func tsOpts(c *config.Config) []resolve.OptT {
@@ -70,18 +80,18 @@ func tsOpts(c *config.Config) []resolve.OptT {
 
 func parseSources(fn string, opts ...resolve.OptT) ([]*resolve.LogData, error) {
 
-	ds, err := datasrc.ParseFile(fn)
+	ss, err := resolve.ParseSourcesFile(fn)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to parse data sources file")
 		return nil, err
 	}
 
-	if err := datasrc.Validate(ds); err != nil {
+	if err := ss.Validate(); err != nil {
 		log.Error().Err(err).Msg("Failed to validate data sources")
 		return nil, err
 	}
 
-	return resolve.Resolve(ds, opts...), nil
+	return resolve.ResolveSources(ss, opts...), nil
 }
 
 func InitAndExecute(ctx context.Context) error {
@@ -108,23 +118,39 @@ func InitAndExecute(ctx context.Context) error {
 		return nil
 	}
 
+	format, err := outputFormat(ux.FormatJSON, ux.FormatJSON, ux.FormatSarif)
+	if err != nil {
+		return ux.Error(err)
+	}
+
 	if c, err = config.LoadConfig(defaultConfigDir, configFile); err != nil {
 		log.Error().Err(err).Msg("Failed to load config")
 		ux.ConfigError(err)
 		return err
 	}
 
-	// Log in for community rule updates
+	if Options.Offline {
+		c.Offline = true
+	}
+
+	// Log in for community rule updates. Mirrors take a configured token instead.
 	// Mockable function variable to allow for testing without real network calls
-	if token, err = loginUserFunc(ctx, baseAddr, ruleToken); err != nil {
-		log.Error().Err(err).Msg("Failed to login")
+	switch {
+	case c.Offline:
+		// Installed or imported rules only
+	case c.Updates.IsMirror():
+		token = c.Updates.Token
+	default:
+		if token, err = loginUserFunc(ctx, baseAddr, ruleToken); err != nil {
+			log.Error().Err(err).Msg("Failed to login")
 
-		// A notice will be printed if the email is not verified
-		if err != auth.ErrEmailNotVerified {
-			ux.AuthError(err)
-		}
+			// A notice will be printed if the email is not verified
+			if err != auth.ErrEmailNotVerified {
+				ux.AuthError(err)
+			}
 
-		return err
+			return err
+		}
 	}
 
 	if Options.AcceptUpdates {
@@ -135,6 +161,12 @@ func InitAndExecute(ctx context.Context) error {
 		c.Rules.Disabled = true
 	}
 
+	if err = ruleFilter(c); err != nil {
+		log.Error().Err(err).Msg("Invalid rule filter")
+		ux.RulesError(err)
+		return err
+	}
+
 	if c.Skip == 0 {
 		c.Skip = timez.DefaultSkip
 	}
@@ -154,6 +186,16 @@ func InitAndExecute(ctx context.Context) error {
 	)
 
 	if useStdin {
+		topts = append(topts, c.StdinOpts()...)
+		if Options.Synthetic != "" {
+			mode := timez.SyntheticMode(Options.Synthetic)
+			if err = mode.Validate(); err != nil {
+				log.Error().Err(err).Str("mode", Options.Synthetic).Msg("Invalid synthetic timestamp mode")
+				ux.DataError(err)
+				return err
+			}
+			topts = append(topts, resolve.WithSynthetic(mode))
+		}
 		sources, err = resolve.PipeStdin(topts...)
 		if err != nil {
 			log.Error().Err(err).Msg("Failed to read stdin")
@@ -166,6 +208,16 @@ func InitAndExecute(ctx context.Context) error {
 		if Options.Source != "" {
 			source = Options.Source
 		}
+		if Options.Tail != "" {
+			tail, err := resolve.ParseTail(Options.Tail)
+			if err != nil {
+				log.Error().Err(err).Str("tail", Options.Tail).Msg("Invalid tail")
+				ux.DataError(err)
+				return err
+			}
+			topts = append(topts, resolve.WithTail(tail))
+		}
+		topts = append(topts, resolve.WithContext(ctx))
 		sources, err = parseSources(source, topts...)
 		if err != nil {
 			log.Error().Err(err).Msg("Failed to parse data sources")
@@ -185,6 +237,12 @@ func InitAndExecute(ctx context.Context) error {
 
 	defer r.Close()
 
+	r.Filter = &c.Rules.RuleFilterT
+	r.Overrides = c.Overrides
+	r.Explain = Options.Explain
+	r.Locate = format == ux.FormatSarif
+	r.Extracted = engine.ExtractedTypes(sources)
+
 	if ruleMatchers, err = r.LoadRulesPaths(report, rulesPaths); err != nil {
 		log.Error().Err(err).Msg("Failed to load rules")
 		ux.RulesError(err)
@@ -272,6 +330,14 @@ LOOP:
 		}
 	}
 
+	if e := r.Explanation(); e != nil {
+		if err = explain(e); err != nil {
+			log.Error().Err(err).Msg("Failed to write explain trace")
+			ux.RulesError(err)
+			return err
+		}
+	}
+
 	switch {
 	case report.Size() == 0:
 		log.Debug().Msg("No CREs found")
@@ -293,6 +359,13 @@ LOOP:
 			return err
 		}
 
+	case Options.Name == ux.OutputStdout && format == ux.FormatSarif:
+		if err = report.PrintSarif(); err != nil {
+			log.Error().Err(err).Msg("Failed to print SARIF report")
+			ux.RulesError(err)
+			return err
+		}
+
 	case Options.Name == ux.OutputStdout:
 		if err = report.PrintReport(); err != nil {
 			log.Error().Err(err).Msg("Failed to print report")
@@ -300,6 +373,17 @@ LOOP:
 			return err
 		}
 
+	case format == ux.FormatSarif:
+		if reportPath, err = report.WriteSarif(Options.Name); err != nil {
+			log.Error().Err(err).Msg("Failed to write SARIF report")
+			ux.RulesError(err)
+			return err
+		}
+
+		if !Options.Quiet {
+			fmt.Fprintf(os.Stdout, "\nWrote SARIF report to %s\n", reportPath)
+		}
+
 	default:
 		if reportPath, err = report.Write(Options.Name); err != nil {
 			log.Error().Err(err).Msg("Failed to write full report")
@@ -310,7 +394,91 @@ LOOP:
 		if !Options.Quiet {
 			fmt.Fprintf(os.Stdout, "\nWrote report to %s\n", reportPath)
 		}
+
+		if err = summary(report.Summary(), reportPath); err != nil {
+			log.Error().Err(err).Msg("Failed to write run summary")
+			ux.RulesError(err)
+			return err
+		}
 	}
 
 	return nil
 }
+
+// summary writes the rules skipped and the coverage of the run next to the report, e.g.
+// out.summary.json for out.json. The report itself holds detections only.
+func summary(s *ux.SummaryT, reportPath string) error {
+
+	if s == nil {
+		return nil
+	}
+
+	path, err := ux.WriteSummary(s, strings.TrimSuffix(reportPath, filepath.Ext(reportPath))+summaryExt)
+	if err != nil {
+		return err
+	}
+
+	if !Options.Quiet {
+		fmt.Fprintf(os.Stdout, "Wrote run summary to %s\n", path)
+	}
+
+	return nil
+}
+
+// explain prints the trace of the rule selected with --explain and writes it as JSON next
+// to the report, e.g. out.explain.json for -o out.json. When the report is printed to
+// stdout, the trace is printed to stderr and no file is written.
+func explain(e *ux.ExplainT) error {
+
+	if Options.Name == ux.OutputStdout {
+		ux.PrintExplain(os.Stderr, e)
+		return nil
+	}
+
+	ux.PrintExplain(os.Stdout, e)
+
+	var path string
+	if Options.Name != "" {
+		path = strings.TrimSuffix(Options.Name, filepath.Ext(Options.Name)) + explainExt
+	}
+
+	path, err := ux.WriteExplain(e, path)
+	if err != nil {
+		return err
+	}
+
+	if !Options.Quiet {
+		fmt.Fprintf(os.Stdout, "Wrote explain trace to %s\n", path)
+	}
+
+	return nil
+}
+
+// ruleFilter adds the command line rule selection to the config. Terms are added to the
+// configured include and exclude lists; the severity flag replaces the configured one.
+func ruleFilter(c *config.Config) error {
+
+	var f = &c.Rules.RuleFilterT
+
+	if Options.Include != "" {
+		m, err := utils.ParseRuleMatch(Options.Include)
+		if err != nil {
+			return err
+		}
+		f.Include.Add(m)
+	}
+
+	if Options.Exclude != "" {
+		m, err := utils.ParseRuleMatch(Options.Exclude)
+		if err != nil {
+			return err
+		}
+		f.Exclude.Add(m)
+	}
+
+	if Options.Severity != "" {
+		f.Severity = Options.Severity
+	}
+
+	return f.Validate()
+}
@@ -2,12 +2,14 @@ package cli
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/prequel-dev/preq/internal/pkg/config"
 	"github.com/prequel-dev/preq/internal/pkg/utils"
+	"github.com/prequel-dev/preq/internal/pkg/ux"
 	"github.com/prequel-dev/prequel-compiler/pkg/datasrc"
 )
 
@@ -16,15 +18,23 @@ func setupTest(t *testing.T) {
 		Options = struct {
 			Action        string `short:"a" help:"${actionHelp}"`
 			Disabled      bool   `short:"d" help:"${disabledHelp}"`
+			Explain       string `short:"e" help:"${explainHelp}"`
+			Exclude       string `short:"x" help:"${excludeHelp}"`
+			Format        string `short:"f" aliases:"report-format" help:"${formatHelp}"`
 			Generate      bool   `short:"g" help:"${generateHelp}"`
+			Include       string `short:"i" help:"${includeHelp}"`
 			Cron          bool   `short:"j" help:"${cronHelp}"`
 			Level         string `short:"l" help:"${levelHelp}"`
 			Name          string `short:"o" help:"${nameHelp}"`
 			Quiet         bool   `short:"q" help:"${quietHelp}"`
 			Rules         string `short:"r" help:"${rulesHelp}"`
 			Source        string `short:"s" help:"${sourceHelp}"`
+			Severity      string `short:"S" help:"${severityHelp}"`
+			Synthetic     string `short:"t" help:"${syntheticHelp}"`
+			Tail          string `short:"T" help:"${tailHelp}"`
 			Version       bool   `short:"v" help:"${versionHelp}"`
 			AcceptUpdates bool   `short:"y" help:"${acceptUpdatesHelp}"`
+			Offline       bool   `help:"${offlineHelp}"`
 		}{}
 	})
 }
@@ -152,3 +162,41 @@ rules:
 		t.Errorf("Expected CLI option for rules to be '%s', but captured '%s'", expectedRulePath, capturedCLIRules)
 	}
 }
+
+func TestOutputFormat(t *testing.T) {
+	setupTest(t)
+
+	var (
+		report = []string{ux.FormatJSON, ux.FormatSarif}
+		lint   = []string{ux.FormatText, ux.FormatJSON}
+	)
+
+	tests := map[string]struct {
+		flag    string
+		def     string
+		formats []string
+		want    string
+		err     error
+	}{
+		"report default": {def: ux.FormatJSON, formats: report, want: ux.FormatJSON},
+		"report sarif":   {flag: ux.FormatSarif, def: ux.FormatJSON, formats: report, want: ux.FormatSarif},
+		"report text":    {flag: ux.FormatText, def: ux.FormatJSON, formats: report, err: ErrFormat},
+		"lint default":   {def: ux.FormatText, formats: lint, want: ux.FormatText},
+		"lint json":      {flag: ux.FormatJSON, def: ux.FormatText, formats: lint, want: ux.FormatJSON},
+		"lint sarif":     {flag: ux.FormatSarif, def: ux.FormatText, formats: lint, err: ErrFormat},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			Options.Format = tc.flag
+
+			got, err := outputFormat(tc.def, tc.formats...)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("Expected error %v, got %v", tc.err, err)
+			}
+			if got != tc.want {
+				t.Errorf("Expected format %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	cmdDetectFormat = "detect-format"
+	cmdLint         = "lint"
+	cmdTest         = "test"
+	cmdRulesList    = "list"
+	cmdRulesUse     = "use"
+	cmdRulesBack    = "rollback"
+	cmdRulesImport  = "import"
+	cmdRulesSign    = "sign"
+	cmdRulesVerify  = "verify"
+	cmdMirror       = "mirror"
+	cmdNewRule      = "new-rule"
+	cmdBench        = "bench"
+)
+
+var (
+	ErrFormat = errors.New("unsupported output format")
+)
+
+// Commands are the preq subcommands. Options are embedded as the root flags;
+// running without a subcommand performs detection.
+var Commands struct {
+	Run          struct{}         `cmd:"" default:"1" hidden:""`
+	DetectFormat DetectFormatCmdT `cmd:"" name:"detect-format" help:"${detectFormatHelp}"`
+	Lint         LintCmdT         `cmd:"" help:"${lintHelp}"`
+	Test         TestCmdT         `cmd:"" help:"${testHelp}"`
+	Rules        RulesCmdT        `cmd:"" help:"${rulesCmdHelp}"`
+	Mirror       MirrorCmdT       `cmd:"" help:"${mirrorHelp}"`
+	NewRule      NewRuleCmdT      `cmd:"" name:"new-rule" help:"${newRuleHelp}"`
+	Bench        BenchCmdT        `cmd:"" help:"${benchHelp}"`
+}
+
+type DetectFormatCmdT struct {
+	Path  string `arg:"" optional:"" type:"path" help:"${detectFormatPathHelp}"`
+	Lines int    `short:"n" default:"10" help:"${detectFormatLinesHelp}"`
+}
+
+type LintCmdT struct {
+	Paths []string `arg:"" type:"path" help:"${lintPathsHelp}"`
+}
+
+type TestCmdT struct {
+	Specs []string `arg:"" type:"path" help:"${testSpecsHelp}"`
+}
+
+type RulesCmdT struct {
+	List     struct{}        `cmd:"" help:"${rulesListHelp}"`
+	Use      RulesUseCmdT    `cmd:"" help:"${rulesUseHelp}"`
+	Rollback struct{}        `cmd:"" help:"${rulesRollbackHelp}"`
+	Import   RulesImportCmdT `cmd:"" help:"${rulesImportHelp}"`
+	Sign     RulesSignCmdT   `cmd:"" help:"${rulesSignHelp}"`
+	Verify   RulesVerifyCmdT `cmd:"" help:"${rulesVerifyHelp}"`
+}
+
+type RulesUseCmdT struct {
+	Version string `arg:"" help:"${rulesUseVersionHelp}"`
+}
+
+type RulesImportCmdT struct {
+	Path string `arg:"" type:"existingfile" help:"${rulesImportPathHelp}"`
+}
+
+type RulesSignCmdT struct {
+	Key   string   `required:"" type:"existingfile" help:"${rulesSignKeyHelp}"`
+	Paths []string `arg:"" type:"path" help:"${rulesSignPathsHelp}"`
+}
+
+type RulesVerifyCmdT struct {
+	Key   string   `type:"existingfile" help:"${rulesVerifyKeyHelp}"`
+	Paths []string `arg:"" optional:"" type:"path" help:"${rulesVerifyPathsHelp}"`
+}
+
+type MirrorCmdT struct {
+	Dir       string `arg:"" type:"existingdir" help:"${mirrorDirHelp}"`
+	Listen    string `default:":8443" help:"${mirrorListenHelp}"`
+	UdpListen string `name:"udp-listen" help:"${mirrorUdpListenHelp}"`
+	TlsCert   string `name:"tls-cert" type:"existingfile" and:"tls-key" help:"${mirrorTlsCertHelp}"`
+	TlsKey    string `name:"tls-key" type:"existingfile" and:"tls-cert" help:"${mirrorTlsKeyHelp}"`
+	Url       string `help:"${mirrorUrlHelp}"`
+	Token     string `help:"${mirrorTokenHelp}"`
+}
+
+type NewRuleCmdT struct {
+	Path   string `arg:"" type:"existingfile" help:"${newRulePathHelp}"`
+	Lines  string `short:"n" help:"${newRuleLinesHelp}"`
+	Match  string `short:"m" help:"${newRuleMatchHelp}"`
+	Kind   string `enum:"auto,set,sequence" default:"auto" help:"${newRuleKindHelp}"`
+	Id     string `help:"${newRuleIdHelp}"`
+	Source string `help:"${newRuleSourceHelp}"`
+	Out    string `type:"path" help:"${newRuleOutHelp}"`
+}
+
+type BenchCmdT struct {
+	Rules    []string      `arg:"" type:"path" help:"${benchRulesHelp}"`
+	Corpus   string        `short:"c" required:"" type:"existingfile" help:"${benchCorpusHelp}"`
+	SrcType  string        `name:"src-type" help:"${benchSourceHelp}"`
+	LineTime time.Duration `name:"line-time" default:"10us" help:"${benchLineTimeHelp}"`
+}
+
+// outputFormat returns the --format flag, or def when it is not set. The flag is shared by
+// detection and the subcommands so that a root flag does not shadow a subcommand one;
+// each accepts its own formats.
+func outputFormat(def string, formats ...string) (string, error) {
+
+	if Options.Format == "" {
+		return def, nil
+	}
+
+	if !slices.Contains(formats, Options.Format) {
+		return "", fmt.Errorf("%w: %s", ErrFormat, Options.Format)
+	}
+
+	return Options.Format, nil
+}
+
+// Execute runs the selected subcommand.
+func Execute(ctx context.Context, cmd string) error {
+	switch cmd {
+	case cmdDetectFormat:
+		return DetectFormat(ctx, Commands.DetectFormat)
+	case cmdLint:
+		return Lint(ctx, Commands.Lint)
+	case cmdTest:
+		return Test(ctx, Commands.Test)
+	case cmdRulesList:
+		return RulesList(ctx)
+	case cmdRulesUse:
+		return RulesUse(ctx, Commands.Rules.Use)
+	case cmdRulesBack:
+		return RulesRollback(ctx)
+	case cmdRulesImport:
+		return RulesImport(ctx, Commands.Rules.Import)
+	case cmdRulesSign:
+		return RulesSign(ctx, Commands.Rules.Sign)
+	case cmdRulesVerify:
+		return RulesVerify(ctx, Commands.Rules.Verify)
+	case cmdMirror:
+		return Mirror(ctx, Commands.Mirror)
+	case cmdNewRule:
+		return NewRule(ctx, Commands.NewRule)
+	case cmdBench:
+		return Bench(ctx, Commands.Bench)
+	default:
+		return InitAndExecute(ctx)
+	}
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/prequel-dev/preq/internal/pkg/config"
+	"github.com/prequel-dev/preq/internal/pkg/resolve"
+	"github.com/prequel-dev/preq/internal/pkg/timez"
+	"github.com/prequel-dev/preq/internal/pkg/ux"
+	"github.com/rs/zerolog/log"
+)
+
+// DetectFormat reports how the timestamp format of a file or stdin is detected.
+func DetectFormat(ctx context.Context, cmd DetectFormatCmdT) error {
+
+	var (
+		c      *config.Config
+		rdr    io.Reader = os.Stdin
+		name             = "stdin"
+		sample []byte
+		err    error
+	)
+
+	if c, err = config.LoadConfig(defaultConfigDir, configFile); err != nil {
+		log.Error().Err(err).Msg("Failed to load config")
+		ux.ConfigError(err)
+		return err
+	}
+
+	if c.Skip == 0 {
+		c.Skip = timez.DefaultSkip
+	}
+
+	opts := tsOpts(c)
+
+	if cmd.Path != "" {
+		fh, err := os.Open(cmd.Path)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to open file")
+			ux.DataError(err)
+			return err
+		}
+		defer fh.Close()
+
+		if info, err := fh.Stat(); err == nil {
+			opts = append(opts, resolve.WithRefTime(info.ModTime()))
+		}
+
+		rdr, name = fh, cmd.Path
+	}
+
+	if sample, err = resolve.ReadSample(name, rdr); err != nil {
+		log.Error().Err(err).Msg("Failed to read sample")
+		ux.DataError(err)
+		return err
+	}
+
+	d := resolve.Diagnose(sample, cmd.Lines, opts...)
+
+	ux.PrintDiagnosis(name, d)
+
+	return d.Err
+}
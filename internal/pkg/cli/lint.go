@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/prequel-dev/preq/internal/pkg/engine"
+	"github.com/prequel-dev/preq/internal/pkg/utils"
+	"github.com/prequel-dev/preq/internal/pkg/ux"
+	"github.com/rs/zerolog/log"
+)
+
+// Lint checks rule files and prints each problem found. Returns engine.ErrLint if there are any.
+func Lint(ctx context.Context, cmd LintCmdT) error {
+
+	var paths []string
+
+	format, err := outputFormat(ux.FormatText, ux.FormatText, ux.FormatJSON)
+	if err != nil {
+		return ux.Error(err)
+	}
+
+	for _, path := range cmd.Paths {
+		files, err := utils.ExpandRulesPath(path)
+		if err != nil {
+			log.Error().Err(err).Str("path", path).Msg("Failed to expand rules path")
+			return err
+		}
+		paths = append(paths, files...)
+	}
+
+	problems := engine.LintRulesPaths(paths)
+
+	switch format {
+	case ux.FormatJSON:
+		data, err := json.MarshalIndent(problems, "", "  ")
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to marshal lint problems")
+			return err
+		}
+		fmt.Fprintln(os.Stdout, string(data))
+	default:
+		printLint(paths, problems)
+	}
+
+	if len(problems) > 0 {
+		return engine.ErrLint
+	}
+
+	return nil
+}
+
+func printLint(paths []string, problems []engine.LintProblemT) {
+
+	var (
+		w   = os.Stdout
+		bad = text.Colors{text.FgHiRed, text.Bold}
+		ok  = text.Colors{text.FgHiGreen, text.Bold}
+	)
+
+	for _, p := range problems {
+		fmt.Fprintln(w, p.String())
+	}
+
+	if len(problems) == 0 {
+		fmt.Fprintf(w, "%s %d file(s) checked, no problems found\n", ok.Sprint("OK:"), len(paths))
+		return
+	}
+
+	fmt.Fprintf(w, "\n%s %d problem(s) in %d file(s) checked\n", bad.Sprint("FAIL:"), len(problems), len(paths))
+}
@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prequel-dev/preq/internal/pkg/rules"
+	"github.com/prequel-dev/preq/internal/pkg/ux"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	mirrorShutdownTimeout = 5 * time.Second
+	mirrorHeaderTimeout   = 10 * time.Second
+)
+
+// Mirror serves a directory of signed releases to preq clients until interrupted.
+func Mirror(ctx context.Context, cmd MirrorCmdT) error {
+
+	var (
+		opts   []rules.MirrorOptT
+		errCh  = make(chan error, 2)
+		server *http.Server
+	)
+
+	if cmd.Token != "" {
+		opts = append(opts, rules.WithMirrorToken(cmd.Token))
+	}
+
+	if cmd.Url != "" {
+		opts = append(opts, rules.WithMirrorBaseUrl(cmd.Url))
+	}
+
+	m := rules.NewMirror(cmd.Dir, opts...)
+
+	server = &http.Server{
+		Addr:              cmd.Listen,
+		Handler:           m.Handler(),
+		ReadHeaderTimeout: mirrorHeaderTimeout,
+	}
+
+	go func() {
+		var err error
+		if cmd.TlsCert != "" {
+			err = server.ListenAndServeTLS(cmd.TlsCert, cmd.TlsKey)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+	}()
+
+	if cmd.UdpListen != "" {
+		go func() {
+			if err := m.ServeUDP(ctx, cmd.UdpListen); err != nil {
+				errCh <- err
+			}
+		}()
+	}
+
+	log.Info().
+		Str("dir", cmd.Dir).
+		Str("listen", cmd.Listen).
+		Str("udp", cmd.UdpListen).
+		Bool("tls", cmd.TlsCert != "").
+		Msg("Serving rules mirror")
+
+	var err error
+
+	select {
+	case <-ctx.Done():
+	case err = <-errCh:
+		log.Error().Err(err).Msg("Mirror failed")
+		ux.ConfigError(err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), mirrorShutdownTimeout)
+	defer cancel()
+
+	if serr := server.Shutdown(shutdownCtx); serr != nil {
+		log.Error().Err(serr).Msg("Failed to shut down mirror")
+	}
+
+	return err
+}
@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/prequel-dev/preq/internal/pkg/config"
+	"github.com/prequel-dev/preq/internal/pkg/rulegen"
+	"github.com/prequel-dev/preq/internal/pkg/timez"
+	"github.com/prequel-dev/preq/internal/pkg/ux"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	newRuleKindAuto = "auto"
+)
+
+var (
+	sourceNameExp = regexp.MustCompile(`[^a-z0-9-]+`)
+)
+
+// NewRule generates a rule from example lines of a log file and verifies that it matches them.
+func NewRule(ctx context.Context, cmd NewRuleCmdT) error {
+
+	var (
+		c     *config.Config
+		match *regexp.Regexp
+		opts  []rulegen.OptT
+		err   error
+	)
+
+	if cmd.Lines == "" && cmd.Match == "" {
+		err = fmt.Errorf("%w: use --lines or --match", rulegen.ErrNoLines)
+		ux.RulesError(err)
+		return err
+	}
+
+	if cmd.Match != "" {
+		if match, err = regexp.Compile(cmd.Match); err != nil {
+			log.Error().Err(err).Str("match", cmd.Match).Msg("Invalid match regex")
+			ux.RulesError(err)
+			return err
+		}
+	}
+
+	if c, err = config.LoadConfig(defaultConfigDir, configFile); err != nil {
+		log.Error().Err(err).Msg("Failed to load config")
+		ux.ConfigError(err)
+		return err
+	}
+
+	if c.Skip == 0 {
+		c.Skip = timez.DefaultSkip
+	}
+
+	data, err := os.ReadFile(cmd.Path)
+	if err != nil {
+		log.Error().Err(err).Str("path", cmd.Path).Msg("Failed to read log")
+		ux.DataError(err)
+		return err
+	}
+
+	lines, err := rulegen.SelectLines(data, cmd.Lines, match, tsOpts(c)...)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to select lines")
+		ux.RulesError(err)
+		return err
+	}
+
+	source := cmd.Source
+	if source == "" {
+		source = defaultSource(cmd.Path)
+	}
+	opts = append(opts, rulegen.WithSource(source))
+
+	if cmd.Id != "" {
+		opts = append(opts, rulegen.WithCreId(cmd.Id))
+	}
+
+	if cmd.Kind != newRuleKindAuto {
+		opts = append(opts, rulegen.WithKind(cmd.Kind))
+	}
+
+	rule, err := rulegen.Generate(lines, opts...)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate rule")
+		ux.RulesError(err)
+		return err
+	}
+
+	// Verify with the same timestamp formats used to select the lines
+	cfg, err := os.ReadFile(filepath.Join(defaultConfigDir, configFile))
+	if err != nil {
+		cfg = nil
+	}
+
+	hits, err := rulegen.Verify(ctx, string(cfg), rule, lines)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to verify rule")
+		ux.RulesError(err)
+		return err
+	}
+
+	// Write only a rule that matches the lines it was generated from
+	if cmd.Out == "" {
+		fmt.Fprint(os.Stdout, string(rule.Data))
+	} else if err = os.WriteFile(cmd.Out, rule.Data, 0644); err != nil {
+		log.Error().Err(err).Str("path", cmd.Out).Msg("Failed to write rule")
+		ux.RulesError(err)
+		return err
+	}
+
+	var (
+		w  = os.Stderr
+		ok = text.Colors{text.FgHiGreen, text.Bold}
+	)
+
+	if cmd.Out != "" {
+		w = os.Stdout
+		fmt.Fprintf(w, "Wrote rule to %s\n", cmd.Out)
+	}
+
+	fmt.Fprintf(w, "%s %s matches the %d selected line(s) with %d detection(s)\n", ok.Sprint("OK:"), rule.CreId, len(lines), hits)
+
+	return nil
+}
+
+// defaultSource names the event source after the log file, e.g. cre.log.kafka for kafka.log.
+func defaultSource(path string) string {
+
+	name := strings.ToLower(filepath.Base(path))
+	name, _, _ = strings.Cut(name, ".")
+	name = strings.Trim(sourceNameExp.ReplaceAllString(name, "-"), "-")
+
+	if name == "" {
+		name = "app"
+	}
+
+	return "cre.log." + name
+}
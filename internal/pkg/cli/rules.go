@@ -0,0 +1,248 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Masterminds/semver"
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/prequel-dev/preq/internal/pkg/config"
+	"github.com/prequel-dev/preq/internal/pkg/rules"
+	"github.com/prequel-dev/preq/internal/pkg/utils"
+	"github.com/prequel-dev/preq/internal/pkg/ux"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrNoPublicKey      = errors.New("no public key")
+	ErrRulesNotVerified = errors.New("rules not verified")
+)
+
+// RulesList prints the installed community rules versions, marking the active one.
+func RulesList(_ context.Context) error {
+
+	var (
+		w      = os.Stdout
+		active = text.Colors{text.FgHiGreen, text.Bold}
+	)
+
+	pkgs, err := rules.ListRulesVersions(defaultConfigDir)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list rules versions")
+		ux.RulesError(err)
+		return err
+	}
+
+	if len(pkgs) == 0 {
+		fmt.Fprintln(w, "No community rules installed")
+		return nil
+	}
+
+	currVer, _, err := rules.GetCurrentRulesVersion(defaultConfigDir)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get current rules version")
+	}
+
+	selected, err := rules.SelectedRulesVersion(defaultConfigDir)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to read selected rules version")
+	}
+
+	for i := len(pkgs) - 1; i >= 0; i-- {
+		p := pkgs[i]
+		switch {
+		case currVer != nil && p.Version.Equal(currVer) && selected != nil:
+			fmt.Fprintf(w, "%s %-12s %s (selected)\n", active.Sprint("*"), p.Version, p.Path)
+		case currVer != nil && p.Version.Equal(currVer):
+			fmt.Fprintf(w, "%s %-12s %s\n", active.Sprint("*"), p.Version, p.Path)
+		default:
+			fmt.Fprintf(w, "  %-12s %s\n", p.Version, p.Path)
+		}
+	}
+
+	warnConfigPin(nil)
+
+	return nil
+}
+
+// RulesUse selects an installed rules version; "latest" follows updates again.
+func RulesUse(_ context.Context, cmd RulesUseCmdT) error {
+
+	pkg, err := rules.UseRulesVersion(defaultConfigDir, cmd.Version)
+	if err != nil {
+		log.Error().Err(err).Str("version", cmd.Version).Msg("Failed to use rules version")
+		ux.RulesError(err)
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "Using rules version %s (%s)\n", pkg.Version, pkg.Path)
+
+	warnConfigPin(pkg.Version)
+
+	return nil
+}
+
+// RulesRollback selects the installed rules version before the active one.
+func RulesRollback(_ context.Context) error {
+
+	pkg, err := rules.RollbackRulesVersion(defaultConfigDir)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to roll back rules version")
+		ux.RulesError(err)
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "Rolled back to rules version %s (%s)\n", pkg.Version, pkg.Path)
+	fmt.Fprintf(os.Stdout, "Run `%s rules use latest` to follow updates again\n", ux.ProcessName())
+
+	warnConfigPin(pkg.Version)
+
+	return nil
+}
+
+// warnConfigPin notes a rulesVersion in the config file, which takes precedence over the selection.
+func warnConfigPin(selected *semver.Version) {
+
+	c, err := config.LoadConfig(defaultConfigDir, configFile)
+	if err != nil || c.RulesVersion == "" {
+		return
+	}
+
+	if pin, err := semver.NewVersion(c.RulesVersion); err == nil && selected != nil && pin.Equal(selected) {
+		return
+	}
+
+	fmt.Fprintf(os.Stdout, "Note: rulesVersion %s is pinned in %s and takes precedence\n", c.RulesVersion, configFile)
+}
+
+// RulesImport verifies a community rules package and installs it for offline use.
+func RulesImport(_ context.Context, cmd RulesImportCmdT) error {
+
+	pkg, err := rules.ImportRulesBundle(defaultConfigDir, cmd.Path)
+	if err != nil {
+		log.Error().Err(err).Str("path", cmd.Path).Msg("Failed to import rules bundle")
+		ux.RulesError(err)
+		return err
+	}
+
+	fmt.Fprintln(os.Stdout, "ECDSA signature and sha256 hash verified")
+	fmt.Fprintf(os.Stdout, "Imported rules version %s (%s)\n", pkg.Version, pkg.Path)
+
+	return nil
+}
+
+// RulesSign signs user rule files with the organization's private key.
+func RulesSign(_ context.Context, cmd RulesSignCmdT) error {
+
+	key, err := os.ReadFile(cmd.Key)
+	if err != nil {
+		log.Error().Err(err).Str("path", cmd.Key).Msg("Failed to read signing key")
+		ux.RulesError(err)
+		return err
+	}
+
+	files, err := expandRulesPaths(cmd.Paths)
+	if err != nil {
+		ux.RulesError(err)
+		return err
+	}
+
+	for _, fn := range files {
+		sigPath, err := rules.SignRulesFile(fn, key)
+		if err != nil {
+			log.Error().Err(err).Str("path", fn).Msg("Failed to sign rules")
+			ux.RulesError(err)
+			return err
+		}
+		fmt.Fprintf(os.Stdout, "Signed %s (%s)\n", fn, sigPath)
+	}
+
+	return nil
+}
+
+// RulesVerify checks user rule files against their signatures. Returns ErrRulesNotVerified if any fail.
+func RulesVerify(_ context.Context, cmd RulesVerifyCmdT) error {
+
+	var (
+		w        = os.Stdout
+		ok       = text.Colors{text.FgHiGreen, text.Bold}
+		bad      = text.Colors{text.FgHiRed, text.Bold}
+		keyPath  = cmd.Key
+		paths    = cmd.Paths
+		failures int
+	)
+
+	if keyPath == "" || len(paths) == 0 {
+		c, err := config.LoadConfig(defaultConfigDir, configFile)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to load config")
+			ux.ConfigError(err)
+			return err
+		}
+		if keyPath == "" {
+			keyPath = c.Rules.Signing.PublicKey
+		}
+		if len(paths) == 0 {
+			paths = c.Rules.Paths
+		}
+	}
+
+	if keyPath == "" {
+		err := fmt.Errorf("%w: use --key or rules.signing.publicKey in %s", ErrNoPublicKey, configFile)
+		ux.RulesError(err)
+		return err
+	}
+
+	if len(paths) == 0 {
+		err := fmt.Errorf("%w: pass rule files or set rules.paths in %s", rules.ErrNoRules, configFile)
+		ux.RulesError(err)
+		return err
+	}
+
+	key, err := os.ReadFile(keyPath)
+	if err != nil {
+		log.Error().Err(err).Str("path", keyPath).Msg("Failed to read public key")
+		ux.RulesError(err)
+		return err
+	}
+
+	files, err := expandRulesPaths(paths)
+	if err != nil {
+		ux.RulesError(err)
+		return err
+	}
+
+	for _, fn := range files {
+		if err := rules.VerifyRulesFile(fn, key); err != nil {
+			fmt.Fprintf(w, "%s %v\n", bad.Sprint("FAIL:"), err)
+			failures++
+			continue
+		}
+		fmt.Fprintf(w, "%s %s\n", ok.Sprint("OK:"), fn)
+	}
+
+	if failures > 0 {
+		fmt.Fprintf(w, "\n%d of %d file(s) not verified\n", failures, len(files))
+		return ErrRulesNotVerified
+	}
+
+	return nil
+}
+
+func expandRulesPaths(paths []string) ([]string, error) {
+
+	var files []string
+
+	for _, path := range paths {
+		fs, err := utils.ExpandRulesPath(path)
+		if err != nil {
+			log.Error().Err(err).Str("path", path).Msg("Failed to expand rules path")
+			return nil, err
+		}
+		files = append(files, fs...)
+	}
+
+	return files, nil
+}
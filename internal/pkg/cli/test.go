@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/prequel-dev/preq/internal/pkg/ruletest"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrTestsFailed = errors.New("rule tests failed")
+)
+
+// Test runs each rule test spec and prints a pass/fail summary. Returns ErrTestsFailed if any test fails.
+func Test(ctx context.Context, cmd TestCmdT) error {
+
+	var (
+		w              = os.Stdout
+		pass           = text.Colors{text.FgHiGreen, text.Bold}
+		fail           = text.Colors{text.FgHiRed, text.Bold}
+		passed, failed int
+	)
+
+	for _, path := range cmd.Specs {
+
+		spec, err := ruletest.LoadSpec(path)
+		if err != nil {
+			log.Error().Err(err).Str("path", path).Msg("Failed to load test spec")
+			fmt.Fprintf(w, "%s %s: %v\n", fail.Sprint("FAIL"), path, err)
+			failed += 1
+			continue
+		}
+
+		results, err := spec.Run(ctx)
+		if err != nil {
+			log.Error().Err(err).Str("path", path).Msg("Failed to run test spec")
+			fmt.Fprintf(w, "%s %s: %v\n", fail.Sprint("FAIL"), path, err)
+			failed += 1
+			continue
+		}
+
+		for _, r := range results {
+			if r.Passed() {
+				fmt.Fprintf(w, "%s %s: %s\n", pass.Sprint("PASS"), path, r.Name)
+				passed += 1
+				continue
+			}
+
+			fmt.Fprintf(w, "%s %s: %s\n", fail.Sprint("FAIL"), path, r.Name)
+			if r.Err != nil {
+				fmt.Fprintf(w, "    %v\n", r.Err)
+			}
+			for _, d := range r.Diffs {
+				fmt.Fprintf(w, "    %s\n", d)
+			}
+			failed += 1
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d passed, %d failed\n", passed, failed)
+
+	if failed > 0 {
+		return ErrTestsFailed
+	}
+
+	return nil
+}
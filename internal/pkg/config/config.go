@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,10 +9,15 @@ import (
 	"time"
 
 	"github.com/prequel-dev/preq/internal/pkg/resolve"
+	"github.com/prequel-dev/preq/internal/pkg/utils"
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
 )
 
+var (
+	ErrNoSigningKey = errors.New("rule signatures required without a public key")
+)
+
 var (
 	defaultConfig = `timestamps:
 
@@ -176,19 +182,57 @@ var (
 )
 
 type Config struct {
-	TimestampRegexes []Regex        `yaml:"timestamps"`
-	Rules            Rules          `yaml:"rules"`
-	UpdateFrequency  *time.Duration `yaml:"updateFrequency"`
-	RulesVersion     string         `yaml:"rulesVersion"`
-	AcceptUpdates    bool           `yaml:"acceptUpdates"`
-	DataSources      string         `yaml:"dataSources"`
-	Window           time.Duration  `yaml:"window"`
-	Skip             int            `yaml:"skip"`
+	TimestampRegexes []Regex             `yaml:"timestamps"`
+	Rules            Rules               `yaml:"rules"`
+	UpdateFrequency  *time.Duration      `yaml:"updateFrequency"`
+	RulesVersion     string              `yaml:"rulesVersion"` // Pinned community rules release; updates never move past it
+	AcceptUpdates    bool                `yaml:"acceptUpdates"`
+	Offline          bool                `yaml:"offline"` // Skip login and update checks; use installed or imported rules
+	Updates          Updates             `yaml:"updates"`
+	Overrides        utils.OverridesT    `yaml:"overrides"`
+	DataSources      string              `yaml:"dataSources"`
+	Window           time.Duration       `yaml:"window"`
+	Skip             int                 `yaml:"skip"`
+	Year             int                 `yaml:"year"`
+	Transforms       resolve.TransformsT `yaml:"transforms"` // Logs piped on stdin; data sources set their own
 }
 
 type Rules struct {
+	// Rule files, directories (searched recursively) or glob patterns
 	Paths    []string `yaml:"paths"`
 	Disabled bool     `yaml:"disableCommunityRules"`
+	Signing  Signing  `yaml:"signing"`
+
+	utils.RuleFilterT `yaml:",inline"`
+}
+
+// Signing verifies user rule files against an organization key (see `preq rules sign`).
+// A file's signature is kept next to it with a .sig suffix.
+type Signing struct {
+	PublicKey string `yaml:"publicKey"` // PEM file with the org's ECDSA public key
+	Require   bool   `yaml:"require"`   // Refuse to run with unsigned or tampered user rules
+}
+
+// Validate checks that a key is configured when signatures are required.
+func (s Signing) Validate() error {
+	if s.Require && s.PublicKey == "" {
+		return ErrNoSigningKey
+	}
+	return nil
+}
+
+// Updates points update checks and downloads at a self-hosted mirror (see `preq mirror`)
+// instead of the Prequel service. Packages are still verified against the embedded public key.
+type Updates struct {
+	Endpoint     string `yaml:"endpoint"`     // Checkin and download auth, e.g. https://preq-mirror.internal:8443
+	FastEndpoint string `yaml:"fastEndpoint"` // UDP fast check host:port; omit to check only every updateFrequency
+	DownloadUrl  string `yaml:"downloadUrl"`  // Base URL for package downloads, if not served by the endpoint
+	Token        string `yaml:"token"`        // Bearer token for the mirror; used instead of logging in
+}
+
+// IsMirror reports whether updates come from a self-hosted mirror.
+func (u Updates) IsMirror() bool {
+	return u.Endpoint != ""
 }
 
 type Regex struct {
@@ -253,6 +297,22 @@ func LoadConfig(dir, file string, opts ...OptT) (*Config, error) {
 		return nil, err
 	}
 
+	if err := config.Transforms.Compile(); err != nil {
+		return nil, err
+	}
+
+	if err := config.Rules.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := config.Rules.Signing.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := config.Overrides.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
 
@@ -266,6 +326,18 @@ func LoadConfigFromBytes(data string) (*Config, error) {
 	if err := yaml.Unmarshal([]byte(data), &config); err != nil {
 		return nil, err
 	}
+	if err := config.Transforms.Compile(); err != nil {
+		return nil, err
+	}
+	if err := config.Rules.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Rules.Signing.Validate(); err != nil {
+		return nil, err
+	}
+	if err := config.Overrides.Validate(); err != nil {
+		return nil, err
+	}
 	return &config, nil
 }
 
@@ -282,6 +354,21 @@ func (c *Config) ResolveOpts() (opts []resolve.OptT) {
 		opts = append(opts, resolve.WithStampRegex(specs...))
 	}
 
+	// Timestamps without a year (e.g. RFC 3164) are otherwise resolved against the file mtime
+	if c.Year > 0 {
+		opts = append(opts, resolve.WithYear(c.Year))
+	}
+
 	return
 
 }
+
+// StdinOpts are the options for logs piped on stdin, which have no data source to set transforms.
+func (c *Config) StdinOpts() (opts []resolve.OptT) {
+
+	if len(c.Transforms) > 0 {
+		opts = append(opts, resolve.WithTransforms(c.Transforms))
+	}
+
+	return
+}
@@ -1,6 +1,7 @@
 package config_test
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -48,6 +49,54 @@ func TestLoadConfigFromBytes(t *testing.T) {
 	if cfg.Window != time.Second {
 		t.Fatalf("expected 1s window, got %v", cfg.Window)
 	}
+
+	cfg, err = config.LoadConfigFromBytes("transforms:\n  - type: ansi\n  - type: json\n    field: log\n")
+	if err != nil {
+		t.Fatalf("LoadConfigFromBytes transforms: %v", err)
+	}
+	if len(cfg.Transforms) != 2 || len(cfg.StdinOpts()) != 1 {
+		t.Fatalf("expected 2 stdin transforms, got %d", len(cfg.Transforms))
+	}
+
+	if _, err = config.LoadConfigFromBytes("transforms:\n  - type: drop\n"); err == nil {
+		t.Fatalf("expected error for drop transform without match")
+	}
+
+	cfg, err = config.LoadConfigFromBytes("rules:\n  paths: [rules/]\n  exclude:\n    tags: [experimental]\n  severity: high\n")
+	if err != nil {
+		t.Fatalf("LoadConfigFromBytes rules filter: %v", err)
+	}
+	if len(cfg.Rules.Paths) != 1 || len(cfg.Rules.Exclude.Tags) != 1 || cfg.Rules.Severity != "high" {
+		t.Fatalf("unexpected rules config %+v", cfg.Rules)
+	}
+
+	if _, err = config.LoadConfigFromBytes("rules:\n  severity: urgent\n"); err == nil {
+		t.Fatalf("expected invalid severity error")
+	}
+
+	cfg, err = config.LoadConfigFromBytes("overrides:\n  CRE-2025-0001:\n    disabled: true\n  CRE-2025-0002:\n    severity: low\n    tags: [noisy]\n")
+	if err != nil {
+		t.Fatalf("LoadConfigFromBytes overrides: %v", err)
+	}
+	if !cfg.Overrides["CRE-2025-0001"].Disabled || cfg.Overrides["CRE-2025-0002"].Severity != "low" {
+		t.Fatalf("unexpected overrides %+v", cfg.Overrides)
+	}
+
+	if _, err = config.LoadConfigFromBytes("overrides:\n  CRE-2025-0001:\n    window: soon\n"); err == nil {
+		t.Fatalf("expected invalid override window error")
+	}
+
+	cfg, err = config.LoadConfigFromBytes("rules:\n  signing:\n    publicKey: org_pub.pem\n    require: true\n")
+	if err != nil {
+		t.Fatalf("LoadConfigFromBytes signing: %v", err)
+	}
+	if cfg.Rules.Signing.PublicKey != "org_pub.pem" || !cfg.Rules.Signing.Require {
+		t.Fatalf("unexpected signing config: %+v", cfg.Rules.Signing)
+	}
+
+	if _, err = config.LoadConfigFromBytes("rules:\n  signing:\n    require: true\n"); !errors.Is(err, config.ErrNoSigningKey) {
+		t.Fatalf("expected ErrNoSigningKey, got %v", err)
+	}
 }
 
 func TestWriteDefaultConfigAndResolveOpts(t *testing.T) {
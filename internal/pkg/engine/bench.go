@@ -0,0 +1,337 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"regexp/syntax"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prequel-dev/preq/internal/pkg/ux"
+	"github.com/prequel-dev/prequel-compiler/pkg/parser"
+	"github.com/prequel-dev/prequel-logmatch/pkg/entry"
+	lm "github.com/prequel-dev/prequel-logmatch/pkg/match"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	benchMaxRepeat = 100 // Counted repetitions above this expand into large programs
+)
+
+// SourcesFuncT returns fresh data sources; each call must be able to scan the data again.
+type SourcesFuncT func() ([]*LogData, error)
+
+type benchCostT struct {
+	lines  int64
+	dur    time.Duration
+	allocs uint64
+	bytes  uint64
+	hits   int
+}
+
+// RunBench scans the sources once per rule, each rule on its own, and measures its matcher time,
+// lines per second, allocations and hits. A baseline scan per source type without matchers is
+// subtracted from the allocations. Rules are flagged if their regexes are pathological or their
+// mean matcher time per line exceeds lineTime. Set Bench before compiling the rules.
+func (r *RuntimeT) RunBench(ctx context.Context, matchers *RuleMatchersT, sourcesF SourcesFuncT, lineTime time.Duration) ([]ux.BenchT, error) {
+
+	var (
+		rows     = make([]ux.BenchT, 0, len(matchers.eventSrc))
+		baseline = make(map[string]benchCostT)
+	)
+
+	for ruleId, pe := range matchers.eventSrc {
+
+		cre, err := r.getCre(matchers.hash[ruleId])
+		if err != nil {
+			log.Warn().Str("rule_id", ruleId).Msg("Failed to get CRE for bench")
+		}
+
+		rows = append(rows, ux.BenchT{
+			CreId:  cre.Id,
+			RuleId: ruleId,
+			Source: pe.Source,
+			Slow:   r.regexes[ruleId].lint(),
+		})
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].CreId < rows[j].CreId
+	})
+
+	for i := range rows {
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var (
+			row     = &rows[i]
+			srcType string
+		)
+
+		// Composed rules scan detections rather than logs
+		if row.Source == DetectionSource {
+			continue
+		}
+
+		ld, err := benchSource(sourcesF, row.Source)
+		if err != nil {
+			return nil, err
+		}
+
+		if ld == nil {
+			log.Warn().Str("cre", row.CreId).Str("src", row.Source).Msg("No data to bench rule")
+			continue
+		}
+
+		srcType = ld.SrcType()
+
+		m, ok := matchers.match[row.RuleId].(lm.Matcher)
+		if !ok {
+			return nil, ErrUnknownObjectType
+		}
+
+		base, ok := baseline[srcType]
+		if !ok {
+			if base, err = r.benchScan(ld, nil); err != nil {
+				return nil, err
+			}
+			baseline[srcType] = base
+
+			if ld, err = benchSource(sourcesF, row.Source); err != nil {
+				return nil, err
+			}
+		}
+
+		cost, err := r.benchScan(ld, m)
+		if err != nil {
+			return nil, err
+		}
+
+		row.Lines = cost.lines
+		row.MatchTime = cost.dur
+		row.Hits = cost.hits
+		row.Allocs = minus(cost.allocs, base.allocs)
+		row.Bytes = minus(cost.bytes, base.bytes)
+
+		if cost.lines > 0 {
+			row.NsPerLine = float64(cost.dur.Nanoseconds()) / float64(cost.lines)
+		}
+		if cost.dur > 0 {
+			row.LinesPerSec = float64(cost.lines) / cost.dur.Seconds()
+		}
+
+		if lineTime > 0 && row.NsPerLine > float64(lineTime.Nanoseconds()) {
+			row.Slow = append(row.Slow, fmt.Sprintf("%s per line exceeds %s", time.Duration(row.NsPerLine), lineTime))
+		}
+	}
+
+	return rows, nil
+}
+
+// benchSource returns the source scanned by rules of the source type, or nil if none.
+func benchSource(sourcesF SourcesFuncT, src string) (*LogData, error) {
+
+	sources, err := sourcesF()
+	if err != nil {
+		return nil, err
+	}
+
+	var found *LogData
+	for _, ld := range sources {
+		if found == nil && (ld.SrcType() == "*" || ld.SrcType() == src) {
+			found = ld
+			continue
+		}
+		ld.Close()
+	}
+
+	return found, nil
+}
+
+// benchScan runs the scan loop over the source with only the matcher, or none for a baseline.
+func (r *RuntimeT) benchScan(ld *LogData, m lm.Matcher) (benchCostT, error) {
+
+	var (
+		cost          benchCostT
+		before, after runtime.MemStats
+	)
+
+	tracker, err := r.Ux.NewBytesTracker(ld.Name())
+	if err != nil {
+		return cost, err
+	}
+
+	scanCb := func(e entry.LogEntry) bool {
+		cost.lines++
+		if m == nil {
+			return false
+		}
+
+		start := time.Now()
+		hits := m.Scan(e)
+		cost.dur += time.Since(start)
+
+		if hits.Cnt > 0 {
+			cost.hits++
+		}
+		return false
+	}
+
+	runtime.ReadMemStats(&before)
+
+	_spinLogs(ld, scanCb, r.Stop, tracker, nil)
+
+	if m != nil {
+		start := time.Now()
+		if hits := m.Eval(futureMark); hits.Cnt > 0 {
+			cost.hits++
+		}
+		cost.dur += time.Since(start)
+	}
+
+	runtime.ReadMemStats(&after)
+
+	tracker.MarkAsDone()
+
+	cost.allocs = after.Mallocs - before.Mallocs
+	cost.bytes = after.TotalAlloc - before.TotalAlloc
+
+	return cost, nil
+}
+
+// minus subtracts the baseline, which may be larger when the garbage collector ran.
+func minus(a, b uint64) uint64 {
+	if a < b {
+		return 0
+	}
+	return a - b
+}
+
+// benchRegexesT are the regexes a rule matches with, including nested and named terms.
+type benchRegexesT []string
+
+func newBenchRegexes(rules []*parser.RulesT) map[string]benchRegexesT {
+
+	var out = make(map[string]benchRegexesT)
+
+	for _, rs := range rules {
+		for _, rule := range rs.Rules {
+			var res benchRegexesT
+			if s := rule.Rule.Sequence; s != nil {
+				res = res.addTerms(rs.TermsT, s.Order, s.Negate)
+			}
+			if s := rule.Rule.Set; s != nil {
+				res = res.addTerms(rs.TermsT, s.Match, s.Negate)
+			}
+			out[rule.Metadata.Id] = res
+		}
+	}
+
+	return out
+}
+
+func (res benchRegexesT) addTerms(named map[string]parser.ParseTermT, terms ...[]parser.ParseTermT) benchRegexesT {
+	for _, ts := range terms {
+		for _, t := range ts {
+			if n, ok := named[t.StrValue]; ok && t.StrValue != "" {
+				t = n
+			}
+			switch {
+			case t.RegexValue != "":
+				res = append(res, t.RegexValue)
+			case t.Sequence != nil:
+				res = res.addTerms(named, t.Sequence.Order, t.Sequence.Negate)
+			case t.Set != nil:
+				res = res.addTerms(named, t.Set.Match, t.Set.Negate)
+			}
+		}
+	}
+	return res
+}
+
+// lint returns why each regex may be slow. Go regexes do not backtrack, but these
+// constructs multiply the states the matcher tracks on every byte of every line.
+func (res benchRegexesT) lint() []string {
+
+	var out []string
+
+	for _, expr := range res {
+		re, err := syntax.Parse(expr, syntax.Perl)
+		if err != nil {
+			// The compiler already rejected invalid regexes
+			continue
+		}
+
+		reasons := lintRegex(re, false, nil)
+
+		if re.Op == syntax.OpConcat && isWildcard(re.Sub[0]) {
+			reasons = append(reasons, "leading wildcard")
+		}
+
+		if len(reasons) > 0 {
+			out = append(out, fmt.Sprintf("regex %q: %s", expr, strings.Join(reasons, ", ")))
+		}
+	}
+
+	return out
+}
+
+func lintRegex(re *syntax.Regexp, repeated bool, out []string) []string {
+
+	switch re.Op {
+	case syntax.OpStar, syntax.OpPlus, syntax.OpRepeat:
+		if re.Op == syntax.OpRepeat && (re.Max > benchMaxRepeat || re.Min > benchMaxRepeat) {
+			out = append(out, fmt.Sprintf("counted repetition over %d", benchMaxRepeat))
+		}
+		if !isUnbounded(re) {
+			break
+		}
+		if repeated {
+			return append(out, "nested unbounded repetition")
+		}
+		repeated = true
+
+	case syntax.OpConcat:
+		var wild int
+		for _, sub := range re.Sub {
+			if isWildcard(sub) {
+				wild++
+			}
+		}
+		if wild > 1 {
+			out = append(out, fmt.Sprintf("%d unbounded wildcards", wild))
+		}
+	}
+
+	for _, sub := range re.Sub {
+		out = lintRegex(sub, repeated, out)
+	}
+
+	return out
+}
+
+// isWildcard matches .* and .+
+func isWildcard(re *syntax.Regexp) bool {
+	if re.Op != syntax.OpStar && re.Op != syntax.OpPlus {
+		return false
+	}
+	switch re.Sub[0].Op {
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return true
+	}
+	return false
+}
+
+func isUnbounded(re *syntax.Regexp) bool {
+	switch re.Op {
+	case syntax.OpStar, syntax.OpPlus:
+		return true
+	case syntax.OpRepeat:
+		return re.Max == -1
+	}
+	return false
+}
@@ -0,0 +1,304 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/prequel-dev/preq/internal/pkg/matchz"
+	"github.com/prequel-dev/prequel-compiler/pkg/parser"
+	"github.com/prequel-dev/prequel-logmatch/pkg/entry"
+	lm "github.com/prequel-dev/prequel-logmatch/pkg/match"
+	"github.com/rs/zerolog/log"
+)
+
+// DetectionSource is the event source of rules composed from detections of other CREs.
+// Each detection is a JSON line such as {"cre":"CRE-2025-0001","source":"kafka"} stamped
+// with the time of its first matching log entry. The source names the log source the
+// detection was read from; composed detections name it when all their entries share it.
+// Match them with jq terms like .cre == "CRE-2025-0001" and .source == "kafka". Terms
+// match one detection at a time, so a rule cannot require its detections to share a
+// source it does not name.
+const (
+	DetectionSource = "cre.detection"
+)
+
+var (
+	ErrRuleCycle = errors.New("rule cycle")
+)
+
+type detectionT struct {
+	ts   int64
+	line string
+}
+
+type detectionDocT struct {
+	Cre    string `json:"cre"`
+	Source string `json:"source,omitempty"`
+}
+
+func detectionLine(creId, source string) string {
+	data, _ := json.Marshal(detectionDocT{Cre: creId, Source: source})
+	return string(data)
+}
+
+// detectionSource returns the source shared by the detections in the hits, or "" if they differ.
+func detectionSource(hits *matchz.HitsT) string {
+
+	var source string
+
+	for i, e := range hits.Entries {
+		var doc detectionDocT
+		if err := json.Unmarshal(e.Entry, &doc); err != nil {
+			return ""
+		}
+		if i > 0 && doc.Source != source {
+			return ""
+		}
+		source = doc.Source
+	}
+
+	return source
+}
+
+func isComposed(rule parser.ParseRuleT) bool {
+	switch {
+	case rule.Rule.Sequence != nil && rule.Rule.Sequence.Event != nil:
+		return rule.Rule.Sequence.Event.Source == DetectionSource
+	case rule.Rule.Set != nil && rule.Rule.Set.Event != nil:
+		return rule.Rule.Set.Event.Source == DetectionSource
+	}
+	return false
+}
+
+// composeOrder returns the ids of rules on the detection source so that each rule follows
+// the composed rules whose detections it matches. A rule depends on a CRE if any of its
+// terms matches the CRE's detection line, or names the CRE since terms may also match a
+// source only known at run time. Returns ErrRuleCycle if rules depend on each other.
+func composeOrder(rules []*parser.RulesT) ([]string, error) {
+
+	var (
+		creIds  []string
+		ruleIds = make(map[string]string)
+		deps    = make(map[string][]string)
+	)
+
+	for _, rs := range rules {
+		for _, rule := range rs.Rules {
+			creIds = append(creIds, rule.Cre.Id)
+		}
+	}
+
+	sort.Strings(creIds)
+
+	for _, rs := range rules {
+		for _, rule := range rs.Rules {
+			if !isComposed(rule) {
+				continue
+			}
+
+			ruleIds[rule.Cre.Id] = rule.Metadata.Id
+
+			terms, err := composeTerms(rule, rs.TermsT)
+			if err != nil {
+				return nil, fmt.Errorf("cre %s: %w", rule.Cre.Id, err)
+			}
+
+			for _, creId := range creIds {
+				line := detectionLine(creId, "")
+				for _, t := range terms {
+					if t.match(line) || strings.Contains(t.value, creId) {
+						deps[rule.Cre.Id] = append(deps[rule.Cre.Id], creId)
+						break
+					}
+				}
+			}
+
+			if len(deps[rule.Cre.Id]) == 0 {
+				log.Warn().Str("cre", rule.Cre.Id).Msg("Composed rule matches no CRE detections")
+			}
+		}
+	}
+
+	var (
+		order []string
+		state = make(map[string]int) // 1 visiting, 2 done
+		path  []string
+		visit func(creId string) error
+	)
+
+	visit = func(creId string) error {
+		switch state[creId] {
+		case 1:
+			i := slices.Index(path, creId)
+			return fmt.Errorf("%w: %s -> %s", ErrRuleCycle, strings.Join(path[i:], " -> "), creId)
+		case 2:
+			return nil
+		}
+
+		state[creId] = 1
+		path = append(path, creId)
+
+		for _, dep := range deps[creId] {
+			if _, ok := ruleIds[dep]; !ok {
+				continue
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[creId] = 2
+		order = append(order, ruleIds[creId])
+
+		return nil
+	}
+
+	composed := make([]string, 0, len(ruleIds))
+	for creId := range ruleIds {
+		composed = append(composed, creId)
+	}
+	sort.Strings(composed)
+
+	for _, creId := range composed {
+		if err := visit(creId); err != nil {
+			return nil, err
+		}
+	}
+
+	return order, nil
+}
+
+type composeTermT struct {
+	value string
+	match lm.MatchFunc
+}
+
+// composeTerms returns every term of the rule with its matcher, including nested and negate terms.
+func composeTerms(rule parser.ParseRuleT, named map[string]parser.ParseTermT) ([]composeTermT, error) {
+
+	var (
+		out []composeTermT
+		add func(terms ...[]parser.ParseTermT) error
+	)
+
+	add = func(terms ...[]parser.ParseTermT) error {
+		for _, ts := range terms {
+			for _, t := range ts {
+				if n, ok := named[t.StrValue]; ok && t.StrValue != "" {
+					t = n
+				}
+
+				var term lm.TermT
+				switch {
+				case t.Sequence != nil:
+					if err := add(t.Sequence.Order, t.Sequence.Negate); err != nil {
+						return err
+					}
+					continue
+				case t.Set != nil:
+					if err := add(t.Set.Match, t.Set.Negate); err != nil {
+						return err
+					}
+					continue
+				case t.RegexValue != "":
+					term = lm.TermT{Type: lm.TermRegex, Value: t.RegexValue}
+				case t.JqValue != "":
+					term = lm.TermT{Type: lm.TermJqJson, Value: t.JqValue}
+				default:
+					term = lm.TermT{Type: lm.TermRaw, Value: t.StrValue}
+				}
+
+				m, err := term.NewMatcher()
+				if err != nil {
+					return err
+				}
+				out = append(out, composeTermT{value: term.Value, match: m})
+			}
+		}
+		return nil
+	}
+
+	var err error
+	switch {
+	case rule.Rule.Sequence != nil:
+		err = add(rule.Rule.Sequence.Order, rule.Rule.Sequence.Negate)
+	case rule.Rule.Set != nil:
+		err = add(rule.Rule.Set.Match, rule.Rule.Set.Negate)
+	}
+
+	return out, err
+}
+
+// addDetection records a detection to feed to composed rules.
+func (r *RuntimeT) addDetection(creId string, m matchz.HitsT) {
+
+	if len(r.composed) == 0 || len(m.Entries) == 0 {
+		return
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.detections = append(r.detections, detectionT{
+		ts:   m.Entries[0].Timestamp,
+		line: detectionLine(creId, m.Entity.Source),
+	})
+}
+
+func (r *RuntimeT) sortedDetections() []detectionT {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	out := make([]detectionT, len(r.detections))
+	copy(out, r.detections)
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].ts < out[j].ts
+	})
+
+	return out
+}
+
+// compose runs each composed rule over the detections in time order once the logs are scanned.
+// Detections of composed rules are added before the rules that depend on them run.
+func (r *RuntimeT) compose(ctx context.Context, matchers *RuleMatchersT) error {
+
+	for _, ruleId := range r.composed {
+
+		obj, ok := matchers.match[ruleId]
+		if !ok {
+			continue
+		}
+
+		m, ok := obj.(lm.Matcher)
+		if !ok {
+			return ErrUnknownObjectType
+		}
+
+		var (
+			cb      = matchers.cb[ruleId]
+			matchCb = _bindMatchCb(DetectionSource, m)
+			flushCb = _bindFlushCB(DetectionSource, m)
+		)
+
+		for _, d := range r.sortedDetections() {
+			if hits := matchCb(entry.LogEntry{Line: d.line, Timestamp: d.ts}); hits != nil {
+				hits.Entity.Source = detectionSource(hits)
+				cb(ctx, *hits)
+			}
+		}
+
+		if hits := flushCb(); hits != nil {
+			hits.Entity.Source = detectionSource(hits)
+			cb(ctx, *hits)
+		}
+	}
+
+	return nil
+}
@@ -47,10 +47,20 @@ var (
 )
 
 type RuntimeT struct {
-	mux   sync.RWMutex
-	Stop  int64
-	Ux    ux.UxFactoryI
-	Rules map[string]parser.ParseCreT
+	mux        sync.RWMutex
+	Stop       int64
+	Ux         ux.UxFactoryI
+	Rules      map[string]parser.ParseCreT
+	Filter     *utils.RuleFilterT // Rules loaded from paths are selected before compilation
+	Overrides  utils.OverridesT   // Applied to rules loaded from paths before they are selected
+	Explain    string             // CRE id of a rule to trace while running
+	Bench      bool               // Keep the regexes of compiled rules to flag pathological ones
+	Locate     bool               // Record the log file and line of each hit entry
+	Extracted  []string           // Source types with a field parser; see ExtractedTypes
+	explain    *explainerT
+	regexes    map[string]benchRegexesT
+	composed   []string // Rules on the detection source in dependency order
+	detections []detectionT
 }
 
 func New(stop int64, ux ux.UxFactoryI) *RuntimeT {
@@ -89,12 +99,14 @@ func compileRuleTree(cf compiler.RuntimeI, tree *parser.TreeT) (compiler.ObjsT,
 	return nodeObjs, nil
 }
 
-func compileRulePath(cf compiler.RuntimeI, rp utils.RulePathT) (compiler.ObjsT, *parser.RulesT, error) {
+// selectFuncT removes rules from a parsed file before it is compiled.
+type selectFuncT func(rules *parser.RulesT)
+
+func readRulePath(rp utils.RulePathT) (*parser.RulesT, error) {
 	var (
-		rs        *parser.RulesT
-		rdrOpts   = make([]utils.ReaderOptT, 0)
-		parseOpts = make([]parser.ParseOptT, 0)
-		err       error
+		rs      *parser.RulesT
+		rdrOpts = make([]utils.ReaderOptT, 0)
+		err     error
 	)
 
 	log.Info().Str("path", rp.Path).Msg("Parsing rules")
@@ -105,18 +117,31 @@ func compileRulePath(cf compiler.RuntimeI, rp utils.RulePathT) (compiler.ObjsT,
 	case utils.RuleTypeUser:
 		// Allow empty IDs in user generated content
 		rdrOpts = append(rdrOpts, utils.WithGenIds())
-		parseOpts = append(parseOpts, parser.WithGenIds())
 	}
 
-	if rs, err = utils.ParseRulesPath(rp.Path, rdrOpts...); err != nil {
-		log.Error().Err(err).Msg("Failed to parse rules")
-		return nil, nil, err
+	// Verified files are compiled from the bytes that were checked
+	if rp.Data != nil {
+		rs, err = utils.ParseRulesData(rp.Data, rdrOpts...)
+	} else {
+		rs, err = utils.ParseRulesPath(rp.Path, rdrOpts...)
+	}
+
+	if err != nil {
+		log.Error().Err(err).Str("path", rp.Path).Msg("Failed to parse rules")
+		return nil, err
 	}
 
-	return doCompileRule(cf, rs, parseOpts)
+	return rs, nil
 }
 
-func compileRule(cf compiler.RuntimeI, data []byte) (compiler.ObjsT, *parser.RulesT, error) {
+func ruleParseOpts(rt utils.RuleTypeT) []parser.ParseOptT {
+	if rt == utils.RuleTypeUser {
+		return []parser.ParseOptT{parser.WithGenIds()}
+	}
+	return nil
+}
+
+func compileRule(cf compiler.RuntimeI, data []byte, sel selectFuncT) (compiler.ObjsT, *parser.RulesT, error) {
 	var (
 		rules     *parser.RulesT
 		rdrOpts   = make([]utils.ReaderOptT, 0)
@@ -133,6 +158,10 @@ func compileRule(cf compiler.RuntimeI, data []byte) (compiler.ObjsT, *parser.Rul
 		return nil, nil, err
 	}
 
+	if sel != nil {
+		sel(rules)
+	}
+
 	return doCompileRule(cf, rules, parseOpts)
 }
 
@@ -184,16 +213,23 @@ func (r *RuntimeT) compileRules(cf compiler.RuntimeI, data []byte) (compiler.Obj
 	var (
 		nObjs compiler.ObjsT
 		ok    bool
+		sel   selectFuncT
 	)
 
-	if nObjs, rules, err = compileRule(cf, data); err != nil {
+	if len(r.Extracted) > 0 {
+		sel = func(rules *parser.RulesT) {
+			rawTermsToJq(rules, r.Extracted)
+		}
+	}
+
+	if nObjs, rules, err = compileRule(cf, data, sel); err != nil {
 		log.Error().Err(err).Msg("Failed to compile rule")
 		return nil, nil, err
 	}
 
 	r.Ux.IncrementRuleTracker(int64(len(rules.Rules)))
 
-	if ok, err = validateRules(rules, nil); !ok {
+	if ok, err = validateRules(rules, "", make(ruleDefsT)); !ok {
 		log.Error().Err(err).Msg("Failed to validate rules")
 		return nil, nil, err
 	}
@@ -202,15 +238,38 @@ func (r *RuntimeT) compileRules(cf compiler.RuntimeI, data []byte) (compiler.Obj
 
 }
 
-func (r *RuntimeT) compileRulesPaths(cf compiler.RuntimeI, paths []utils.RulePathT) (compiler.ObjsT, []*parser.RulesT, error) {
+func (r *RuntimeT) compileRulesPaths(cf compiler.RuntimeI, paths []utils.RulePathT, report *ux.ReportT) (compiler.ObjsT, []*parser.RulesT, error) {
 	var (
 		nodeObjs = make(compiler.ObjsT, 0)
 		allRules = make([]*parser.RulesT, 0)
+		defs     = make(ruleDefsT)
+		seen     = make(map[string]struct{})
+		sel      selectFuncT
 
 		err error
 	)
 
-	for _, path := range paths {
+	if len(r.Overrides) > 0 || (r.Filter != nil && !r.Filter.IsEmpty()) || len(r.Extracted) > 0 {
+		sel = func(rules *parser.RulesT) {
+			for _, rule := range rules.Rules {
+				seen[rule.Cre.Id] = struct{}{}
+			}
+			for _, o := range overrideRules(rules, r.Overrides) {
+				report.AddOverride(o.rule.Cre.Id, o.changes)
+			}
+			for _, skip := range filterRules(rules, r.skipRule) {
+				report.AddSkipped(skip.rule.Cre.Id, skip.reason)
+			}
+			rawTermsToJq(rules, r.Extracted)
+		}
+	}
+
+	groups, err := readRuleGroups(paths, sel)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, g := range groups {
 
 		var (
 			nObjs compiler.ObjsT
@@ -218,14 +277,17 @@ func (r *RuntimeT) compileRulesPaths(cf compiler.RuntimeI, paths []utils.RulePat
 			ok    bool
 		)
 
-		if nObjs, rules, err = compileRulePath(cf, path); err != nil {
+		if nObjs, rules, err = doCompileRule(cf, g.rules, ruleParseOpts(g.rt)); err != nil {
+			log.Error().Err(err).Strs("paths", g.paths()).Msg("Failed to compile rules")
 			return nil, nil, err
 		}
 
 		r.Ux.IncrementRuleTracker(int64(len(rules.Rules)))
 
-		if ok, err = validateRules(rules, allRules); !ok {
-			return nil, nil, err
+		for i, rule := range rules.Rules {
+			if ok, err = validateRule(rule, g.files[i], defs); !ok {
+				return nil, nil, err
+			}
 		}
 
 		nodeObjs = append(nodeObjs, nObjs...)
@@ -233,57 +295,72 @@ func (r *RuntimeT) compileRulesPaths(cf compiler.RuntimeI, paths []utils.RulePat
 		allRules = append(allRules, rules)
 	}
 
+	for id := range r.Overrides {
+		if _, ok := seen[id]; !ok {
+			log.Warn().Str("cre", id).Msg("Override for unknown CRE")
+		}
+	}
+
 	return nodeObjs, allRules, nil
 }
 
-func validateRule(rule parser.ParseRuleT, dupes map[string]struct{}) (bool, error) {
+func (r *RuntimeT) skipRule(rule parser.ParseRuleT) (string, bool) {
 
-	if _, ok := dupes[rule.Metadata.Id]; ok {
-		log.Error().Str("id", rule.Metadata.Id).Msg("Duplicate rule hash id. Aborting...")
-		return false, fmt.Errorf("duplicate rule hash id=%s cre=%s", rule.Metadata.Id, rule.Cre.Id)
+	if r.Overrides.Disabled(rule) {
+		return reasonOverride, true
 	}
 
-	if _, ok := dupes[rule.Metadata.Hash]; ok {
-		log.Error().Str("id", rule.Metadata.Hash).Msg("Duplicate rule hash id. Aborting...")
-		return false, fmt.Errorf("duplicate rule hash id=%s cre=%s", rule.Metadata.Hash, rule.Cre.Id)
+	if r.Filter != nil {
+		return r.Filter.Skip(rule)
 	}
 
-	if _, ok := dupes[rule.Cre.Id]; ok {
-		log.Error().Str("id", rule.Cre.Id).Msg("Duplicate rule hash id. Aborting...")
-		return false, fmt.Errorf("duplicate rule hash id=%s cre=%s", rule.Cre.Id, rule.Cre.Id)
+	return "", false
+}
+
+// ruleDefsT maps rule IDs, hashes and CRE IDs to the file that defined them; empty for in-memory rules.
+type ruleDefsT map[string]string
+
+func validateRule(rule parser.ParseRuleT, path string, defs ruleDefsT) (bool, error) {
+
+	for _, id := range []string{rule.Metadata.Id, rule.Metadata.Hash, rule.Cre.Id} {
+		prev, ok := defs[id]
+		if !ok {
+			continue
+		}
+
+		log.Error().
+			Str("id", id).
+			Str("path", path).
+			Str("previous", prev).
+			Msg("Duplicate rule hash id. Aborting...")
+
+		if path == "" && prev == "" {
+			return false, fmt.Errorf("duplicate rule hash id=%s cre=%s", id, rule.Cre.Id)
+		}
+		return false, fmt.Errorf("duplicate rule hash id=%s cre=%s in %s and %s", id, rule.Cre.Id, prev, path)
 	}
 
-	dupes[rule.Metadata.Id] = struct{}{}
-	dupes[rule.Metadata.Hash] = struct{}{}
-	dupes[rule.Cre.Id] = struct{}{}
+	defs[rule.Metadata.Id] = path
+	defs[rule.Metadata.Hash] = path
+	defs[rule.Cre.Id] = path
 
 	return true, nil
 }
 
-func validateRules(rules *parser.RulesT, allRules []*parser.RulesT) (bool, error) {
+// validateRules checks for duplicates within the rules of a file, and with rules loaded from earlier files.
+func validateRules(rules *parser.RulesT, path string, defs ruleDefsT) (bool, error) {
 
 	var (
-		dupes = make(map[string]struct{})
-		ok    bool
-		err   error
+		ok  bool
+		err error
 	)
 
-	// Check for dupes with other rules in the same config
 	for _, rule := range rules.Rules {
-		if ok, err = validateRule(rule, dupes); !ok {
+		if ok, err = validateRule(rule, path, defs); !ok {
 			return false, err
 		}
 	}
 
-	// Check for global dupes. Skip if nil.
-	for _, config := range allRules {
-		for _, rule := range config.Rules {
-			if ok, err = validateRule(rule, dupes); !ok {
-				return false, err
-			}
-		}
-	}
-
 	return true, nil
 }
 
@@ -291,6 +368,9 @@ type RuleMatchersT struct {
 	match    map[string]any
 	cb       map[string]compiler.CallbackT
 	eventSrc map[string]parser.ParseEventT
+	hash     map[string]string
+	jq       map[string]bool // Rules with jq terms match extracted documents
+	horizon  int64           // How long after an entry a rule can still report it
 }
 
 func (r *RuntimeT) AddRules(rules *parser.RulesT) error {
@@ -323,6 +403,7 @@ func loadNodeObjs(objs compiler.ObjsT) (*RuleMatchersT, error) {
 			match:    make(map[string]any),
 			cb:       make(map[string]compiler.CallbackT),
 			eventSrc: make(map[string]parser.ParseEventT),
+			hash:     make(map[string]string),
 		}
 	)
 
@@ -366,6 +447,10 @@ func loadNodeObjs(objs compiler.ObjsT) (*RuleMatchersT, error) {
 		}
 
 		m.eventSrc[obj.RuleId] = GetEventSource(obj)
+
+		if obj.Address != nil {
+			m.hash[obj.RuleId] = obj.Address.GetRuleHash()
+		}
 	}
 
 	return m, nil
@@ -444,10 +529,30 @@ func (r *RuntimeT) CompileRules(ruleData []byte, report *ux.ReportT) (*RuleMatch
 	r.AddRules(rules)
 	report.AddRules(rules)
 
+	if r.composed, err = composeOrder([]*parser.RulesT{rules}); err != nil {
+		log.Error().Err(err).Msg("Failed to order composed rules")
+		return nil, err
+	}
+
+	if r.Bench {
+		r.regexes = newBenchRegexes([]*parser.RulesT{rules})
+	}
+
+	if r.Explain != "" {
+		if r.explain, err = newExplainer([]*parser.RulesT{rules}, r.Explain); err != nil {
+			log.Error().Err(err).Msg("Failed to load rule to explain")
+			return nil, err
+		}
+	}
+
 	if matchers, err = loadNodeObjs(nodeObjs); err != nil {
 		log.Error().Err(err).Msg("Failed to load node objects")
+		return nil, err
 	}
 
+	matchers.jq = jqRules([]*parser.RulesT{rules})
+	matchers.horizon = locateHorizon([]*parser.RulesT{rules})
+
 	return matchers, nil
 }
 
@@ -495,6 +600,8 @@ func (r *RuntimeT) getRuntimeCb(report *ux.ReportT) *runtimeT {
 			r.Ux.IncrementProblemsTracker(1)
 		}
 
+		r.addDetection(cre.Id, m)
+
 		return nil
 	})
 
@@ -512,7 +619,7 @@ func (r *RuntimeT) CompileRulesPath(rulesPaths []utils.RulePathT, report *ux.Rep
 
 	runtime := r.getRuntimeCb(report)
 
-	if nodeObjs, configs, err = r.compileRulesPaths(runtime, rulesPaths); err != nil {
+	if nodeObjs, configs, err = r.compileRulesPaths(runtime, rulesPaths, report); err != nil {
 		return nil, err
 	}
 
@@ -524,11 +631,32 @@ func (r *RuntimeT) CompileRulesPath(rulesPaths []utils.RulePathT, report *ux.Rep
 		report.AddRules(rules)
 	}
 
+	if r.composed, err = composeOrder(configs); err != nil {
+		log.Error().Err(err).Msg("Failed to order composed rules")
+		return nil, err
+	}
+
+	if r.Bench {
+		r.regexes = newBenchRegexes(configs)
+	}
+
+	if r.Explain != "" {
+		if r.explain, err = newExplainer(configs, r.Explain); err != nil {
+			if reason, ok := report.Skipped[r.Explain]; ok {
+				err = fmt.Errorf("%w (%s)", err, reason)
+			}
+			return nil, err
+		}
+	}
+
 	if matchers, err = loadNodeObjs(nodeObjs); err != nil {
 		log.Error().Err(err).Msg("Failed to load node objects")
 		return nil, err
 	}
 
+	matchers.jq = jqRules(configs)
+	matchers.horizon = locateHorizon(configs)
+
 	return matchers, nil
 }
 
@@ -559,6 +687,14 @@ func (r *RuntimeT) LoadRulesPaths(rep *ux.ReportT, rulesPaths []utils.RulePathT)
 	return ruleMatchers, nil
 }
 
+// Explanation returns the trace of the rule selected with Explain, or nil if none.
+func (r *RuntimeT) Explanation() *ux.ExplainT {
+	if r.explain == nil {
+		return nil
+	}
+	return r.explain.explanation()
+}
+
 func (r *RuntimeT) Run(ctx context.Context, ruleMatchers *RuleMatchersT, sources []*LogData, report *ux.ReportT) error {
 
 	var (
@@ -567,6 +703,8 @@ func (r *RuntimeT) Run(ctx context.Context, ruleMatchers *RuleMatchersT, sources
 		err   error
 	)
 
+	r.coverage(ruleMatchers, sources, report)
+
 	err = r._run(ctx, &wg, sources, ruleMatchers, r.Stop, &lines)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to run input")
@@ -583,6 +721,11 @@ func (r *RuntimeT) Run(ctx context.Context, ruleMatchers *RuleMatchersT, sources
 
 	wg.Wait()
 
+	// Composed rules match the detections of the scan
+	if err = r.compose(ctx, ruleMatchers); err != nil {
+		log.Error().Err(err).Msg("Failed to run composed rules")
+	}
+
 	return err
 }
 
@@ -610,21 +753,59 @@ func (r *RuntimeT) _run(ctx context.Context, wg *sync.WaitGroup, sources []*LogD
 	return nil
 }
 
+// coverage records which rules have a data source of their type to run on.
+func (r *RuntimeT) coverage(matchers *RuleMatchersT, sources []*LogData, report *ux.ReportT) {
+
+	if matchers == nil || report == nil {
+		return
+	}
+
+	var types = make(map[string]struct{}, len(sources))
+	for _, ld := range sources {
+		types[ld.SrcType()] = struct{}{}
+	}
+
+	// Stdin matches every rule
+	_, all := types["*"]
+
+	for ruleId, pe := range matchers.eventSrc {
+		cre, err := r.getCre(matchers.hash[ruleId])
+		if err != nil {
+			log.Warn().Str("rule_id", ruleId).Msg("Failed to get CRE for coverage")
+			continue
+		}
+
+		_, ok := types[pe.Source]
+		report.AddEvaluated(cre.Id, pe.Source, all || ok || pe.Source == DetectionSource)
+	}
+}
+
 func (r *RuntimeT) _runSrc(ctx context.Context, wg *sync.WaitGroup, ld *LogData, matchers *RuleMatchersT, stop int64, lines *atomic.Int64) error {
 
 	type trioT struct {
 		matcher    matchCB
 		flusher    flushCB
 		compilerCb compiler.CallbackT
+		approx     bool
+		fields     bool // Match the extracted document rather than the line
+		explain    *explainerT
 	}
 
 	var (
-		srcType = ld.SrcType()
-		cbs     = make([]trioT, 0, len(matchers.eventSrc))
+		srcType   = ld.SrcType()
+		cbs       = make([]trioT, 0, len(matchers.eventSrc))
+		synthetic = ld.Synthetic()
+		fp        = ld.FieldParser()
+		extract   bool
 	)
 
 	for ruleId, pe := range matchers.eventSrc {
 
+		// Composed rules run on detections after the scan
+		if pe.Source == DetectionSource {
+			continue
+		}
+
 		if srcType != "*" && srcType != pe.Source {
 			continue
 		}
@@ -645,11 +826,21 @@ func (r *RuntimeT) _runSrc(ctx context.Context, wg *sync.WaitGroup, ld *LogData,
 		cb := _bindMatchCb(srcType, lm)
 		fb := _bindFlushCB(srcType, lm)
 
-		cbs = append(cbs, trioT{
+		trio := trioT{
 			matcher:    cb,
 			flusher:    fb,
 			compilerCb: matchers.cb[ruleId],
-		})
+			approx:     synthetic && isWindowed(lm),
+			fields:     fp != nil && matchers.jq[ruleId],
+		}
+
+		extract = extract || trio.fields
+
+		if r.explain != nil && r.explain.ruleId == ruleId {
+			trio.explain = r.explain
+		}
+
+		cbs = append(cbs, trio)
 	}
 
 	if len(cbs) == 0 {
@@ -671,16 +862,64 @@ func (r *RuntimeT) _runSrc(ctx context.Context, wg *sync.WaitGroup, ld *LogData,
 		tracker.UpdateTotal(total)
 	}
 
+	// Counts entries for explain traces, after multiline grouping and reordering
+	var line int64
+
+	// Explain traces name the line each entry starts on
+	var loc *locatorT
+	if r.Locate || r.explain != nil {
+		loc = newLocator(matchers.horizon)
+	}
+
+	explainPos := func() explainPosT {
+		pos := explainPosT{src: name, entry: line}
+		if file, n := loc.at(); n > 0 {
+			pos.line = n
+			if file != "" {
+				pos.src = file
+			}
+		}
+		return pos
+	}
+
 	scanCb := func(entry entry.LogEntry) bool {
 
 		// Use an atomic instead of calling tracker directly to decrease overhead.
 		lines.Add(1)
+		line++
+
+		if loc != nil {
+			loc.record(entry)
+		}
+
+		doc := entry
+		if extract {
+			doc.Line, _ = fp.Extract(entry.Line)
+		}
 
 		for _, trio := range cbs {
-			if msgHits := trio.matcher(entry); msgHits != nil {
+			e := entry
+			if trio.fields {
+				e = doc
+			}
+			if trio.explain != nil {
+				trio.explain.scan(explainPos(), e, entry.Line)
+			}
+			if msgHits := trio.matcher(e); msgHits != nil {
 				log.Info().
 					Interface("hits", msgHits).
 					Msg("Hits")
+				msgHits.Entity.Approximate = trio.approx
+				msgHits.Entity.Source = name
+				if trio.fields {
+					restoreRaw(msgHits)
+				}
+				if r.Locate {
+					loc.locate(msgHits)
+				}
+				if trio.explain != nil {
+					trio.explain.detect(explainPos(), msgHits)
+				}
 				trio.compilerCb(ctx, *msgHits)
 			}
 		}
@@ -694,6 +933,17 @@ func (r *RuntimeT) _runSrc(ctx context.Context, wg *sync.WaitGroup, ld *LogData,
 				log.Info().
 					Interface("hits", msgHits).
 					Msg("Hits on final flush")
+				msgHits.Entity.Approximate = trio.approx
+				msgHits.Entity.Source = name
+				if trio.fields {
+					restoreRaw(msgHits)
+				}
+				if r.Locate {
+					loc.locate(msgHits)
+				}
+				if trio.explain != nil {
+					trio.explain.detect(explainPosT{src: name}, msgHits)
+				}
 				trio.compilerCb(ctx, *msgHits)
 			}
 		}
@@ -704,7 +954,7 @@ func (r *RuntimeT) _runSrc(ctx context.Context, wg *sync.WaitGroup, ld *LogData,
 		defer wg.Done()
 
 		// Spin across the logs
-		_spinLogs(ld, scanCb, stop, tracker)
+		_spinLogs(ld, scanCb, stop, tracker, loc)
 
 		// Finally flush out any pending negative matches
 		finalFlush()
@@ -716,7 +966,7 @@ func (r *RuntimeT) _runSrc(ctx context.Context, wg *sync.WaitGroup, ld *LogData,
 	return nil
 }
 
-func _spinLogs(ld *LogData, scanF scanner.ScanFuncT, stop int64, tracker *progress.Tracker) {
+func _spinLogs(ld *LogData, scanF scanner.ScanFuncT, stop int64, tracker *progress.Tracker, loc *locatorT) {
 
 	for i, rd := range ld.Logs {
 
@@ -732,33 +982,100 @@ func _spinLogs(ld *LogData, scanF scanner.ScanFuncT, stop int64, tracker *progre
 			Int64("size", rd.Size()).
 			Msg("Scanning log")
 
-		opts := []scanner.ScanOptT{
-			scanner.WithStop(stop),
+		var (
+			opts = []scanner.ScanOptT{
+				scanner.WithStop(stop),
+			}
+			scanFn = scanF
+		)
+
+		// Entry transforms run last, right before the matchers
+		if ts := rd.Transforms(); len(ts) > 0 {
+			scanFn = transformScan(ts, scanFn)
 		}
 
-		if rd.Fold() {
-			opts = append(opts, scanner.WithFold(true))
+		if loc != nil {
+			loc.reset(rd.Name(), rd.Offset())
 		}
 
 		// If reorder is enabled, hook the middleware.
 		var reorder *scanner.ReorderT
 		if rd.Window() > 0 {
-			var err error
-			if reorder, err = scanner.NewReorder(rd.Window(), scanF, scanner.WithMemoryLimit(ramLimit)); err != nil {
+			var (
+				releaseFn = scanFn
+				err       error
+			)
+			if loc != nil {
+				releaseFn = loc.release(scanFn)
+			}
+			if reorder, err = scanner.NewReorder(rd.Window(), releaseFn, scanner.WithMemoryLimit(ramLimit)); err != nil {
 				log.Warn().Err(err).Msg("Fail to create reorder object. Continue...")
 			} else {
-				scanF = reorder.Append
+				scanFn = reorder.Append
+				if loc != nil {
+					scanFn = loc.hold(scanFn)
+				}
 			}
 		}
 
 		parser := rd.Parser()
+
+		// Multiline grouping replaces fold; lines are grouped before reordering.
+		// Parsers that follow format changes decide whether to fold line by line.
+		var (
+			group *groupT
+			fold  *foldT
+			outFn = scanFn
+		)
+		if loc != nil {
+			outFn = loc.groupOut(scanFn)
+		}
+		switch fp, ok := parser.(resolve.FoldParserI); {
+		case rd.Multiline() != nil:
+			group = newGroup(rd.Multiline(), outFn)
+			scanFn = group.Append
+			opts = append(opts, scanner.WithErrFunc(group.AppendErr))
+		case ok:
+			fold = newRedetectFold(fp, outFn)
+		case rd.Fold():
+			fold = newFold(rd.Fold, outFn)
+		default:
+			opts = append(opts, scanner.WithErrFunc(parseErr))
+		}
+
+		if fold != nil {
+			scanFn = fold.Append
+			opts = append(opts, scanner.WithErrFunc(fold.AppendErr))
+			if loc != nil {
+				fold.at = loc.back
+			}
+		}
+
+		parseFn := parser.ReadEntry
+		if loc != nil {
+			parseFn = loc.parse(parseFn)
+			if group != nil || fold != nil {
+				scanFn = loc.groupIn(scanFn)
+			} else {
+				scanFn = loc.head(scanFn)
+			}
+		}
+
 		err := scanner.ScanForward(
 			trdr,
-			parser.ReadEntry,
-			scanF,
+			parseFn,
+			scanFn,
 			opts...,
 		)
 
+		if err == nil && group != nil {
+			group.Flush()
+		}
+
+		if err == nil && fold != nil {
+			fold.Flush()
+		}
+
 		switch {
 		case err != nil:
 			log.Warn().
@@ -774,6 +1091,33 @@ func _spinLogs(ld *LogData, scanF scanner.ScanFuncT, stop int64, tracker *progre
 	}
 }
 
+func transformScan(ts resolve.TransformsT, scanF scanner.ScanFuncT) scanner.ScanFuncT {
+	return func(e entry.LogEntry) bool {
+		line, ok := ts.Apply(e.Line)
+		if !ok {
+			return false
+		}
+		e.Line = line
+		return scanF(e)
+	}
+}
+
+// Report the original lines rather than the extracted documents.
+func restoreRaw(hits *matchz.HitsT) {
+	for i := range hits.Entries {
+		hits.Entries[i].Entry = []byte(resolve.RawLine(string(hits.Entries[i].Entry)))
+	}
+}
+
+// Sequence windows are measured in time; synthetic timestamps only preserve line order.
+func isWindowed(m lm.Matcher) bool {
+	switch m.(type) {
+	case *lm.MatchSeq, *lm.InverseSeq:
+		return true
+	}
+	return false
+}
+
 type matchCB func(entry entry.LogEntry) *matchz.HitsT
 type flushCB func() *matchz.HitsT
 
@@ -838,6 +1182,9 @@ func (r *RuleMatchersT) DataSourceTemplate(currRulesVer *semver.Version) ([]byte
 	)
 
 	for _, value := range r.eventSrc {
+		if value.Source == DetectionSource {
+			continue
+		}
 		out.Sources = append(out.Sources, datasrc.Source{
 			Name: fmt.Sprintf("my-%s", value.Source),
 			Type: value.Source,
@@ -2,11 +2,26 @@ package engine
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/jedib0t/go-pretty/v6/progress"
+	"github.com/prequel-dev/preq/internal/pkg/config"
+	"github.com/prequel-dev/preq/internal/pkg/resolve"
+	"github.com/prequel-dev/preq/internal/pkg/utils"
 	"github.com/prequel-dev/preq/internal/pkg/ux"
 	"github.com/prequel-dev/prequel-compiler/pkg/compiler"
 	"github.com/prequel-dev/prequel-compiler/pkg/parser"
+	"github.com/prequel-dev/prequel-logmatch/pkg/entry"
+	"github.com/prequel-dev/prequel-logmatch/pkg/format"
 )
 
 func TestNew(t *testing.T) {
@@ -294,3 +309,1792 @@ func TestRuntimeT_Run(t *testing.T) {
 		}
 	})
 }
+
+func TestMultilineGroup(t *testing.T) {
+
+	newSpec := func(t *testing.T, spec resolve.MultilineT) *resolve.MultilineT {
+		t.Helper()
+		if err := spec.Compile(); err != nil {
+			t.Fatalf("Compile failed: %v", err)
+		}
+		return &spec
+	}
+
+	collect := func(spec *resolve.MultilineT) (*groupT, *[]string) {
+		var lines []string
+		g := newGroup(spec, func(e entry.LogEntry) bool {
+			lines = append(lines, e.Line)
+			return false
+		})
+		return g, &lines
+	}
+
+	t.Run("groups continuation lines", func(t *testing.T) {
+		g, lines := collect(newSpec(t, resolve.MultilineT{Continuation: `^\s+at |^Caused by:`}))
+
+		g.Append(entry.LogEntry{Timestamp: 1, Line: "java.lang.IllegalStateException: boom"})
+		g.Append(entry.LogEntry{Timestamp: 1, Line: "    at com.example.Foo.bar(Foo.java:10)"})
+		g.Append(entry.LogEntry{Timestamp: 1, Line: "Caused by: java.io.IOException: disk"})
+		g.Append(entry.LogEntry{Timestamp: 2, Line: "next entry"})
+		g.Flush()
+
+		if len(*lines) != 2 {
+			t.Fatalf("Expected 2 entries, got %d: %q", len(*lines), *lines)
+		}
+		want := "java.lang.IllegalStateException: boom\n    at com.example.Foo.bar(Foo.java:10)\nCaused by: java.io.IOException: disk"
+		if (*lines)[0] != want {
+			t.Errorf("Expected %q, got %q", want, (*lines)[0])
+		}
+	})
+
+	t.Run("unparsed lines are continuations", func(t *testing.T) {
+		g, lines := collect(newSpec(t, resolve.MultilineT{Start: `^\d{4}-`}))
+
+		g.Append(entry.LogEntry{Timestamp: 1, Line: "2025-01-01 panic: runtime error"})
+		g.AppendErr([]byte("goroutine 1 [running]:"), errors.New("no timestamp"))
+		g.Append(entry.LogEntry{Timestamp: 2, Line: "2025-01-01 ok"})
+		g.Flush()
+
+		if len(*lines) != 2 || (*lines)[0] != "2025-01-01 panic: runtime error\ngoroutine 1 [running]:" {
+			t.Fatalf("Unexpected entries: %q", *lines)
+		}
+	})
+
+	t.Run("max lines and timeout split groups", func(t *testing.T) {
+		g, lines := collect(newSpec(t, resolve.MultilineT{
+			Continuation: `^\s`,
+			MaxLines:     2,
+			Timeout:      time.Second,
+		}))
+
+		g.Append(entry.LogEntry{Timestamp: 0, Line: "a"})
+		g.Append(entry.LogEntry{Timestamp: 0, Line: " b"})
+		g.Append(entry.LogEntry{Timestamp: 0, Line: " c"})
+		g.Append(entry.LogEntry{Timestamp: int64(2 * time.Second), Line: " d"})
+		g.Flush()
+
+		if len(*lines) != 3 {
+			t.Fatalf("Expected 3 entries, got %d: %q", len(*lines), *lines)
+		}
+	})
+}
+
+type foldParserT struct {
+	fold bool
+}
+
+func (p *foldParserT) ReadTimestamp(io.Reader) (int64, error) { return 0, nil }
+
+func (p *foldParserT) ReadEntry([]byte) (format.LogEntry, error) { return format.LogEntry{}, nil }
+
+func (p *foldParserT) Fold() bool { return p.fold }
+
+func TestFoldFollowsParser(t *testing.T) {
+
+	var (
+		parser = &foldParserT{}
+		lines  []string
+		f      = newFold(parser.Fold, func(e entry.LogEntry) bool {
+			lines = append(lines, e.Line)
+			return false
+		})
+	)
+
+	// JSON lines that fail to parse are dropped
+	f.Append(entry.LogEntry{Timestamp: 1, Line: `{"log":"crashed"}`})
+	f.AppendErr([]byte("garbage"), errors.New("fail JSON unmarshal"))
+
+	// After switching to a text format, unparsed lines fold into the pending entry
+	parser.fold = true
+	f.Append(entry.LogEntry{Timestamp: 2, Line: "boom"})
+	f.AppendErr([]byte("Caused by: disk"), errors.New("no timestamp"))
+	f.Flush()
+
+	want := []string{`{"log":"crashed"}`, "boomCaused by: disk"}
+	if fmt.Sprint(lines) != fmt.Sprint(want) {
+		t.Errorf("Expected %q, got %q", want, lines)
+	}
+}
+
+func TestRedetectReparse(t *testing.T) {
+
+	data := strings.Join([]string{
+		`{"log":"previous container\n","stream":"stdout","time":"2025-01-01T00:00:01Z"}`,
+		`{"log":"crashed\n","stream":"stderr","time":"2025-01-01T00:00:02Z"}`,
+		`2025-01-01T00:01:00Z current container`,
+		`	at main.go:12`,
+		`2025-01-01T00:01:01Z starting`,
+		`2025-01-01T00:01:02Z listening`,
+	}, "\n") + "\n"
+
+	sources, err := resolve.PipeEval([]byte(data))
+	if err != nil {
+		t.Fatalf("PipeEval failed: %v", err)
+	}
+
+	var (
+		loc     = newLocator(math.MaxInt64)
+		entries []entry.LogEntry
+		lines   []int64
+	)
+
+	_spinLogs(sources[0], func(e entry.LogEntry) bool {
+		entries = append(entries, e)
+		lines = append(lines, loc.next)
+		return false
+	}, futureMark, &progress.Tracker{}, loc)
+
+	var stamps []string
+	for _, e := range entries {
+		stamps = append(stamps, time.Unix(0, e.Timestamp).UTC().Format(time.RFC3339))
+	}
+
+	// The lines read before the switch start entries of the new format
+	want := "[2025-01-01T00:00:01Z 2025-01-01T00:00:02Z 2025-01-01T00:01:00Z 2025-01-01T00:01:01Z 2025-01-01T00:01:02Z]"
+	if got := fmt.Sprint(stamps); got != want {
+		t.Fatalf("Expected entries %s, got %s", want, got)
+	}
+
+	if first := entries[2].Line; !strings.Contains(first, "current container") || !strings.Contains(first, "main.go:12") {
+		t.Errorf("Expected the first entry of the second segment with its continuation, got %q", first)
+	}
+	if strings.Contains(entries[1].Line, "current container") {
+		t.Errorf("Expected the new format's lines kept out of the last entry before the switch, got %q", entries[1].Line)
+	}
+
+	if got := fmt.Sprint(lines); got != "[1 2 3 5 6]" {
+		t.Errorf("Expected lines [1 2 3 5 6], got %s", got)
+	}
+}
+
+func TestSyntheticTimestamps(t *testing.T) {
+	rules := `
+rules:
+  - cre:
+      id: synthetic-set
+    metadata:
+      id: 7dNmLxkQ2vRz3pYw8sTa1b
+      hash: 4hJkPqRs9tUvWx2yZa3bCd
+    rule:
+      set:
+        event:
+          source: cre.log.test
+        match:
+          - value: "disk full"
+  - cre:
+      id: synthetic-seq
+    metadata:
+      id: 9fGhJkLm2nPq4rSt6vWx8y
+      hash: 2aBcDeFg4hIjKlMn6oPqRs
+    rule:
+      sequence:
+        event:
+          source: cre.log.test
+        window: 1s
+        order:
+          - value: "starting job"
+          - value: "disk full"
+`
+	data := "starting job\nwriting output\ndisk full\n"
+
+	sources, err := resolve.PipeEval([]byte(data), resolve.WithSynthetic("line"))
+	if err != nil {
+		t.Fatalf("PipeEval failed: %v", err)
+	}
+	if !sources[0].Synthetic() {
+		t.Fatal("Expected synthetic source")
+	}
+
+	var (
+		runtime = New(0, ux.NewUxEval())
+		report  = ux.NewReport(nil)
+	)
+	runtime.Stop = futureMark
+
+	matchers, err := runtime.CompileRules([]byte(rules), report)
+	if err != nil {
+		t.Fatalf("CompileRules failed: %v", err)
+	}
+
+	if err := runtime.Run(context.Background(), matchers, sources, report); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	doc, err := report.CreateReport()
+	if err != nil {
+		t.Fatalf("CreateReport failed: %v", err)
+	}
+
+	approx := make(map[string]bool)
+	for _, o := range doc {
+		approx[o["id"].(string)] = o["approximate"] == true
+	}
+
+	if len(approx) != 2 {
+		t.Fatalf("Expected 2 detections, got %d", len(approx))
+	}
+	if approx["synthetic-set"] {
+		t.Error("Set rule should not be approximate")
+	}
+	if !approx["synthetic-seq"] {
+		t.Error("Sequence rule should be approximate")
+	}
+}
+
+func TestFieldExtraction(t *testing.T) {
+	rules := `
+rules:
+  - cre:
+      id: logfmt-jq
+    metadata:
+      id: 5qWeRtYu7iOpAs9dFgHj2k
+      hash: 8zXcVbNm3qWeRt5yUiOp7a
+    rule:
+      set:
+        event:
+          source: cre.log.test
+        match:
+          - jq: '.level == "error" and .component == "db"'
+`
+	data := strings.Join([]string{
+		`2025-01-01T00:00:01Z level=info component=db msg="connected"`,
+		`2025-01-01T00:00:02Z level=error component=api msg="timeout"`,
+		`2025-01-01T00:00:03Z level=error component=db msg="connection reset"`,
+	}, "\n") + "\n"
+
+	fp := &resolve.FieldParserT{Type: resolve.FieldParserLogfmt}
+	if err := fp.Compile(); err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	sources, err := resolve.PipeEval([]byte(data), resolve.WithFieldParser(fp))
+	if err != nil {
+		t.Fatalf("PipeEval failed: %v", err)
+	}
+
+	var (
+		runtime = New(futureMark, ux.NewUxEval())
+		report  = ux.NewReport(nil)
+	)
+
+	matchers, err := runtime.CompileRules([]byte(rules), report)
+	if err != nil {
+		t.Fatalf("CompileRules failed: %v", err)
+	}
+
+	if err := runtime.Run(context.Background(), matchers, sources, report); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	hits := report.Hits["logfmt-jq"]
+	if len(hits) != 1 {
+		t.Fatalf("Expected 1 detection, got %d", len(hits))
+	}
+
+	for _, m := range hits {
+		if got := string(m.Entries[0].Entry); got != `level=error component=db msg="connection reset"` {
+			t.Errorf("Expected original line in report, got %q", got)
+		}
+	}
+}
+
+func TestStdinTransforms(t *testing.T) {
+	rules := `
+rules:
+  - cre:
+      id: stdin-ansi
+    metadata:
+      id: 3kLmNpQr5sTuVw7xYzAb9c
+      hash: 6dEfGhJk8mNpQr2sTuVw4x
+    rule:
+      set:
+        event:
+          source: cre.log.test
+        match:
+          - value: "ERROR disk full"
+`
+	data := strings.Join([]string{
+		"\x1b[2m2025-01-01T00:00:01Z\x1b[0m \x1b[32mINFO\x1b[0m starting",
+		"\x1b[2m2025-01-01T00:00:02Z\x1b[0m \x1b[1;31mERROR\x1b[0m disk full",
+	}, "\n") + "\n"
+
+	pipe := func(t *testing.T, cfg string) ([]*resolve.LogData, error) {
+
+		c, err := config.LoadConfigFromBytes(cfg)
+		if err != nil {
+			t.Fatalf("LoadConfigFromBytes failed: %v", err)
+		}
+
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("Pipe failed: %v", err)
+		}
+
+		// The pipe is read until the run ends
+		stdin := os.Stdin
+		os.Stdin = r
+		t.Cleanup(func() {
+			os.Stdin = stdin
+			r.Close()
+		})
+
+		go func() {
+			w.WriteString(data)
+			w.Close()
+		}()
+
+		return resolve.PipeStdin(c.StdinOpts()...)
+	}
+
+	t.Run("Config transforms apply to stdin", func(t *testing.T) {
+		sources, err := pipe(t, "transforms:\n  - type: ansi\n")
+		if err != nil {
+			t.Fatalf("PipeStdin failed: %v", err)
+		}
+
+		var (
+			runtime = New(futureMark, ux.NewUxEval())
+			report  = ux.NewReport(nil)
+		)
+
+		matchers, err := runtime.CompileRules([]byte(rules), report)
+		if err != nil {
+			t.Fatalf("CompileRules failed: %v", err)
+		}
+
+		if err := runtime.Run(context.Background(), matchers, sources, report); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+
+		if n := len(report.Hits["stdin-ansi"]); n != 1 {
+			t.Errorf("Expected 1 detection, got %d", n)
+		}
+	})
+
+	t.Run("Colour codes hide the timestamps without them", func(t *testing.T) {
+		if _, err := pipe(t, "window: 1s\n"); err == nil {
+			t.Error("Expected format detection to fail")
+		}
+	})
+}
+
+func TestFieldExtractionRawTerms(t *testing.T) {
+	data := strings.Join([]string{
+		`2025-01-01T00:00:01Z level=info component=db msg="connected"`,
+		`2025-01-01T00:00:02Z level=error component=api msg="timeout"`,
+		`2025-01-01T00:00:03Z level=error component=db msg="connection \"main\" reset"`,
+	}, "\n") + "\n"
+
+	tests := []struct {
+		name  string
+		match string
+		want  string
+	}{
+		{
+			name: "Anchored regex",
+			match: `        match:
+          - regex: '^level=error component=db'`,
+			want: `level=error component=db msg="connection \"main\" reset"`,
+		},
+		{
+			name: "Quoted raw",
+			match: `        match:
+          - 'msg="connection \"main\"'`,
+			want: `level=error component=db msg="connection \"main\" reset"`,
+		},
+		{
+			name: "Mixed with jq",
+			match: `        window: 1s
+        match:
+          - jq: '.level == "error"'
+          - regex: '^level=\w+ component=api'`,
+			want: `level=error component=api msg="timeout"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rules := `
+rules:
+  - cre:
+      id: fields-raw
+    metadata:
+      id: 3rTyUiOp5aSdFgHj7kLzXc
+      hash: 9vBnMqWe2rTyUiOp4aSdFg
+    rule:
+      set:
+        event:
+          source: cre.log.test
+` + tc.match + "\n"
+
+			fp := &resolve.FieldParserT{Type: resolve.FieldParserLogfmt}
+			if err := fp.Compile(); err != nil {
+				t.Fatalf("Compile failed: %v", err)
+			}
+
+			sources, err := resolve.PipeEval([]byte(data), resolve.WithFieldParser(fp))
+			if err != nil {
+				t.Fatalf("PipeEval failed: %v", err)
+			}
+
+			var (
+				runtime = New(futureMark, ux.NewUxEval())
+				report  = ux.NewReport(nil)
+			)
+
+			runtime.Extracted = ExtractedTypes(sources)
+
+			matchers, err := runtime.CompileRules([]byte(rules), report)
+			if err != nil {
+				t.Fatalf("CompileRules failed: %v", err)
+			}
+
+			if err := runtime.Run(context.Background(), matchers, sources, report); err != nil {
+				t.Fatalf("Run failed: %v", err)
+			}
+
+			hits := report.Hits["fields-raw"]
+			if len(hits) != 1 {
+				t.Fatalf("Expected 1 detection, got %d", len(hits))
+			}
+
+			for _, m := range hits {
+				for _, e := range m.Entries {
+					if got := string(e.Entry); got != tc.want {
+						t.Errorf("Expected original line in report, got %q", got)
+					}
+				}
+			}
+		})
+	}
+}
+
+const lintRuleFmt = `rules:
+  - cre:
+      id: %s
+      severity: 1
+      title: Test
+      category: test
+      description: Test rule
+    metadata:
+      id: %s
+      hash: %s
+    rule:
+%s`
+
+const lintSet = `      set:
+        event:
+          source: cre.log.test
+        match:
+          - regex: "panic: (.+)"
+`
+
+const mergeTerms = `terms:
+  oom:
+    set:
+      event:
+        source: cre.log.test
+        origin: true
+      match:
+        - regex: "out of memory"
+  killed:
+    set:
+      event:
+        source: cre.log.test
+      match:
+        - regex: "killed process"
+`
+
+const mergeUse = `      set:
+        window: 10s
+        match:
+          - oom
+          - killed
+`
+
+func TestLint(t *testing.T) {
+
+	dir := t.TempDir()
+
+	write := func(t *testing.T, name, data string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	rule := func(cre, id, hash, body string) string {
+		return fmt.Sprintf(lintRuleFmt, cre, id, hash, body)
+	}
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		line    int
+		col     int
+		message string
+	}{
+		{
+			name:  "valid",
+			files: map[string]string{"ok.yaml": rule("CRE-2025-0001", "Xk9aPqRt5uVw", "Ht7bQsMn4jKp", lintSet)},
+		},
+		{
+			name: "yaml error",
+			files: map[string]string{"bad.yaml": `rules:
+  - cre: [
+`},
+			line:    2,
+			message: "did not find expected node content",
+		},
+		{
+			name:    "bad regex",
+			files:   map[string]string{"regex.yaml": rule("CRE-2025-0001", "Xk9aPqRt5uVw", "Ht7bQsMn4jKp", strings.Replace(lintSet, "(.+)", "((", 1))},
+			line:    16,
+			col:     20,
+			message: "missing closing )",
+		},
+		{
+			name:    "unknown term",
+			files:   map[string]string{"term.yaml": rule("CRE-2025-0001", "Xk9aPqRt5uVw", "Ht7bQsMn4jKp", strings.Replace(lintSet, `regex: "panic: (.+)"`, "term: nope", 1))},
+			line:    16,
+			col:     11,
+			message: "term not found",
+		},
+		{
+			name: "invalid window",
+			files: map[string]string{"window.yaml": rule("CRE-2025-0001", "Xk9aPqRt5uVw", "Ht7bQsMn4jKp", `      sequence:
+        window: 10q
+        event:
+          source: cre.log.test
+        order:
+          - "a"
+          - "b"
+`)},
+			line:    13,
+			col:     9,
+			message: "invalid 'window'",
+		},
+		{
+			name:    "missing title",
+			files:   map[string]string{"title.yaml": strings.Replace(rule("CRE-2025-0001", "Xk9aPqRt5uVw", "Ht7bQsMn4jKp", lintSet), "      title: Test\n", "", 1)},
+			line:    3,
+			col:     7,
+			message: "missing cre title",
+		},
+		{
+			name: "duplicate across files",
+			files: map[string]string{
+				"a.yaml": rule("CRE-2025-0001", "Xk9aPqRt5uVw", "Ht7bQsMn4jKp", lintSet),
+				"b.yaml": rule("CRE-2025-0002", "Xk9aPqRt5uVw", "Jm3cRtNp8wQz", lintSet),
+			},
+			line:    2,
+			col:     5,
+			message: "duplicate rule id Xk9aPqRt5uVw",
+		},
+		{
+			name: "multi-doc section",
+			files: map[string]string{"package.yaml": "section: version\nversion: 0.3.0\n---\nsection: rules\n" +
+				rule("CRE-2025-0001", "Xk9aPqRt5uVw", "", lintSet)},
+			line:    16,
+			col:     7,
+			message: "missing rule hash",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var paths []string
+			for _, name := range []string{"ok.yaml", "bad.yaml", "regex.yaml", "term.yaml", "window.yaml", "title.yaml", "a.yaml", "b.yaml", "package.yaml"} {
+				if data, ok := tt.files[name]; ok {
+					paths = append(paths, write(t, name, data))
+				}
+			}
+
+			problems := LintRulesPaths(paths)
+
+			if tt.message == "" {
+				if len(problems) != 0 {
+					t.Fatalf("Expected no problems, got %v", problems)
+				}
+				return
+			}
+
+			if len(problems) != 1 {
+				t.Fatalf("Expected 1 problem, got %v", problems)
+			}
+
+			p := problems[0]
+			if !strings.Contains(p.Message, tt.message) {
+				t.Errorf("Expected message %q, got %q", tt.message, p.Message)
+			}
+			if p.Line != tt.line || (tt.col != 0 && p.Column != tt.col) {
+				t.Errorf("Expected %d:%d, got %d:%d", tt.line, tt.col, p.Line, p.Column)
+			}
+			if p.File != paths[len(paths)-1] {
+				t.Errorf("Expected file %s, got %s", paths[len(paths)-1], p.File)
+			}
+		})
+	}
+}
+
+func TestDuplicateRulesAcrossFiles(t *testing.T) {
+
+	var (
+		dir = t.TempDir()
+		a   = filepath.Join(dir, "a.yaml")
+		b   = filepath.Join(dir, "b.yaml")
+	)
+
+	if err := os.WriteFile(a, []byte(fmt.Sprintf(lintRuleFmt, "CRE-2025-0001", "Xk9aPqRt5uVw", "Ht7bQsMn4jKp", lintSet)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(b, []byte(fmt.Sprintf(lintRuleFmt, "CRE-2025-0001", "Jm3cRtNp8wQz", "Pq5dStUv6xYz", lintSet)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := New(0, ux.NewUxEval())
+	defer r.Close()
+
+	paths := []utils.RulePathT{
+		{Path: a, Type: utils.RuleTypeUser},
+		{Path: b, Type: utils.RuleTypeUser},
+	}
+
+	_, err := r.LoadRulesPaths(ux.NewReport(nil), paths)
+	if err == nil {
+		t.Fatal("Expected duplicate error")
+	}
+
+	if !strings.Contains(err.Error(), a) || !strings.Contains(err.Error(), b) {
+		t.Errorf("Expected error to name %s and %s, got %v", a, b, err)
+	}
+}
+
+func TestVerifiedRulesData(t *testing.T) {
+
+	var (
+		dir      = t.TempDir()
+		path     = filepath.Join(dir, "rules.yaml")
+		verified = fmt.Sprintf(lintRuleFmt, "CRE-2025-0001", "Xk9aPqRt5uVw", "Ht7bQsMn4jKp", lintSet)
+		replaced = fmt.Sprintf(lintRuleFmt, "CRE-2025-0002", "Jm3cRtNp8wQz", "Pq5dStUv6xYz", lintSet)
+	)
+
+	// The file is replaced after its contents were verified
+	if err := os.WriteFile(path, []byte(replaced), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := New(0, ux.NewUxEval())
+	defer r.Close()
+
+	report := ux.NewReport(nil)
+
+	if _, err := r.LoadRulesPaths(report, []utils.RulePathT{{Path: path, Type: utils.RuleTypeUser, Data: []byte(verified)}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, ok := report.Rules["CRE-2025-0001"]; !ok {
+		t.Error("Expected the verified rule to be loaded")
+	}
+	if _, ok := report.Rules["CRE-2025-0002"]; ok {
+		t.Error("Expected the replaced file to be ignored")
+	}
+}
+
+func TestRuleFilter(t *testing.T) {
+
+	var (
+		dir  = t.TempDir()
+		path = filepath.Join(dir, "rules.yaml")
+		data = fmt.Sprintf(lintRuleFmt, "CRE-2025-0001", "Xk9aPqRt5uVw", "Ht7bQsMn4jKp", lintSet) +
+			strings.TrimPrefix(fmt.Sprintf(lintRuleFmt, "CRE-2025-0002", "Jm3cRtNp8wQz", "Pq5dStUv6xYz", lintSet), "rules:\n")
+	)
+
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := New(0, ux.NewUxEval())
+	defer r.Close()
+
+	r.Filter = &utils.RuleFilterT{Exclude: utils.RuleMatchT{Ids: []string{"CRE-2025-0001"}}}
+
+	report := ux.NewReport(nil)
+
+	if _, err := r.LoadRulesPaths(report, []utils.RulePathT{{Path: path, Type: utils.RuleTypeUser}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if _, ok := report.Rules["CRE-2025-0001"]; ok {
+		t.Error("Expected CRE-2025-0001 to be skipped")
+	}
+	if _, ok := report.Rules["CRE-2025-0002"]; !ok {
+		t.Error("Expected CRE-2025-0002 to be loaded")
+	}
+	if reason := report.Skipped["CRE-2025-0001"]; reason != "excluded by id CRE-2025-0001" {
+		t.Errorf("Expected skip reason, got %q", reason)
+	}
+
+	want := map[string]string{"CRE-2025-0001": "excluded by id CRE-2025-0001"}
+
+	t.Run("Report", func(t *testing.T) {
+		doc, err := report.CreateReport()
+		if err != nil {
+			t.Fatalf("CreateReport failed: %v", err)
+		}
+		if len(doc) != 0 {
+			t.Errorf("Expected no detections, got %d", len(doc))
+		}
+	})
+
+	t.Run("Summary", func(t *testing.T) {
+		fn, err := ux.WriteSummary(report.Summary(), filepath.Join(dir, "report.summary.json"))
+		if err != nil {
+			t.Fatalf("WriteSummary failed: %v", err)
+		}
+
+		data, err := os.ReadFile(fn)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+
+		var summary ux.SummaryT
+		if err := json.Unmarshal(data, &summary); err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+		if fmt.Sprint(summary.Skipped) != fmt.Sprint(want) {
+			t.Errorf("Expected skipped %v, got %v", want, summary.Skipped)
+		}
+	})
+
+	t.Run("Sarif", func(t *testing.T) {
+		fn, err := report.WriteSarif(filepath.Join(dir, "report.sarif"))
+		if err != nil {
+			t.Fatalf("WriteSarif failed: %v", err)
+		}
+
+		data, err := os.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var sarif struct {
+			Runs []struct {
+				Properties struct {
+					Skipped map[string]string `json:"skipped"`
+				} `json:"properties"`
+			} `json:"runs"`
+		}
+		if err := json.Unmarshal(data, &sarif); err != nil {
+			t.Fatalf("Invalid SARIF: %v", err)
+		}
+
+		if len(sarif.Runs) != 1 || fmt.Sprint(sarif.Runs[0].Properties.Skipped) != fmt.Sprint(want) {
+			t.Errorf("Expected skipped %v in run properties, got %s", want, data)
+		}
+	})
+}
+
+func TestOverrides(t *testing.T) {
+
+	var (
+		dir  = t.TempDir()
+		path = filepath.Join(dir, "rules.yaml")
+		data = fmt.Sprintf(lintRuleFmt, "CRE-2025-0001", "Xk9aPqRt5uVw", "Ht7bQsMn4jKp", lintSet) +
+			strings.TrimPrefix(fmt.Sprintf(lintRuleFmt, "CRE-2025-0002", "Jm3cRtNp8wQz", "Pq5dStUv6xYz", lintSet), "rules:\n")
+	)
+
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := New(0, ux.NewUxEval())
+	defer r.Close()
+
+	r.Overrides = utils.OverridesT{
+		"CRE-2025-0001": {Disabled: true},
+		"CRE-2025-0002": {Severity: "info", Tags: []string{"noisy"}},
+	}
+
+	// Overrides apply before the filter, so the lowered severity is filtered out
+	r.Filter = &utils.RuleFilterT{Severity: "low"}
+
+	report := ux.NewReport(nil)
+
+	if _, err := r.LoadRulesPaths(report, []utils.RulePathT{{Path: path, Type: utils.RuleTypeUser}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if reason := report.Skipped["CRE-2025-0001"]; reason != reasonOverride {
+		t.Errorf("Expected CRE-2025-0001 disabled by override, got %q", reason)
+	}
+	if reason := report.Skipped["CRE-2025-0002"]; reason != "severity 4 below low" {
+		t.Errorf("Expected CRE-2025-0002 filtered by overridden severity, got %q", reason)
+	}
+	if changes := report.Overrides["CRE-2025-0002"]; strings.Join(changes, ";") != "severity 1 -> 4;tags +noisy" {
+		t.Errorf("Expected override changes recorded, got %v", changes)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	rules := `
+rules:
+  - cre:
+      id: explain-seq
+    metadata:
+      id: 5bNcMdLe2fKg3hJi4kHl6m
+      hash: 8nPoQrSt2uVw3xYz4aBc5d
+    rule:
+      sequence:
+        event:
+          source: cre.log.test
+        window: 10s
+        order:
+          - value: "starting job"
+          - value: "disk full"
+        negate:
+          - value: "job cancelled"
+`
+	data := `2025-01-01T00:00:00Z starting job
+2025-01-01T00:00:01Z job cancelled
+2025-01-01T00:00:02Z disk full
+2025-01-01T00:00:03Z starting job
+2025-01-01T00:00:30Z disk full
+2025-01-01T00:00:31Z starting job
+2025-01-01T00:00:32Z disk full
+`
+
+	sources, err := resolve.PipeEval([]byte(data))
+	if err != nil {
+		t.Fatalf("PipeEval failed: %v", err)
+	}
+
+	t.Run("traces terms, negates and windows", func(t *testing.T) {
+		var (
+			runtime = New(futureMark, ux.NewUxEval())
+			report  = ux.NewReport(nil)
+		)
+		runtime.Explain = "explain-seq"
+
+		matchers, err := runtime.CompileRules([]byte(rules), report)
+		if err != nil {
+			t.Fatalf("CompileRules failed: %v", err)
+		}
+
+		if err := runtime.Run(context.Background(), matchers, sources, report); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+
+		e := runtime.Explanation()
+		if e == nil {
+			t.Fatal("Expected an explanation")
+		}
+
+		if e.Type != "sequence" || e.Window != "10s" || len(e.Terms) != 2 || len(e.Negate) != 1 {
+			t.Errorf("Unexpected rule description: %+v", e)
+		}
+		if e.Entries != 7 {
+			t.Errorf("Expected 7 entries, got %d", e.Entries)
+		}
+		if e.Detections != 1 {
+			t.Errorf("Expected 1 detection, got %d", e.Detections)
+		}
+
+		var kinds []string
+		for _, ev := range e.Events {
+			if ev.Kind != ux.ExplainDetect {
+				kinds = append(kinds, fmt.Sprintf("%d:%s", ev.Line, ev.Kind))
+			}
+		}
+
+		want := "1:progress 2:negate 3:match 4:progress 5:expire 5:match 6:progress 7:progress 7:complete"
+		if got := strings.Join(kinds, " "); got != want {
+			t.Errorf("Expected events %q, got %q", want, got)
+		}
+
+		if e.Mismatches != 0 {
+			t.Errorf("Expected the trace to agree with the matcher, got %d mismatches: %v", e.Mismatches, e.Notes)
+		}
+	})
+
+	explain := func(t *testing.T, rules, data, creId string) *ux.ExplainT {
+		t.Helper()
+
+		var (
+			runtime = New(futureMark, ux.NewUxEval())
+			report  = ux.NewReport(nil)
+		)
+		runtime.Explain = creId
+
+		sources, err := resolve.PipeEval([]byte(data))
+		if err != nil {
+			t.Fatalf("PipeEval failed: %v", err)
+		}
+
+		matchers, err := runtime.CompileRules([]byte(rules), report)
+		if err != nil {
+			t.Fatalf("CompileRules failed: %v", err)
+		}
+
+		if err := runtime.Run(context.Background(), matchers, sources, report); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+
+		e := runtime.Explanation()
+		if e == nil {
+			t.Fatal("Expected an explanation")
+		}
+
+		return e
+	}
+
+	events := func(e *ux.ExplainT) string {
+		var kinds []string
+		for _, ev := range e.Events {
+			if ev.Kind != ux.ExplainDetect {
+				kinds = append(kinds, fmt.Sprintf("%d:%s", ev.Line, ev.Kind))
+			}
+		}
+		return strings.Join(kinds, " ")
+	}
+
+	t.Run("terms with a count advance once it is reached", func(t *testing.T) {
+		var (
+			rules = `
+rules:
+  - cre:
+      id: explain-count
+    metadata:
+      id: 7cQdReSf3gTh4iUj5kVl6m
+      hash: 9oPqRsTu3vWx4yZa5bCd6e
+    rule:
+      sequence:
+        event:
+          source: cre.log.test
+        window: 10s
+        order:
+          - value: "retrying"
+            count: 2
+          - value: "gave up"
+`
+			data = `2025-01-01T00:00:00Z retrying
+2025-01-01T00:00:01Z gave up
+2025-01-01T00:00:02Z retrying
+2025-01-01T00:00:03Z gave up
+`
+		)
+
+		e := explain(t, rules, data, "explain-count")
+
+		if e.Detections != 1 {
+			t.Errorf("Expected 1 detection, got %d", e.Detections)
+		}
+
+		want := "1:progress 2:match 3:progress 4:progress 4:complete"
+		if got := events(e); got != want {
+			t.Errorf("Expected events %q, got %q", want, got)
+		}
+
+		if e.Mismatches != 0 {
+			t.Errorf("Expected the trace to agree with the matcher, got %d mismatches: %v", e.Mismatches, e.Notes)
+		}
+	})
+
+	t.Run("lines are those of the file", func(t *testing.T) {
+		var (
+			rules = `
+rules:
+  - cre:
+      id: explain-lines
+    metadata:
+      id: 3dRfSgTh4iUj5kVl6mWn7o
+      hash: 4pQrStUv5wXy6zAb7cDe8f
+    rule:
+      sequence:
+        event:
+          source: cre.log.test
+        window: 10s
+        order:
+          - value: "starting job"
+          - value: "disk full"
+`
+			data = `2025-01-01T00:00:00Z starting job
+  at worker.go:12
+  at main.go:40
+2025-01-01T00:00:01Z disk full
+`
+		)
+
+		e := explain(t, rules, data, "explain-lines")
+
+		if e.Entries != 2 {
+			t.Errorf("Expected 2 entries, got %d", e.Entries)
+		}
+
+		want := "1:progress 4:progress 4:complete"
+		if got := events(e); got != want {
+			t.Errorf("Expected events %q, got %q", want, got)
+		}
+
+		if ev := e.Events[1]; ev.Index != 2 {
+			t.Errorf("Expected the second entry, got %d", ev.Index)
+		}
+	})
+
+	t.Run("flags disagreement with the matcher", func(t *testing.T) {
+		// The trace ignores the window options of negate terms, so it misses the completion
+		var (
+			rules = `
+rules:
+  - cre:
+      id: explain-negate
+    metadata:
+      id: 7cQdReSf3gTh4iUj5kVl6m
+      hash: 9oPqRsTu3vWx4yZa5bCd6e
+    rule:
+      sequence:
+        event:
+          source: cre.log.test
+        window: 10s
+        order:
+          - value: "starting job"
+          - value: "disk full"
+        negate:
+          - value: "job cancelled"
+            slide: 10s
+`
+			data = `2025-01-01T00:00:00Z starting job
+2025-01-01T00:00:05Z job cancelled
+2025-01-01T00:00:06Z disk full
+`
+		)
+
+		e := explain(t, rules, data, "explain-negate")
+
+		var mismatch bool
+		for _, ev := range e.Events {
+			mismatch = mismatch || ev.Kind == ux.ExplainMismatch
+		}
+
+		if !mismatch || e.Mismatches == 0 || len(e.Notes) == 0 {
+			t.Errorf("Expected the disagreement to be flagged, got %d mismatches, notes %v, events %q", e.Mismatches, e.Notes, events(e))
+		}
+	})
+
+	t.Run("unknown cre", func(t *testing.T) {
+		runtime := New(futureMark, ux.NewUxEval())
+		runtime.Explain = "CRE-0000-0000"
+
+		if _, err := runtime.CompileRules([]byte(rules), ux.NewReport(nil)); !errors.Is(err, ErrExplainNotFound) {
+			t.Errorf("Expected ErrExplainNotFound, got %v", err)
+		}
+	})
+}
+
+func TestCoverage(t *testing.T) {
+	rules := `
+rules:
+  - cre:
+      id: coverage-test
+    metadata:
+      id: 3kLmNpQr5sTu7vWx9yZa2b
+      hash: 6cDeFgHj8kLm2nPq4rSt6u
+    rule:
+      set:
+        event:
+          source: cre.log.test
+        match:
+          - value: "disk full"
+  - cre:
+      id: coverage-kafka
+    metadata:
+      id: 4dEfGhJk6mNp8qRs2tUv4w
+      hash: 7xYzAbCd9eFg3hJk5mNp7q
+    rule:
+      set:
+        event:
+          source: cre.log.kafka
+        match:
+          - value: "broker down"
+`
+
+	run := func(t *testing.T, srcType string) *ux.ReportT {
+		src, err := resolve.PipeEvalSource("test", srcType, [][]byte{[]byte("2025-01-01T00:00:00Z disk full\n")})
+		if err != nil {
+			t.Fatalf("PipeEvalSource failed: %v", err)
+		}
+
+		var (
+			runtime = New(futureMark, ux.NewUxEval())
+			report  = ux.NewReport(nil)
+		)
+
+		matchers, err := runtime.CompileRules([]byte(rules), report)
+		if err != nil {
+			t.Fatalf("CompileRules failed: %v", err)
+		}
+
+		if err := runtime.Run(context.Background(), matchers, []*LogData{src}, report); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+
+		return report
+	}
+
+	t.Run("rules without a source are not evaluated", func(t *testing.T) {
+		got := fmt.Sprintf("%+v", run(t, "cre.log.test").Coverage())
+		want := "[{Source:cre.log.kafka Rules:1 Evaluated:0 Percent:0 Unevaluated:[coverage-kafka]} {Source:cre.log.test Rules:1 Evaluated:1 Percent:100 Unevaluated:[]}]"
+		if got != want {
+			t.Errorf("Expected coverage %s, got %s", want, got)
+		}
+	})
+
+	t.Run("any source type covers every rule", func(t *testing.T) {
+		for _, c := range run(t, "*").Coverage() {
+			if c.Percent != 100 {
+				t.Errorf("Expected full coverage of %s, got %+v", c.Source, c)
+			}
+		}
+	})
+
+	t.Run("coverage is kept out of the report", func(t *testing.T) {
+		report := run(t, "cre.log.test")
+
+		doc, err := report.CreateReport()
+		if err != nil {
+			t.Fatalf("CreateReport failed: %v", err)
+		}
+
+		if len(doc) != 1 || doc[0]["cre"] == nil {
+			t.Fatalf("Expected the detection only, got %v", doc)
+		}
+
+		got := fmt.Sprintf("%+v", report.Summary().Coverage)
+		if want := fmt.Sprintf("%+v", report.Coverage()); got != want {
+			t.Errorf("Expected coverage %s in summary, got %s", want, got)
+		}
+	})
+}
+
+func TestBench(t *testing.T) {
+	rules := `
+rules:
+  - cre:
+      id: bench-fast
+    metadata:
+      id: 6eFgHjKm8nPq2rSt4uVw6x
+      hash: 9yZaBcDe3fGh5jKm7nPq9r
+    rule:
+      set:
+        event:
+          source: cre.log.test
+        match:
+          - value: "disk full"
+  - cre:
+      id: bench-slow
+    metadata:
+      id: 2sTuVwXy4zAb6cDe8fGh2j
+      hash: 5kLmNpQr7sTu9vWx3yZa5b
+    rule:
+      sequence:
+        event:
+          source: cre.log.test
+        window: 10s
+        order:
+          - regex: "(a+)+b"
+          - regex: "\\d{1,3}(?:\\.\\d{1,3}){3}"
+`
+	data := `2025-01-01T00:00:00Z disk full
+2025-01-01T00:00:01Z aab retry
+2025-01-01T00:00:02Z disk ok from 10.0.0.1
+2025-01-01T00:00:03Z disk full
+`
+
+	bench := func(t *testing.T, srcType string, lineTime time.Duration) map[string]ux.BenchT {
+		runtime := New(futureMark, ux.NewUxEval())
+		runtime.Bench = true
+
+		matchers, err := runtime.CompileRules([]byte(rules), ux.NewReport(nil))
+		if err != nil {
+			t.Fatalf("CompileRules failed: %v", err)
+		}
+
+		sourcesF := func() ([]*LogData, error) {
+			ld, err := resolve.PipeEvalSource("test", srcType, [][]byte{[]byte(data)})
+			if err != nil {
+				return nil, err
+			}
+			return []*LogData{ld}, nil
+		}
+
+		rows, err := runtime.RunBench(context.Background(), matchers, sourcesF, lineTime)
+		if err != nil {
+			t.Fatalf("RunBench failed: %v", err)
+		}
+
+		out := make(map[string]ux.BenchT, len(rows))
+		for _, row := range rows {
+			out[row.CreId] = row
+		}
+		return out
+	}
+
+	t.Run("measures each rule and flags pathological regexes", func(t *testing.T) {
+		rows := bench(t, "cre.log.test", time.Second)
+
+		fast := rows["bench-fast"]
+		if fast.Lines != 4 || fast.Hits != 2 || fast.MatchTime <= 0 || fast.LinesPerSec <= 0 {
+			t.Errorf("Unexpected measurements: %+v", fast)
+		}
+		if fast.Pathological() {
+			t.Errorf("Expected bench-fast not to be flagged: %v", fast.Slow)
+		}
+
+		slow := rows["bench-slow"]
+		if slow.Lines != 4 || slow.Hits != 1 {
+			t.Errorf("Unexpected measurements: %+v", slow)
+		}
+		if len(slow.Slow) != 1 || !strings.Contains(slow.Slow[0], "nested unbounded repetition") {
+			t.Errorf("Expected only the nested repetition to be flagged, got %v", slow.Slow)
+		}
+	})
+
+	t.Run("flags rules over the time per line", func(t *testing.T) {
+		rows := bench(t, "*", time.Nanosecond)
+		if !rows["bench-fast"].Pathological() {
+			t.Errorf("Expected bench-fast to be flagged: %+v", rows["bench-fast"])
+		}
+	})
+
+	t.Run("rules without data are not measured", func(t *testing.T) {
+		rows := bench(t, "cre.log.kafka", time.Second)
+		if rows["bench-fast"].Lines != 0 || rows["bench-fast"].Pathological() {
+			t.Errorf("Expected no measurements, got %+v", rows["bench-fast"])
+		}
+	})
+}
+
+func TestBenchLint(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`disk full`, ""},
+		{`\d{1,3}(?:\.\d{1,3}){3}:\d+`, ""},
+		{`(a+)+b`, "nested unbounded repetition"},
+		{`(?:x*y)*`, "nested unbounded repetition"},
+		{`.*error`, "leading wildcard"},
+		{`error .* at .* line`, "2 unbounded wildcards"},
+		{`a{200}`, "counted repetition over 100"},
+	}
+
+	for _, tt := range tests {
+		got := strings.Join(benchRegexesT{tt.expr}.lint(), "; ")
+		if (tt.want == "" && got != "") || !strings.Contains(got, tt.want) {
+			t.Errorf("lint(%q) = %q, expected %q", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCompose(t *testing.T) {
+	base := `
+rules:
+  - cre:
+      id: compose-a
+    metadata:
+      id: 7gHjKmNp9qRs3tUv5wXy7z
+      hash: 2aBcDeFg4hJk6mNp8qRs2t
+    rule:
+      set:
+        event:
+          source: cre.log.test
+        match:
+          - value: "disk full"
+  - cre:
+      id: compose-b
+    metadata:
+      id: 8hJkMnPq2rSt4uVw6xYz8a
+      hash: 3bCdEfGh5jKm7nPq9rSt3u
+    rule:
+      set:
+        event:
+          source: cre.log.test
+        match:
+          - value: "broker down"
+  - cre:
+      id: compose-cascade
+    metadata:
+      id: 9jKmNpQr3sTu5vWx7yZa9b
+      hash: 4cDeFgHj6kLm8nPq2rSt4v
+    rule:
+      sequence:
+        event:
+          source: cre.detection
+        window: 10m
+        order:
+          - jq: '.cre == "compose-a"'
+          - jq: '.cre == "compose-b"'
+  - cre:
+      id: compose-outage
+    metadata:
+      id: 2kLmNpQr4sTu6vWx8yZa2c
+      hash: 5dEfGhJk7mNp9qRs3tUv5w
+    rule:
+      set:
+        event:
+          source: cre.detection
+        match:
+          - jq: '.cre == "compose-cascade"'
+`
+
+	run := func(t *testing.T, rules, data string) (*ux.ReportT, error) {
+		src, err := resolve.PipeEvalSource("test", "cre.log.test", [][]byte{[]byte(data)})
+		if err != nil {
+			t.Fatalf("PipeEvalSource failed: %v", err)
+		}
+
+		var (
+			runtime = New(futureMark, ux.NewUxEval())
+			report  = ux.NewReport(nil)
+		)
+
+		matchers, err := runtime.CompileRules([]byte(rules), report)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := runtime.Run(context.Background(), matchers, []*LogData{src}, report); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+
+		return report, nil
+	}
+
+	t.Run("detections feed composed rules in order", func(t *testing.T) {
+		report, err := run(t, base, "2025-01-01T00:00:00Z disk full\n2025-01-01T00:05:00Z broker down\n")
+		if err != nil {
+			t.Fatalf("CompileRules failed: %v", err)
+		}
+		for _, id := range []string{"compose-a", "compose-b", "compose-cascade", "compose-outage"} {
+			if _, ok := report.CreHits[id]; !ok {
+				t.Errorf("Expected a detection of %s, got %v", id, report.CreHits)
+			}
+		}
+	})
+
+	t.Run("detections out of order", func(t *testing.T) {
+		report, err := run(t, base, "2025-01-01T00:00:00Z broker down\n2025-01-01T00:05:00Z disk full\n")
+		if err != nil {
+			t.Fatalf("CompileRules failed: %v", err)
+		}
+		for _, id := range []string{"compose-cascade", "compose-outage"} {
+			if _, ok := report.CreHits[id]; ok {
+				t.Errorf("Expected no detection of %s", id)
+			}
+		}
+	})
+
+	t.Run("detections name their source", func(t *testing.T) {
+		rules := base + `
+  - cre:
+      id: compose-app-disk
+    metadata:
+      id: 4nPqRsTu6vWx8yZa2bCd4e
+      hash: 7fGhJkMn9pQr3sTu5vWx7z
+    rule:
+      set:
+        event:
+          source: cre.detection
+        match:
+          - jq: '.cre == "compose-a" and .source == "app"'
+  - cre:
+      id: compose-app-broker
+    metadata:
+      id: 5pQrStUv7wXy9zAb3cDe5f
+      hash: 8gHjKmNp2qRs4tUv6wXy8a
+    rule:
+      set:
+        event:
+          source: cre.detection
+        match:
+          - jq: '.cre == "compose-b" and .source == "app"'
+  - cre:
+      id: compose-kafka-cascade
+    metadata:
+      id: 6qRsTuVw8xYz2aBc4dEf6g
+      hash: 9hJkMnPq3rSt5uVw7xYz9b
+    rule:
+      set:
+        event:
+          source: cre.detection
+        match:
+          - jq: '.cre == "compose-cascade" and .source == "kafka"'
+`
+		var (
+			runtime = New(futureMark, ux.NewUxEval())
+			report  = ux.NewReport(nil)
+			sources []*LogData
+		)
+
+		// One source runs per type, so the second one matches every rule
+		for _, s := range []struct{ name, srcType, data string }{
+			{"kafka", "cre.log.test", "2025-01-01T00:00:00Z disk full\n2025-01-01T00:05:00Z broker down\n"},
+			{"app", "*", "2025-01-01T00:10:00Z disk full\n"},
+		} {
+			src, err := resolve.PipeEvalSource(s.name, s.srcType, [][]byte{[]byte(s.data)})
+			if err != nil {
+				t.Fatalf("PipeEvalSource failed: %v", err)
+			}
+			sources = append(sources, src)
+		}
+
+		matchers, err := runtime.CompileRules([]byte(rules), report)
+		if err != nil {
+			t.Fatalf("CompileRules failed: %v", err)
+		}
+
+		if err := runtime.Run(context.Background(), matchers, sources, report); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+
+		for _, id := range []string{"compose-app-disk", "compose-kafka-cascade"} {
+			if _, ok := report.CreHits[id]; !ok {
+				t.Errorf("Expected a detection of %s, got %v", id, report.CreHits)
+			}
+		}
+		if _, ok := report.CreHits["compose-app-broker"]; ok {
+			t.Errorf("Expected no detection of compose-app-broker")
+		}
+	})
+
+	t.Run("cycles are rejected at load", func(t *testing.T) {
+		cycle := base + `
+  - cre:
+      id: compose-loop
+    metadata:
+      id: 3mNpQrSt5uVw7xYz9aBc3d
+      hash: 6eFgHjKm8nPq2rSt4uVw6y
+    rule:
+      set:
+        event:
+          source: cre.detection
+        match:
+          - jq: '.cre == "compose-outage" or .cre == "compose-loop"'
+`
+		_, err := run(t, cycle, "2025-01-01T00:00:00Z disk full\n")
+		if !errors.Is(err, ErrRuleCycle) || !strings.Contains(err.Error(), "compose-loop -> compose-loop") {
+			t.Errorf("Expected ErrRuleCycle, got %v", err)
+		}
+
+		cycle = strings.Replace(base, `'.cre == "compose-a"'`, `'.cre == "compose-outage"'`, 1)
+		_, err = run(t, cycle, "2025-01-01T00:00:00Z disk full\n")
+		if !errors.Is(err, ErrRuleCycle) || !strings.Contains(err.Error(), "compose-cascade -> compose-outage -> compose-cascade") {
+			t.Errorf("Expected ErrRuleCycle, got %v", err)
+		}
+	})
+}
+
+func TestLocateHorizon(t *testing.T) {
+
+	horizon := func(t *testing.T, rule string) int64 {
+		t.Helper()
+		rules, err := parser.Read(strings.NewReader("rules:\n  - cre:\n      id: horizon\n    rule:\n"+rule), parser.WithGenIds())
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		return locateHorizon([]*parser.RulesT{rules})
+	}
+
+	tests := map[string]struct {
+		rule string
+		want int64
+	}{
+		"single term": {
+			rule: "      set:\n        match:\n          - foo\n",
+			want: 0,
+		},
+		"window with negate window and slide": {
+			rule: "      sequence:\n        window: 10m\n        order:\n          - foo\n          - bar\n        negate:\n          - value: baz\n            window: 5m\n            slide: -1m\n",
+			want: int64(16 * time.Minute),
+		},
+		"nested window": {
+			rule: "      sequence:\n        window: 10m\n        order:\n          - foo\n          - set:\n              window: 2m\n              match:\n                - bar\n                - baz\n",
+			want: int64(12 * time.Minute),
+		},
+		"several terms without a window": {
+			rule: "      set:\n        match:\n          - foo\n          - bar\n",
+			want: math.MaxInt64,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := horizon(t, tc.rule); got != tc.want {
+				t.Errorf("Expected horizon %d, got %d", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestSarif(t *testing.T) {
+	rules := `
+rules:
+  - cre:
+      id: sarif-example
+      severity: 1
+      title: Disk full then broker down
+      description: The broker stopped after its disk filled up.
+      mitigation: Free disk space and restart the broker.
+    metadata:
+      id: 3mNpQrSt5uVw7xYz9aBc3d
+      hash: 6eFgHjKm8nPq2rSt4uVw6x
+    rule:
+      sequence:
+        event:
+          source: cre.log.test
+        window: 10m
+        order:
+          - value: "disk full"
+          - value: "broker down"
+`
+
+	data := "2025-01-01T00:00:00Z starting\nnot a timestamp\n2025-01-01T00:01:00Z disk full\n2025-01-01T00:02:00Z broker down\n"
+
+	runSrc := func(t *testing.T, locate bool, src *LogData) *ux.ReportT {
+		var (
+			runtime = New(futureMark, ux.NewUxEval())
+			report  = ux.NewReport(nil)
+		)
+		runtime.Locate = locate
+
+		matchers, err := runtime.CompileRules([]byte(rules), report)
+		if err != nil {
+			t.Fatalf("CompileRules failed: %v", err)
+		}
+
+		if err := runtime.Run(context.Background(), matchers, []*LogData{src}, report); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+
+		return report
+	}
+
+	runData := func(t *testing.T, locate bool, data string, opts ...resolve.OptT) *ux.ReportT {
+		src, err := resolve.PipeEvalSource("test", "cre.log.test", [][]byte{[]byte(data)}, opts...)
+		if err != nil {
+			t.Fatalf("PipeEvalSource failed: %v", err)
+		}
+		return runSrc(t, locate, src)
+	}
+
+	lines := func(report *ux.ReportT) []int64 {
+		var out []int64
+		for _, m := range report.Hits["sarif-example"] {
+			for _, e := range m.Entries {
+				out = append(out, e.Line)
+			}
+		}
+		return out
+	}
+
+	run := func(t *testing.T, locate bool) *ux.ReportT {
+		return runData(t, locate, data)
+	}
+
+	t.Run("hits carry file and line", func(t *testing.T) {
+		report := run(t, true)
+
+		var lines []int64
+		for _, m := range report.Hits["sarif-example"] {
+			for _, e := range m.Entries {
+				if e.File == "" {
+					t.Errorf("Expected a file for %q", e.Entry)
+				}
+				lines = append(lines, e.Line)
+			}
+		}
+
+		// Unparsed lines still count
+		if fmt.Sprint(lines) != "[3 4]" {
+			t.Fatalf("Expected lines [3 4], got %v", lines)
+		}
+	})
+
+	t.Run("reordered and grouped entries keep their lines", func(t *testing.T) {
+		var (
+			data = "2025-01-01T00:00:00Z starting\n2025-01-01T00:02:00Z broker down\n2025-01-01T00:01:00Z disk full\n  at disk.write\n"
+			spec = resolve.MultilineT{Continuation: `^\s+at `}
+		)
+		if err := spec.Compile(); err != nil {
+			t.Fatalf("Compile failed: %v", err)
+		}
+
+		report := runData(t, true, data, resolve.WithWindow(int64(5*time.Minute)), resolve.WithMultiline(&spec))
+		if got := fmt.Sprint(lines(report)); got != "[3 2]" {
+			t.Errorf("Expected lines [3 2], got %s", got)
+		}
+	})
+
+	t.Run("tailed logs have no line numbers", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.log")
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+
+		ss, err := resolve.ParseSources([]byte(fmt.Sprintf("sources:\n  - name: test\n    type: cre.log.test\n    tail: 2\n    locations:\n      - path: %s\n", path)))
+		if err != nil {
+			t.Fatalf("ParseSources failed: %v", err)
+		}
+
+		srcs := resolve.ResolveSources(ss)
+		if len(srcs) != 1 {
+			t.Fatalf("Expected one source, got %d", len(srcs))
+		}
+
+		report := runSrc(t, true, srcs[0])
+		for _, m := range report.Hits["sarif-example"] {
+			for _, e := range m.Entries {
+				if e.File != path || e.Line != 0 {
+					t.Errorf("Expected %s without a line, got %s:%d", path, e.File, e.Line)
+				}
+			}
+		}
+		if len(lines(report)) != 2 {
+			t.Errorf("Expected 2 located entries, got %v", lines(report))
+		}
+	})
+
+	t.Run("no locations unless requested", func(t *testing.T) {
+		report := run(t, false)
+		for _, m := range report.Hits["sarif-example"] {
+			for _, e := range m.Entries {
+				if e.File != "" || e.Line != 0 {
+					t.Errorf("Unexpected location %s:%d", e.File, e.Line)
+				}
+			}
+		}
+	})
+
+	t.Run("writes rules and results", func(t *testing.T) {
+		report := run(t, true)
+
+		path, err := report.WriteSarif(filepath.Join(t.TempDir(), "report.sarif"))
+		if err != nil {
+			t.Fatalf("WriteSarif failed: %v", err)
+		}
+
+		out, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile failed: %v", err)
+		}
+
+		var doc struct {
+			Version string `json:"version"`
+			Runs    []struct {
+				Tool struct {
+					Driver struct {
+						Rules []struct {
+							Id   string `json:"id"`
+							Help struct {
+								Text string `json:"text"`
+							} `json:"help"`
+							DefaultConfiguration struct {
+								Level string `json:"level"`
+							} `json:"defaultConfiguration"`
+						} `json:"rules"`
+					} `json:"driver"`
+				} `json:"tool"`
+				Results []struct {
+					RuleId    string `json:"ruleId"`
+					Level     string `json:"level"`
+					Locations []struct {
+						PhysicalLocation struct {
+							Region struct {
+								StartLine int64 `json:"startLine"`
+							} `json:"region"`
+						} `json:"physicalLocation"`
+					} `json:"locations"`
+				} `json:"results"`
+			} `json:"runs"`
+		}
+
+		if err := json.Unmarshal(out, &doc); err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+
+		if doc.Version != "2.1.0" || len(doc.Runs) != 1 {
+			t.Fatalf("Unexpected SARIF log: %s", out)
+		}
+
+		run := doc.Runs[0]
+		if len(run.Tool.Driver.Rules) != 1 || run.Tool.Driver.Rules[0].Id != "sarif-example" {
+			t.Fatalf("Unexpected rules: %+v", run.Tool.Driver.Rules)
+		}
+		if rule := run.Tool.Driver.Rules[0]; rule.DefaultConfiguration.Level != "error" || rule.Help.Text == "" {
+			t.Errorf("Unexpected rule: %+v", rule)
+		}
+
+		if len(run.Results) != 1 || len(run.Results[0].Locations) != 2 {
+			t.Fatalf("Unexpected results: %s", out)
+		}
+		if line := run.Results[0].Locations[0].PhysicalLocation.Region.StartLine; line != 3 {
+			t.Errorf("Expected start line 3, got %d", line)
+		}
+	})
+}
+
+func TestMergeRuleFiles(t *testing.T) {
+
+	var (
+		dir = t.TempDir()
+		a   = filepath.Join(dir, "a.yaml")
+		b   = filepath.Join(dir, "b.yaml")
+	)
+
+	load := func(t *testing.T, dataA, dataB string) error {
+		t.Helper()
+
+		if err := os.WriteFile(a, []byte(dataA), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(b, []byte(dataB), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		r := New(0, ux.NewUxEval())
+		defer r.Close()
+
+		_, err := r.LoadRulesPaths(ux.NewReport(nil), []utils.RulePathT{
+			{Path: a, Type: utils.RuleTypeUser},
+			{Path: b, Type: utils.RuleTypeUser},
+		})
+		return err
+	}
+
+	t.Run("Named terms are shared across files", func(t *testing.T) {
+		var (
+			dataA = fmt.Sprintf(lintRuleFmt, "CRE-2025-0001", "Xk9aPqRt5uVw", "Ht7bQsMn4jKp", lintSet) + mergeTerms
+			dataB = fmt.Sprintf(lintRuleFmt, "CRE-2025-0002", "Jm3cRtNp8wQz", "Pq5dStUv6xYz", mergeUse)
+		)
+		if err := load(t, dataA, dataB); err != nil {
+			t.Fatalf("Expected the term from %s to resolve in %s: %v", a, b, err)
+		}
+	})
+
+	t.Run("Duplicate terms name both files", func(t *testing.T) {
+		var (
+			dataA = fmt.Sprintf(lintRuleFmt, "CRE-2025-0001", "Xk9aPqRt5uVw", "Ht7bQsMn4jKp", lintSet) + mergeTerms
+			dataB = fmt.Sprintf(lintRuleFmt, "CRE-2025-0002", "Jm3cRtNp8wQz", "Pq5dStUv6xYz", mergeUse) + mergeTerms
+		)
+		err := load(t, dataA, dataB)
+		if !errors.Is(err, parser.ErrDuplicateTerm) {
+			t.Fatalf("Expected duplicate term error, got %v", err)
+		}
+		if !strings.Contains(err.Error(), a) || !strings.Contains(err.Error(), b) {
+			t.Errorf("Expected error to name %s and %s, got %v", a, b, err)
+		}
+	})
+}
@@ -0,0 +1,439 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prequel-dev/preq/internal/pkg/matchz"
+	"github.com/prequel-dev/preq/internal/pkg/ux"
+	"github.com/prequel-dev/prequel-compiler/pkg/parser"
+	"github.com/prequel-dev/prequel-logmatch/pkg/entry"
+	lm "github.com/prequel-dev/prequel-logmatch/pkg/match"
+)
+
+const (
+	maxExplainEvents = 1000
+)
+
+var (
+	ErrExplainNotFound = errors.New("rule to explain not found")
+)
+
+// explainPosT is where an entry was read.
+type explainPosT struct {
+	src   string
+	line  int64 // Line the entry starts on in src; zero when unknown
+	entry int64 // Entries scanned, after multiline grouping and reordering
+}
+
+// where names the entry by its line, or by its position in the scan when the line is unknown.
+func (p explainPosT) where() string {
+	if p.line > 0 {
+		return fmt.Sprintf("line %d", p.line)
+	}
+	return fmt.Sprintf("entry %d", p.entry)
+}
+
+type explainHitT struct {
+	pos explainPosT
+	ts  int64
+}
+
+// explainerT follows the terms of one rule alongside its matcher to explain how the rule
+// progressed. The matchers expose no state, so the trace is a simplified model: sequences
+// advance one term per entry, negate terms reset progress when they match regardless of
+// their own window options, and nested sequences and sets are not traced. Each completion
+// is checked against the matcher's detections, and disagreements are flagged in the trace.
+type explainerT struct {
+	mux     sync.Mutex
+	ruleId  string
+	seq     bool
+	window  int64
+	terms   []lm.MatchFunc
+	counts  []int // Matches each term needs
+	negate  []lm.MatchFunc
+	hits    [][]explainHitT // Matches of each term, up to its count
+	pending [][]int64       // Sorted timestamps of completions the matcher has not reported yet
+	missed  int             // Detections without a traced completion
+	dropped int
+	trace   ux.ExplainT
+}
+
+func newExplainer(rules []*parser.RulesT, creId string) (*explainerT, error) {
+
+	for _, rs := range rules {
+		for _, rule := range rs.Rules {
+			if rule.Cre.Id == creId {
+				return buildExplainer(rule, rs.TermsT)
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrExplainNotFound, creId)
+}
+
+func buildExplainer(rule parser.ParseRuleT, named map[string]parser.ParseTermT) (*explainerT, error) {
+
+	var (
+		match, negate []parser.ParseTermT
+		window        string
+		nested        bool
+		e             = &explainerT{
+			ruleId: rule.Metadata.Id,
+			trace: ux.ExplainT{
+				CreId:  rule.Cre.Id,
+				RuleId: rule.Metadata.Id,
+			},
+		}
+	)
+
+	switch {
+	case rule.Rule.Sequence != nil:
+		e.seq = true
+		e.trace.Type = "sequence"
+		match, negate, window = rule.Rule.Sequence.Order, rule.Rule.Sequence.Negate, rule.Rule.Sequence.Window
+	case rule.Rule.Set != nil:
+		e.trace.Type = "set"
+		match, negate, window = rule.Rule.Set.Match, rule.Rule.Set.Negate, rule.Rule.Set.Window
+	}
+
+	if window != "" {
+		d, err := time.ParseDuration(window)
+		if err != nil {
+			return nil, fmt.Errorf("explain %s: %w", rule.Cre.Id, err)
+		}
+		e.window = d.Nanoseconds()
+		e.trace.Window = d.String()
+	}
+
+	for _, t := range match {
+		desc, m, count := explainTerm(t, named)
+		nested = nested || m == nil
+		e.trace.Terms = append(e.trace.Terms, desc)
+		e.terms = append(e.terms, m)
+		e.counts = append(e.counts, count)
+	}
+
+	for _, t := range negate {
+		desc, m, _ := explainTerm(t, named)
+		nested = nested || m == nil
+		e.trace.Negate = append(e.trace.Negate, desc)
+		e.negate = append(e.negate, m)
+	}
+
+	if nested {
+		e.trace.Notes = append(e.trace.Notes, "nested sequences and sets are not traced; progress stops at them")
+	}
+
+	e.hits = make([][]explainHitT, len(e.terms))
+
+	return e, nil
+}
+
+// explainTerm describes a term and returns its matcher, or nil if it is not traced, and the number of matches it needs.
+func explainTerm(t parser.ParseTermT, named map[string]parser.ParseTermT) (string, lm.MatchFunc, int) {
+
+	var (
+		term  lm.TermT
+		desc  string
+		name  string
+		count = 1
+	)
+
+	// Resolve references to named terms as the parser does
+	if r, ok := named[t.StrValue]; ok && t.StrValue != "" {
+		name = t.StrValue
+		if t.NegateOpts != nil {
+			r.NegateOpts = t.NegateOpts
+		}
+		t = r
+	}
+
+	switch {
+	case t.Sequence != nil:
+		desc = "nested sequence"
+	case t.Set != nil:
+		desc = "nested set"
+	case t.RegexValue != "":
+		term = lm.TermT{Type: lm.TermRegex, Value: t.RegexValue}
+		desc = fmt.Sprintf("regex %q", t.RegexValue)
+	case t.JqValue != "":
+		term = lm.TermT{Type: lm.TermJqJson, Value: t.JqValue}
+		desc = fmt.Sprintf("jq %q", t.JqValue)
+	default:
+		term = lm.TermT{Type: lm.TermRaw, Value: t.StrValue}
+		desc = fmt.Sprintf("%q", t.StrValue)
+	}
+
+	if name != "" {
+		desc = name + ": " + desc
+	}
+
+	if t.Count > 1 {
+		count = t.Count
+		desc += fmt.Sprintf(" (count %d)", t.Count)
+	}
+
+	if o := t.NegateOpts; o != nil {
+		var opts []string
+		if o.Window != "" {
+			opts = append(opts, "window "+o.Window)
+		}
+		if o.Slide != "" {
+			opts = append(opts, "slide "+o.Slide)
+		}
+		if o.Anchor > 0 {
+			opts = append(opts, fmt.Sprintf("anchor %d", o.Anchor))
+		}
+		if o.Absolute {
+			opts = append(opts, "absolute")
+		}
+		if len(opts) > 0 {
+			desc += " (" + strings.Join(opts, ", ") + ")"
+		}
+	}
+
+	if term.Value == "" {
+		return desc, nil, count
+	}
+
+	m, err := term.NewMatcher()
+	if err != nil {
+		return fmt.Sprintf("%s (invalid: %v)", desc, err), nil, count
+	}
+
+	return desc, m, count
+}
+
+// scan records the terms the entry matched and how the rule progressed.
+func (e *explainerT) scan(pos explainPosT, ent entry.LogEntry, raw string) {
+
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	e.trace.Entries++
+
+	e.expire(pos, ent.Timestamp)
+
+	for i, m := range e.negate {
+		if m == nil || !m(ent.Line) {
+			continue
+		}
+
+		step := e.step()
+		if step == 0 {
+			e.add(ux.ExplainNegate, pos, ent.Timestamp, i+1, 0, raw, "no match in progress")
+			continue
+		}
+
+		e.add(ux.ExplainNegate, pos, ent.Timestamp, i+1, step, raw,
+			fmt.Sprintf("suppressed match at %d/%d terms", step, len(e.terms)))
+		e.reset()
+	}
+
+	// Sequences advance by at most one term per entry
+	var step = e.step()
+
+	for i, m := range e.terms {
+		if m == nil || !m(ent.Line) {
+			continue
+		}
+
+		switch {
+		case e.matched(i):
+			e.add(ux.ExplainMatch, pos, ent.Timestamp, i+1, e.step(), raw,
+				fmt.Sprintf("term %d already matched on %s", i+1, e.hits[i][0].pos.where()))
+		case e.seq && i != step:
+			e.add(ux.ExplainMatch, pos, ent.Timestamp, i+1, e.step(), raw,
+				fmt.Sprintf("out of order; waiting for term %d", step+1))
+		default:
+			e.hits[i] = append(e.hits[i], explainHitT{pos: pos, ts: ent.Timestamp})
+			if !e.matched(i) {
+				e.add(ux.ExplainProgress, pos, ent.Timestamp, i+1, e.step(), raw,
+					fmt.Sprintf("term %d matched %d of %d times, %d/%d terms", i+1, len(e.hits[i]), e.counts[i], e.step(), len(e.terms)))
+				continue
+			}
+			e.add(ux.ExplainProgress, pos, ent.Timestamp, i+1, e.step(), raw,
+				fmt.Sprintf("term %d matched, %d/%d terms", i+1, e.step(), len(e.terms)))
+		}
+	}
+
+	if n := len(e.terms); n > 0 && e.step() == n {
+		e.add(ux.ExplainComplete, pos, ent.Timestamp, 0, n, "",
+			fmt.Sprintf("all %d terms matched since %s", n, e.first().pos.where()))
+		e.pending = append(e.pending, e.stamps())
+		e.reset()
+	}
+}
+
+// detect records a detection reported by the rule's matcher.
+// The position is that of the entry being scanned, or empty on the final flush.
+func (e *explainerT) detect(pos explainPosT, hits *matchz.HitsT) {
+
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	e.trace.Detections++
+
+	var (
+		ts     int64
+		detail = fmt.Sprintf("detection with %d entries", len(hits.Entries))
+	)
+
+	if len(hits.Entries) > 0 {
+		ts = hits.Entries[0].Timestamp
+	}
+
+	if pos.entry == 0 {
+		detail += " on final flush"
+	}
+
+	e.add(ux.ExplainDetect, pos, ts, 0, 0, "", detail)
+
+	// Cross-check the detection against the traced completions
+	var stamps = make([]int64, 0, len(hits.Entries))
+	for _, ent := range hits.Entries {
+		stamps = append(stamps, ent.Timestamp)
+	}
+	slices.Sort(stamps)
+
+	if i := slices.IndexFunc(e.pending, func(p []int64) bool { return slices.Equal(p, stamps) }); i >= 0 {
+		e.pending = slices.Delete(e.pending, i, i+1)
+		return
+	}
+
+	e.missed++
+	e.add(ux.ExplainMismatch, pos, ts, 0, 0, "",
+		"the matcher detected entries that no traced completion matched; the trace does not model this detection")
+}
+
+// expire drops matches older than the window. A sequence starts over when its first match expires.
+func (e *explainerT) expire(pos explainPosT, ts int64) {
+
+	if e.window <= 0 {
+		return
+	}
+
+	for i, hs := range e.hits {
+		if len(hs) == 0 || ts-hs[0].ts <= e.window {
+			continue
+		}
+
+		if e.seq {
+			e.add(ux.ExplainExpire, pos, ts, 0, e.step(), "",
+				fmt.Sprintf("window %s expired at %d/%d terms, started %s", e.trace.Window, e.step(), len(e.terms), hs[0].pos.where()))
+			e.reset()
+			return
+		}
+
+		var n int
+		for n < len(hs) && ts-hs[n].ts > e.window {
+			n++
+		}
+		e.hits[i] = hs[n:]
+		e.add(ux.ExplainExpire, pos, ts, i+1, e.step(), "",
+			fmt.Sprintf("window %s expired for %d match(es) of term %d, first on %s", e.trace.Window, n, i+1, hs[0].pos.where()))
+	}
+}
+
+// matched returns true once term i has matched as many times as its count.
+func (e *explainerT) matched(i int) bool {
+	return len(e.hits[i]) >= e.counts[i]
+}
+
+// step returns the number of terms matched: leading terms for a sequence, any for a set.
+func (e *explainerT) step() int {
+
+	var n int
+	for i := range e.hits {
+		switch {
+		case e.matched(i):
+			n++
+		case e.seq:
+			return n
+		}
+	}
+
+	return n
+}
+
+func (e *explainerT) first() *explainHitT {
+
+	var first *explainHitT
+	for _, hs := range e.hits {
+		for i := range hs {
+			if first == nil || hs[i].ts < first.ts {
+				first = &hs[i]
+			}
+		}
+	}
+
+	return first
+}
+
+// stamps returns the sorted timestamps of the matched terms.
+func (e *explainerT) stamps() []int64 {
+
+	var out = make([]int64, 0, len(e.hits))
+	for _, hs := range e.hits {
+		for _, h := range hs {
+			out = append(out, h.ts)
+		}
+	}
+	slices.Sort(out)
+
+	return out
+}
+
+func (e *explainerT) reset() {
+	clear(e.hits)
+}
+
+func (e *explainerT) add(kind string, pos explainPosT, ts int64, term, step int, raw, detail string) {
+
+	if len(e.trace.Events) >= maxExplainEvents {
+		e.dropped++
+		return
+	}
+
+	e.trace.Events = append(e.trace.Events, ux.ExplainEventT{
+		Kind:      kind,
+		Source:    pos.src,
+		Line:      pos.line,
+		Index:     pos.entry,
+		Timestamp: time.Unix(0, ts),
+		Term:      term,
+		Step:      step,
+		Entry:     raw,
+		Detail:    detail,
+	})
+}
+
+func (e *explainerT) explanation() *ux.ExplainT {
+
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	t := e.trace
+	t.Events = slices.Clone(e.trace.Events)
+	t.Notes = slices.Clone(e.trace.Notes)
+
+	t.Mismatches = e.missed + len(e.pending)
+
+	if e.missed > 0 {
+		t.Notes = append(t.Notes, fmt.Sprintf("%d detection(s) had no traced completion", e.missed))
+	}
+	if len(e.pending) > 0 {
+		t.Notes = append(t.Notes, fmt.Sprintf("%d traced completion(s) were not reported by the matcher", len(e.pending)))
+	}
+
+	if e.dropped > 0 {
+		t.Notes = append(t.Notes, fmt.Sprintf("trace truncated after %d events; %d more not shown", maxExplainEvents, e.dropped))
+	}
+
+	return &t
+}
@@ -0,0 +1,196 @@
+package engine
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/prequel-dev/preq/internal/pkg/resolve"
+	"github.com/prequel-dev/prequel-compiler/pkg/parser"
+	"github.com/rs/zerolog/log"
+)
+
+// Sources with a field parser hand the extracted JSON document only to rules with jq terms;
+// other rules match the original line. Rules that mix jq with raw or regex terms are
+// rewritten before compilation to run those terms on the "_raw" field of the document.
+
+// ExtractedTypes returns the source types whose lines are extracted into fields.
+// Set it as RuntimeT.Extracted before compiling rules.
+func ExtractedTypes(sources []*LogData) []string {
+
+	var types = make([]string, 0)
+
+	for _, ld := range sources {
+		if ld.FieldParser() != nil && !slices.Contains(types, ld.SrcType()) {
+			types = append(types, ld.SrcType())
+		}
+	}
+
+	return types
+}
+
+// jqRules returns the IDs of rules with jq terms.
+func jqRules(rules []*parser.RulesT) map[string]bool {
+
+	var out = make(map[string]bool)
+
+	for _, rs := range rules {
+		for _, rule := range rs.Rules {
+			if hasTerm(rule, rs.TermsT, isJqTerm) {
+				out[rule.Metadata.Id] = true
+			}
+		}
+	}
+
+	return out
+}
+
+// rawTermsToJq rewrites the raw and regex terms of rules that also have jq terms and run on
+// an extracted source type. Named terms are copied into the rule so other rules keep them.
+func rawTermsToJq(rules *parser.RulesT, types []string) {
+
+	for i := range rules.Rules {
+		var rule = &rules.Rules[i]
+
+		if !extractedSource(rule, types) || !hasTerm(*rule, rules.TermsT, isJqTerm) || !hasTerm(*rule, rules.TermsT, isLineTerm) {
+			continue
+		}
+
+		log.Info().
+			Str("cre", rule.Cre.Id).
+			Msg("Match raw and regex terms on extracted lines")
+
+		if s := rule.Rule.Sequence; s != nil {
+			rewriteTerms(rules.TermsT, s.Order, s.Negate)
+		}
+		if s := rule.Rule.Set; s != nil {
+			rewriteTerms(rules.TermsT, s.Match, s.Negate)
+		}
+	}
+}
+
+func extractedSource(rule *parser.ParseRuleT, types []string) bool {
+
+	if slices.Contains(types, "*") {
+		return true
+	}
+
+	switch {
+	case rule.Rule.Sequence != nil && rule.Rule.Sequence.Event != nil:
+		return slices.Contains(types, rule.Rule.Sequence.Event.Source)
+	case rule.Rule.Set != nil && rule.Rule.Set.Event != nil:
+		return slices.Contains(types, rule.Rule.Set.Event.Source)
+	}
+
+	return false
+}
+
+func isJqTerm(t parser.ParseTermT) bool {
+	return t.JqValue != ""
+}
+
+func isLineTerm(t parser.ParseTermT) bool {
+	return t.StrValue != "" || t.RegexValue != ""
+}
+
+func hasTerm(rule parser.ParseRuleT, named map[string]parser.ParseTermT, pred func(parser.ParseTermT) bool) bool {
+
+	var terms [][]parser.ParseTermT
+
+	if s := rule.Rule.Sequence; s != nil {
+		terms = append(terms, s.Order, s.Negate)
+	}
+	if s := rule.Rule.Set; s != nil {
+		terms = append(terms, s.Match, s.Negate)
+	}
+
+	return anyTerm(named, pred, terms...)
+}
+
+func anyTerm(named map[string]parser.ParseTermT, pred func(parser.ParseTermT) bool, terms ...[]parser.ParseTermT) bool {
+	for _, ts := range terms {
+		for _, t := range ts {
+			if n, ok := named[t.StrValue]; ok && t.StrValue != "" {
+				t = n
+			}
+			switch {
+			case t.Sequence != nil:
+				if anyTerm(named, pred, t.Sequence.Order, t.Sequence.Negate) {
+					return true
+				}
+			case t.Set != nil:
+				if anyTerm(named, pred, t.Set.Match, t.Set.Negate) {
+					return true
+				}
+			case pred(t):
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func rewriteTerms(named map[string]parser.ParseTermT, terms ...[]parser.ParseTermT) {
+	for _, ts := range terms {
+		for i := range ts {
+			var t = &ts[i]
+
+			if n, ok := named[t.StrValue]; ok && t.StrValue != "" {
+				opts := t.NegateOpts
+				*t = copyTerm(n)
+				if opts != nil {
+					t.NegateOpts = opts
+				}
+			}
+
+			switch {
+			case t.Sequence != nil:
+				rewriteTerms(named, t.Sequence.Order, t.Sequence.Negate)
+			case t.Set != nil:
+				rewriteTerms(named, t.Set.Match, t.Set.Negate)
+			case t.StrValue != "":
+				t.JqValue = rawJq("contains", t.StrValue)
+				t.StrValue = ""
+			case t.RegexValue != "":
+				t.JqValue = rawJq("test", t.RegexValue)
+				t.RegexValue = ""
+			}
+		}
+	}
+}
+
+// copyTerm copies the nested terms of a named term so rewriting them leaves the original.
+func copyTerm(t parser.ParseTermT) parser.ParseTermT {
+
+	if t.Sequence != nil {
+		s := *t.Sequence
+		s.Order = slices.Clone(s.Order)
+		s.Negate = slices.Clone(s.Negate)
+		for _, ts := range [][]parser.ParseTermT{s.Order, s.Negate} {
+			for i := range ts {
+				ts[i] = copyTerm(ts[i])
+			}
+		}
+		t.Sequence = &s
+	}
+
+	if t.Set != nil {
+		s := *t.Set
+		s.Match = slices.Clone(s.Match)
+		s.Negate = slices.Clone(s.Negate)
+		for _, ts := range [][]parser.ParseTermT{s.Match, s.Negate} {
+			for i := range ts {
+				ts[i] = copyTerm(ts[i])
+			}
+		}
+		t.Set = &s
+	}
+
+	return t
+}
+
+// rawJq returns a jq filter applying fn to the original line; Go regexes back both matchers.
+func rawJq(fn, value string) string {
+	// Marshaling a string cannot fail
+	arg, _ := json.Marshal(value)
+	return "." + resolve.RawField + " | " + fn + "(" + string(arg) + ")"
+}
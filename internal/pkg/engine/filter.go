@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"github.com/prequel-dev/preq/internal/pkg/utils"
+	"github.com/prequel-dev/prequel-compiler/pkg/parser"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	reasonOverride = "disabled by override"
+)
+
+type skippedT struct {
+	rule   parser.ParseRuleT
+	reason string
+}
+
+type overriddenT struct {
+	rule    parser.ParseRuleT
+	changes []string
+}
+
+// skipFuncT reports whether a rule is removed before compilation, and why.
+type skipFuncT func(rule parser.ParseRuleT) (string, bool)
+
+// overrideRules applies the configured per-CRE overrides in place.
+func overrideRules(rules *parser.RulesT, overrides utils.OverridesT) []overriddenT {
+
+	var out = make([]overriddenT, 0)
+
+	for i := range rules.Rules {
+		if changes := overrides.Apply(&rules.Rules[i]); len(changes) > 0 {
+			log.Info().
+				Str("cre", rules.Rules[i].Cre.Id).
+				Strs("changes", changes).
+				Msg("Override rule")
+			out = append(out, overriddenT{rule: rules.Rules[i], changes: changes})
+		}
+	}
+
+	return out
+}
+
+// filterRules removes the rules skip reports. The rules node is rebuilt so
+// parsing, which looks up each rule's YAML by index, stays aligned.
+func filterRules(rules *parser.RulesT, skip skipFuncT) []skippedT {
+
+	var (
+		skipped = make([]skippedT, 0)
+		kept    = make([]parser.ParseRuleT, 0, len(rules.Rules))
+		root    = *rules.Root
+	)
+
+	root.Content = make([]*yaml.Node, 0, len(rules.Rules))
+
+	for i, rule := range rules.Rules {
+		if reason, ok := skip(rule); ok {
+			log.Info().
+				Str("cre", rule.Cre.Id).
+				Str("reason", reason).
+				Msg("Skip rule")
+			skipped = append(skipped, skippedT{rule: rule, reason: reason})
+			continue
+		}
+		kept = append(kept, rule)
+		root.Content = append(root.Content, rules.Root.Content[i])
+	}
+
+	rules.Rules = kept
+	rules.Root = &root
+
+	return skipped
+}
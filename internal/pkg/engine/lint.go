@@ -0,0 +1,363 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prequel-dev/preq/internal/pkg/utils"
+	"github.com/prequel-dev/prequel-compiler/pkg/parser"
+	"github.com/prequel-dev/prequel-compiler/pkg/pqerr"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrLint = errors.New("rules failed lint")
+)
+
+var (
+	yamlLineExp = regexp.MustCompile(`line (\d+)`)
+
+	// Fields every CRE should carry so reports are actionable; the id is checked by the parser
+	lintCreFields = []string{"title", "severity", "category", "description"}
+)
+
+// LintProblemT is a single problem found in a rules file. Line and Column are 1-based; zero if unknown.
+type LintProblemT struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	RuleId  string `json:"rule_id,omitempty"`
+	CreId   string `json:"cre_id,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p LintProblemT) String() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "%s:%d:%d: %s", p.File, p.Line, p.Column, p.Message)
+
+	switch {
+	case p.CreId != "" && p.RuleId != "":
+		fmt.Fprintf(&sb, " (cre=%s rule=%s)", p.CreId, p.RuleId)
+	case p.CreId != "":
+		fmt.Fprintf(&sb, " (cre=%s)", p.CreId)
+	case p.RuleId != "":
+		fmt.Fprintf(&sb, " (rule=%s)", p.RuleId)
+	}
+
+	return sb.String()
+}
+
+type lintDefT struct {
+	file string
+	line int
+}
+
+type linterT struct {
+	problems []LintProblemT
+	defs     map[string]lintDefT
+}
+
+// LintRulesPaths parses and compiles each rules file and returns every problem found.
+// Files may be plain rules files or multi-document packages with a "rules" section.
+// Duplicate IDs and hashes are checked across all files, as when loading rules for a run.
+func LintRulesPaths(paths []string) []LintProblemT {
+
+	l := &linterT{
+		problems: make([]LintProblemT, 0),
+		defs:     make(map[string]lintDefT),
+	}
+
+	for _, path := range paths {
+		l.lintPath(path)
+	}
+
+	return l.problems
+}
+
+func (l *linterT) add(p LintProblemT) {
+	l.problems = append(l.problems, p)
+}
+
+func (l *linterT) lintPath(path string) {
+
+	rdr, close, err := utils.OpenRulesFile(path)
+	if err != nil {
+		l.add(LintProblemT{File: path, Message: err.Error()})
+		return
+	}
+	defer close()
+
+	data, err := io.ReadAll(rdr)
+	if err != nil {
+		l.add(LintProblemT{File: path, Message: err.Error()})
+		return
+	}
+
+	var (
+		docs  = splitDocs(data)
+		count = len(l.problems)
+		found bool
+	)
+
+	for _, doc := range docs {
+		var root yaml.Node
+		if err := yaml.Unmarshal(doc, &root); err != nil {
+			l.add(LintProblemT{File: path, Line: yamlErrLine(err), Message: err.Error()})
+			continue
+		}
+		if len(root.Content) == 0 {
+			continue
+		}
+
+		var (
+			top        = root.Content[0]
+			_, isRules = findNode(top, "rules")
+			sec, isSec = findNode(top, "section")
+		)
+
+		if !isRules {
+			continue
+		}
+		found = true
+
+		// Packaged CRE sections must carry their IDs; plain user rules may have them generated
+		l.lintDoc(path, doc, isSec && sec.Value == "rules")
+	}
+
+	if !found && len(l.problems) == count {
+		l.add(LintProblemT{File: path, Line: 1, Column: 1, Message: "no rules found"})
+	}
+}
+
+func (l *linterT) lintDoc(path string, doc []byte, cre bool) {
+
+	var parseOpts []parser.ParseOptT
+	if !cre {
+		parseOpts = append(parseOpts, parser.WithGenIds())
+	}
+
+	// Duplicates are checked below with positions
+	rules, err := parser.Read(bytes.NewReader(doc), parser.WithGenIds())
+	if err != nil {
+		l.add(LintProblemT{File: path, Line: yamlErrLine(err), Message: err.Error()})
+		return
+	}
+
+	for i := range rules.Rules {
+		var (
+			rule     = rules.Rules[i]
+			ruleNode = rules.Root.Content[i]
+			sub      = &parser.RulesT{
+				Rules:  rules.Rules[i : i+1],
+				Root:   &yaml.Node{Kind: yaml.SequenceNode, Content: rules.Root.Content[i : i+1]},
+				TermsT: rules.TermsT,
+				TermsY: rules.TermsY,
+			}
+		)
+
+		l.lintCre(path, rule, ruleNode)
+
+		tree, err := parser.ParseRules(sub, parseOpts)
+		if err != nil {
+			l.addErr(path, rule, ruleNode, err)
+			continue
+		}
+
+		// Generated IDs are checked for duplicates too
+		rule.Metadata.Id = tree.Nodes[0].Metadata.RuleId
+		rule.Metadata.Hash = tree.Nodes[0].Metadata.RuleHash
+
+		l.lintDupes(path, rule, ruleNode)
+
+		if _, err = compileRuleTree(NewRuntime(nil), tree); err != nil {
+			l.addErr(path, rule, ruleNode, err)
+		}
+	}
+}
+
+func (l *linterT) lintCre(path string, rule parser.ParseRuleT, ruleNode *yaml.Node) {
+
+	creNode, ok := findNode(ruleNode, "cre")
+	if !ok {
+		l.add(LintProblemT{
+			File:    path,
+			Line:    ruleNode.Line,
+			Column:  ruleNode.Column,
+			RuleId:  rule.Metadata.Id,
+			Message: "missing cre metadata",
+		})
+		return
+	}
+
+	for _, field := range lintCreFields {
+		if n, ok := findNode(creNode, field); ok && (n.Kind != yaml.ScalarNode || n.Value != "") {
+			continue
+		}
+		l.add(LintProblemT{
+			File:    path,
+			Line:    creNode.Line,
+			Column:  creNode.Column,
+			RuleId:  rule.Metadata.Id,
+			CreId:   rule.Cre.Id,
+			Message: fmt.Sprintf("missing cre %s", field),
+		})
+	}
+
+	if n, ok := findNode(creNode, "severity"); ok && rule.Cre.Severity > parser.SeverityInfo {
+		l.add(LintProblemT{
+			File:    path,
+			Line:    n.Line,
+			Column:  n.Column,
+			RuleId:  rule.Metadata.Id,
+			CreId:   rule.Cre.Id,
+			Message: fmt.Sprintf("invalid cre severity %d (must be %d-%d)", rule.Cre.Severity, parser.SeverityCritical, parser.SeverityInfo),
+		})
+	}
+}
+
+// lintDupes mirrors validateRules: rule IDs, hashes and CRE IDs share one namespace.
+func (l *linterT) lintDupes(path string, rule parser.ParseRuleT, ruleNode *yaml.Node) {
+
+	var (
+		seen = make(map[string]struct{}, 3)
+		keys = []struct{ name, val string }{
+			{"rule id", rule.Metadata.Id},
+			{"rule hash", rule.Metadata.Hash},
+			{"cre id", rule.Cre.Id},
+		}
+	)
+
+	for _, k := range keys {
+		if k.val == "" {
+			continue
+		}
+		if _, ok := seen[k.val]; ok {
+			// Generated from the same CRE id
+			continue
+		}
+		seen[k.val] = struct{}{}
+
+		if def, ok := l.defs[k.val]; ok {
+			l.add(LintProblemT{
+				File:    path,
+				Line:    ruleNode.Line,
+				Column:  ruleNode.Column,
+				RuleId:  rule.Metadata.Id,
+				CreId:   rule.Cre.Id,
+				Message: fmt.Sprintf("duplicate %s %s; first defined at %s:%d", k.name, k.val, def.file, def.line),
+			})
+			continue
+		}
+
+		l.defs[k.val] = lintDefT{file: path, line: ruleNode.Line}
+	}
+}
+
+// addErr records a parse or compile error. Compile errors carry no position;
+// they are placed on the term whose value they report, or on the rule.
+func (l *linterT) addErr(path string, rule parser.ParseRuleT, ruleNode *yaml.Node, err error) {
+
+	var (
+		p = LintProblemT{
+			File:    path,
+			Line:    ruleNode.Line,
+			Column:  ruleNode.Column,
+			RuleId:  rule.Metadata.Id,
+			CreId:   rule.Cre.Id,
+			Message: err.Error(),
+		}
+		perr *pqerr.Error
+	)
+
+	switch {
+	case errors.As(err, &perr):
+		p.Line, p.Column = perr.Pos.Line, perr.Pos.Col
+		if perr.Err != nil {
+			p.Message = perr.Err.Error()
+		}
+		if perr.Msg != "" {
+			p.Message = perr.Msg + ": " + p.Message
+		}
+	default:
+		if n := findValue(ruleNode, err.Error()); n != nil {
+			p.Line, p.Column = n.Line, n.Column
+		}
+	}
+
+	l.add(p)
+}
+
+// splitDocs splits a YAML stream on document separators. Each document is
+// padded with the lines that precede it so parse positions match the file.
+func splitDocs(data []byte) [][]byte {
+
+	var (
+		docs  [][]byte
+		cur   bytes.Buffer
+		lines int
+		sc    = bufio.NewScanner(bytes.NewReader(data))
+	)
+
+	sc.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+
+	for sc.Scan() {
+		line := sc.Bytes()
+		lines += 1
+
+		if bytes.HasPrefix(line, []byte("---")) {
+			docs = append(docs, bytes.Clone(cur.Bytes()))
+			cur.Reset()
+			cur.Write(bytes.Repeat([]byte{'\n'}, lines))
+			continue
+		}
+
+		cur.Write(line)
+		cur.WriteByte('\n')
+	}
+
+	return append(docs, cur.Bytes())
+}
+
+func yamlErrLine(err error) int {
+	m := yamlLineExp.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n
+}
+
+func findNode(n *yaml.Node, key string) (*yaml.Node, bool) {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil, false
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1], true
+		}
+	}
+	return nil, false
+}
+
+// findValue returns the first scalar under n reported as the term value in msg.
+func findValue(n *yaml.Node, msg string) *yaml.Node {
+
+	if n.Kind == yaml.ScalarNode && n.Value != "" && strings.Contains(msg, "value:'"+n.Value+"'") {
+		return n
+	}
+
+	for _, c := range n.Content {
+		if f := findValue(c, msg); f != nil {
+			return f
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,285 @@
+package engine
+
+import (
+	"math"
+	"time"
+
+	"github.com/prequel-dev/preq/internal/pkg/matchz"
+	"github.com/prequel-dev/prequel-compiler/pkg/parser"
+	"github.com/prequel-dev/prequel-logmatch/pkg/entry"
+	"github.com/prequel-dev/prequel-logmatch/pkg/scanner"
+)
+
+// Matchers rebuild the entries they report from the line, stream and timestamp, so the file
+// and line each entry starts on are kept aside and looked up when a rule reports a hit.
+// The scan middleware is synchronous: each stage passes the line of the entry it hands on
+// to the next through the locator.
+
+type locT struct {
+	ts   int64
+	line string
+	file string
+	n    int64 // Zero when the line number is unknown
+}
+
+type locKeyT struct {
+	ts   int64
+	line string
+}
+
+// locatorT records where the entries of a data source start for as long as a rule can report them.
+type locatorT struct {
+	horizon int64
+	maxTs   int64
+	locs    []locT // Entries passed to the matchers, in scan order
+
+	// State of the log being scanned
+	file    string
+	known   bool                // Line numbers are unknown when scanning starts past the beginning
+	parsed  int64               // Lines read, including lines that fail to parse
+	cur     int64               // Line of the last entry parsed
+	start   int64               // Line the pending grouped or folded entry starts on
+	started bool                // An entry is pending in the group or fold
+	next    int64               // Line of the entry handed on
+	held    map[locKeyT][]int64 // Lines of entries held for reordering
+}
+
+func newLocator(horizon int64) *locatorT {
+	return &locatorT{horizon: horizon}
+}
+
+// reset starts a log that is scanned from offset.
+func (l *locatorT) reset(file string, offset int64) {
+	l.file = file
+	l.known = offset == 0
+	l.parsed = 0
+	l.cur = 0
+	l.start = 0
+	l.started = false
+	l.next = 0
+	l.held = make(map[locKeyT][]int64)
+}
+
+// parse counts the lines read and records the line of each parsed entry.
+func (l *locatorT) parse(parseF scanner.ParseFuncT) scanner.ParseFuncT {
+	return func(data []byte) (entry.LogEntry, error) {
+		l.parsed++
+		e, err := parseF(data)
+		if err == nil {
+			l.cur = l.parsed
+		}
+		return e, err
+	}
+}
+
+// back sets the line of the entry parsed to n lines before the last line read, for lines that
+// are read again after the format of the log changed.
+func (l *locatorT) back(n int) {
+	l.cur = l.parsed - int64(n)
+}
+
+// head hands on parsed entries as they are.
+func (l *locatorT) head(scanF scanner.ScanFuncT) scanner.ScanFuncT {
+	return func(e entry.LogEntry) bool {
+		l.next = l.cur
+		return scanF(e)
+	}
+}
+
+// groupIn wraps the input of a group or fold. The first entry starts the pending one.
+func (l *locatorT) groupIn(appendF scanner.ScanFuncT) scanner.ScanFuncT {
+	return func(e entry.LogEntry) bool {
+		if !l.started {
+			l.start = l.cur
+			l.started = true
+		}
+		return appendF(e)
+	}
+}
+
+// groupOut wraps the output of a group or fold. Groups and folds hand on the pending entry
+// when another one starts, so the entry being appended starts the next pending one.
+func (l *locatorT) groupOut(scanF scanner.ScanFuncT) scanner.ScanFuncT {
+	return func(e entry.LogEntry) bool {
+		l.next = l.start
+		l.start = l.cur
+		return scanF(e)
+	}
+}
+
+// hold records the line of entries before they are reordered.
+func (l *locatorT) hold(appendF scanner.ScanFuncT) scanner.ScanFuncT {
+	return func(e entry.LogEntry) bool {
+		key := locKeyT{ts: e.Timestamp, line: e.Line}
+		l.held[key] = append(l.held[key], l.next)
+		return appendF(e)
+	}
+}
+
+// release restores the line of reordered entries.
+func (l *locatorT) release(scanF scanner.ScanFuncT) scanner.ScanFuncT {
+	return func(e entry.LogEntry) bool {
+		key := locKeyT{ts: e.Timestamp, line: e.Line}
+		if lines := l.held[key]; len(lines) > 0 {
+			l.next = lines[0]
+			if len(lines) == 1 {
+				delete(l.held, key)
+			} else {
+				l.held[key] = lines[1:]
+			}
+		}
+		return scanF(e)
+	}
+}
+
+// record keeps the location of an entry passed to the matchers and drops those no rule can report.
+func (l *locatorT) record(e entry.LogEntry) {
+
+	var n int64
+	if l.known {
+		n = l.next
+	}
+
+	l.locs = append(l.locs, locT{ts: e.Timestamp, line: e.Line, file: l.file, n: n})
+
+	if e.Timestamp > l.maxTs {
+		l.maxTs = e.Timestamp
+	}
+
+	if l.horizon == math.MaxInt64 {
+		return
+	}
+
+	var i int
+	for i < len(l.locs) && l.locs[i].ts < l.maxTs-l.horizon {
+		i++
+	}
+	l.locs = l.locs[i:]
+}
+
+// at returns the file and line of the entry handed on; the line is zero when unknown.
+func (l *locatorT) at() (string, int64) {
+	if !l.known {
+		return l.file, 0
+	}
+	return l.file, l.next
+}
+
+// locate sets the file and line of the hit entries.
+func (l *locatorT) locate(hits *matchz.HitsT) {
+	for i := range hits.Entries {
+		e := &hits.Entries[i]
+		for j := len(l.locs) - 1; j >= 0; j-- {
+			if loc := l.locs[j]; loc.ts == e.Timestamp && loc.line == string(e.Entry) {
+				e.File, e.Line = loc.file, loc.n
+				break
+			}
+		}
+	}
+}
+
+// locateHorizon returns how long after an entry a rule can still report it: the longest rule
+// window with its nested windows, negate windows and slides. Rules with several terms and no
+// window match across the whole log.
+func locateHorizon(rules []*parser.RulesT) int64 {
+
+	var h int64
+
+	for _, rs := range rules {
+		for _, rule := range rs.Rules {
+			switch {
+			case rule.Rule.Sequence != nil:
+				s := rule.Rule.Sequence
+				h = max(h, windowHorizon(s.Window, s.Order, s.Negate, rs.TermsT))
+			case rule.Rule.Set != nil:
+				s := rule.Rule.Set
+				h = max(h, windowHorizon(s.Window, s.Match, s.Negate, rs.TermsT))
+			}
+		}
+	}
+
+	return h
+}
+
+func windowHorizon(window string, match, negate []parser.ParseTermT, named map[string]parser.ParseTermT) int64 {
+
+	w, ok := horizonDuration(window)
+	if !ok {
+		return math.MaxInt64
+	}
+
+	var nested, neg int64
+
+	for _, t := range match {
+		t, _ = namedTerm(t, named)
+		if w == 0 && (len(match) > 1 || t.Count > 1) {
+			return math.MaxInt64
+		}
+		nested = max(nested, termHorizon(t, named))
+	}
+
+	for _, t := range negate {
+		t, opts := namedTerm(t, named)
+		nested = max(nested, termHorizon(t, named))
+
+		if opts == nil {
+			continue
+		}
+
+		nw, ok1 := horizonDuration(opts.Window)
+		slide, ok2 := horizonDuration(opts.Slide)
+		if !ok1 || !ok2 {
+			return math.MaxInt64
+		}
+		neg = max(neg, addHorizon(nw, slide))
+	}
+
+	return addHorizon(addHorizon(w, nested), neg)
+}
+
+func termHorizon(t parser.ParseTermT, named map[string]parser.ParseTermT) int64 {
+	switch {
+	case t.Sequence != nil:
+		return windowHorizon(t.Sequence.Window, t.Sequence.Order, t.Sequence.Negate, named)
+	case t.Set != nil:
+		return windowHorizon(t.Set.Window, t.Set.Match, t.Set.Negate, named)
+	}
+	return 0
+}
+
+// namedTerm resolves a reference to a named term; the referencing term's negate options win.
+func namedTerm(t parser.ParseTermT, named map[string]parser.ParseTermT) (parser.ParseTermT, *parser.ParseNegateOptsT) {
+
+	opts := t.NegateOpts
+
+	if n, ok := named[t.StrValue]; ok && t.StrValue != "" {
+		t = n
+		if opts == nil {
+			opts = n.NegateOpts
+		}
+	}
+
+	return t, opts
+}
+
+// horizonDuration parses a window or slide as a positive duration; empty is zero.
+func horizonDuration(s string) (int64, bool) {
+
+	if s == "" {
+		return 0, true
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, false
+	}
+
+	return max(d.Nanoseconds(), -d.Nanoseconds()), true
+}
+
+func addHorizon(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
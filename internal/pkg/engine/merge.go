@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/prequel-dev/preq/internal/pkg/utils"
+	"github.com/prequel-dev/prequel-compiler/pkg/parser"
+	"gopkg.in/yaml.v3"
+)
+
+// ruleGroupT holds the rules of every file of one type, compiled together so
+// named terms are shared across the files of a rules directory.
+type ruleGroupT struct {
+	rt    utils.RuleTypeT
+	rules *parser.RulesT
+	files []string          // File of each rule
+	terms map[string]string // File of each named term
+}
+
+// readRuleGroups reads the rule files and merges those of the same type, in the order first seen.
+func readRuleGroups(paths []utils.RulePathT, sel selectFuncT) ([]*ruleGroupT, error) {
+
+	var (
+		groups = make([]*ruleGroupT, 0)
+		byType = make(map[utils.RuleTypeT]*ruleGroupT)
+	)
+
+	for _, path := range paths {
+
+		rs, err := readRulePath(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if sel != nil {
+			sel(rs)
+		}
+
+		g, ok := byType[path.Type]
+		if !ok {
+			g = newRuleGroup(path.Type)
+			byType[path.Type] = g
+			groups = append(groups, g)
+		}
+
+		if err = g.add(path.Path, rs); err != nil {
+			return nil, err
+		}
+	}
+
+	return groups, nil
+}
+
+func newRuleGroup(rt utils.RuleTypeT) *ruleGroupT {
+	return &ruleGroupT{
+		rt: rt,
+		rules: &parser.RulesT{
+			Rules:  make([]parser.ParseRuleT, 0),
+			Root:   &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"},
+			TermsT: make(map[string]parser.ParseTermT),
+			TermsY: make(map[string]*yaml.Node),
+		},
+		terms: make(map[string]string),
+	}
+}
+
+// add appends the rules and named terms of a file. The parser looks up each rule's
+// node by index, so the rule nodes are appended in the same order.
+func (g *ruleGroupT) add(path string, rs *parser.RulesT) error {
+
+	for name := range rs.TermsT {
+		if prev, ok := g.terms[name]; ok {
+			return fmt.Errorf("%w: %s in %s and %s", parser.ErrDuplicateTerm, name, prev, path)
+		}
+	}
+
+	for name, term := range rs.TermsT {
+		g.rules.TermsT[name] = term
+		g.rules.TermsY[name] = rs.TermsY[name]
+		g.terms[name] = path
+	}
+
+	g.rules.Rules = append(g.rules.Rules, rs.Rules...)
+
+	if rs.Root != nil {
+		g.rules.Root.Content = append(g.rules.Root.Content, rs.Root.Content...)
+	}
+
+	for range rs.Rules {
+		g.files = append(g.files, path)
+	}
+
+	return nil
+}
+
+// paths returns the files in the group, in load order.
+func (g *ruleGroupT) paths() []string {
+
+	var (
+		paths = make([]string, 0)
+		seen  = make(map[string]struct{})
+	)
+
+	for _, fn := range g.files {
+		if _, ok := seen[fn]; !ok {
+			seen[fn] = struct{}{}
+			paths = append(paths, fn)
+		}
+	}
+
+	return paths
+}
@@ -0,0 +1,250 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prequel-dev/preq/internal/pkg/resolve"
+	"github.com/prequel-dev/prequel-logmatch/pkg/entry"
+	"github.com/prequel-dev/prequel-logmatch/pkg/scanner"
+	"github.com/rs/zerolog/log"
+)
+
+// groupT is scanner middleware that delivers multi-line records (stack traces, panics) as a single entry.
+type groupT struct {
+	spec    *resolve.MultilineT
+	scanF   scanner.ScanFuncT
+	pending entry.LogEntry
+	builder strings.Builder
+	nLines  int
+	last    int64
+}
+
+func newGroup(spec *resolve.MultilineT, scanF scanner.ScanFuncT) *groupT {
+	return &groupT{
+		spec:  spec,
+		scanF: scanF,
+	}
+}
+
+func (g *groupT) Append(e entry.LogEntry) bool {
+
+	if g.nLines == 0 {
+		g.start(e)
+		return false
+	}
+
+	if g.nLines < g.spec.MaxLines &&
+		!g.spec.Expired(g.last, e.Timestamp) &&
+		g.spec.IsContinuation(e.Line) {
+
+		g.append(e.Line)
+		g.last = e.Timestamp
+		return false
+	}
+
+	done := g.Flush()
+	g.start(e)
+	return done
+}
+
+// AppendErr treats lines that fail timestamp parsing as continuations of the pending entry.
+func (g *groupT) AppendErr(line []byte, err error) error {
+
+	switch {
+	case errors.Is(err, resolve.ErrLineDropped):
+	case g.nLines == 0, !utf8.Valid(line):
+		log.Trace().
+			Err(err).
+			Str("line", string(line)).
+			Msg("Fail line parse; no pending entry")
+	case g.nLines >= g.spec.MaxLines:
+		log.Trace().
+			Int("maxLines", g.spec.MaxLines).
+			Msg("Multiline entry is full; drop line")
+	default:
+		g.append(string(line))
+	}
+
+	return nil
+}
+
+func (g *groupT) Flush() bool {
+	if g.nLines == 0 {
+		return false
+	}
+
+	if g.nLines > 1 {
+		g.pending.Line = g.builder.String()
+	}
+
+	g.builder.Reset()
+	g.nLines = 0
+
+	return g.scanF(g.pending)
+}
+
+func (g *groupT) start(e entry.LogEntry) {
+	g.pending = e
+	g.last = e.Timestamp
+	g.nLines = 1
+}
+
+func (g *groupT) append(line string) {
+	if g.nLines == 1 {
+		g.builder.WriteString(g.pending.Line)
+	}
+	g.builder.WriteByte('\n')
+	g.builder.WriteString(line)
+	g.nLines += 1
+}
+
+// foldT appends lines that fail parsing to the pending entry, like scanner fold. Whether to fold is
+// asked on each line since streams that switch format can switch between folding and not.
+//
+// With a parser that switches format, lines that may start the next format are held until the
+// next entry is read. They are then read again if the format changed, or folded if it did not.
+type foldT struct {
+	fold    func() bool
+	scanF   scanner.ScanFuncT
+	pending entry.LogEntry
+	builder strings.Builder
+	ok      bool
+	parser  resolve.FoldParserI
+	held    []heldLineT
+	at      func(back int) // Sets the line an entry read again starts on, back lines before the current one
+}
+
+type heldLineT struct {
+	line []byte
+	err  error
+}
+
+func newFold(fold func() bool, scanF scanner.ScanFuncT) *foldT {
+	return &foldT{
+		fold:  fold,
+		scanF: scanF,
+	}
+}
+
+// newRedetectFold returns a fold that holds lines while the parser decides whether the format changed.
+func newRedetectFold(parser resolve.FoldParserI, scanF scanner.ScanFuncT) *foldT {
+	f := newFold(parser.Fold, scanF)
+	f.parser = parser
+	return f
+}
+
+func (f *foldT) Append(e entry.LogEntry) bool {
+	done := f.release()
+	done = f.flush() || done
+	f.pending = e
+	f.ok = true
+	return done
+}
+
+func (f *foldT) AppendErr(line []byte, err error) error {
+
+	// Lines after a held line are held with it to keep their order
+	if f.parser != nil && (len(f.held) > 0 || errors.Is(err, resolve.ErrLineHeld)) {
+		f.held = append(f.held, heldLineT{line: bytes.Clone(line), err: err})
+		return nil
+	}
+
+	return f.appendErr(line, err)
+}
+
+// release reads the held lines again if the format changed, each one that parses starting
+// an entry, and folds the rest as they would have been.
+func (f *foldT) release() bool {
+
+	if f.parser == nil {
+		return false
+	}
+
+	var (
+		switched = f.parser.Switched()
+		held     = f.held
+		moved    bool
+		done     bool
+	)
+
+	f.held = nil
+
+	for i, h := range held {
+		if switched {
+			e, err := f.parser.Reparse(h.line)
+			if err == nil {
+				if f.at != nil {
+					f.at(len(held) - i)
+					moved = true
+				}
+				done = f.flush() || done
+				f.pending = e
+				f.ok = true
+				continue
+			}
+			h.err = err
+		}
+		f.appendErr(h.line, h.err)
+	}
+
+	if moved {
+		f.at(0)
+	}
+
+	return done
+}
+
+func (f *foldT) appendErr(line []byte, err error) error {
+
+	switch {
+	case errors.Is(err, resolve.ErrLineDropped):
+	case !f.fold():
+		return parseErr(line, err)
+	case !f.ok, !utf8.Valid(line):
+		log.Trace().
+			Err(err).
+			Str("line", string(line)).
+			Msg("Fail line parse; no pending entry")
+	default:
+		if f.builder.Len() == 0 {
+			f.builder.WriteString(f.pending.Line)
+		}
+		f.builder.Write(line)
+	}
+
+	return nil
+}
+
+func (f *foldT) Flush() bool {
+	done := f.release()
+	return f.flush() || done
+}
+
+func (f *foldT) flush() bool {
+	if !f.ok {
+		return false
+	}
+
+	if f.builder.Len() > 0 {
+		f.pending.Line = f.builder.String()
+		f.builder.Reset()
+	}
+
+	f.ok = false
+
+	return f.scanF(f.pending)
+}
+
+// parseErr tolerates badly formed lines when entries are not folded; dropped lines are expected.
+func parseErr(line []byte, err error) error {
+	if !errors.Is(err, resolve.ErrLineDropped) {
+		log.Error().
+			Err(err).
+			Str("line", string(line)).
+			Msg("Fail parse.  Continue...")
+	}
+	return nil
+}
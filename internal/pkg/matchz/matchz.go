@@ -13,9 +13,13 @@ type HitsT struct {
 type EntryT struct {
 	Timestamp int64
 	Entry     []byte
+	File      string // Log the entry was read from when the run records locations
+	Line      int64  // 1-based line of the entry in File; zero when unknown, as when tailing
 }
 
 type EntityMetadataT struct {
-	FileName string
-	Origin   bool
+	FileName    string
+	Origin      bool
+	Approximate bool   // Windowed result over synthetic timestamps
+	Source      string // Name of the log source the entries were read from
 }
@@ -0,0 +1,161 @@
+package resolve
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"time"
+
+	"github.com/prequel-dev/preq/internal/pkg/timez"
+)
+
+type StampT struct {
+	Line      int
+	Timestamp time.Time
+}
+
+type FailedLineT struct {
+	Line int
+	Text string
+	Err  error
+}
+
+// DiagnosisT explains how the timestamp format of a log sample was detected.
+type DiagnosisT struct {
+	Factory    string
+	Source     string
+	Index      int
+	Spec       FmtSpec
+	Line       int
+	Fold       bool
+	Multiline  bool
+	Stamps     []StampT
+	Failed     []FailedLineT
+	Suggestion *timez.SuggestionT
+	Err        error
+}
+
+// ReadSample reads up to the detection sample size from the reader, decompressing gzip files by name.
+func ReadSample(fn string, r io.Reader) ([]byte, error) {
+
+	rd, err := newReader(fn, r)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, detectSampleSize)
+	n, err := io.ReadFull(rd, buf)
+	switch err {
+	case nil, io.ErrUnexpectedEOF, io.EOF:
+	default:
+		return nil, err
+	}
+
+	return buf[:n], nil
+}
+
+// Diagnose runs format detection on a sample and parses up to maxLines entries with the selected format.
+func Diagnose(data []byte, maxLines int, opts ...OptT) *DiagnosisT {
+
+	var (
+		o = parseOpts(opts...)
+		d = &DiagnosisT{
+			Multiline: o.multiline != nil,
+		}
+	)
+
+	det, err := detectFactory(data, o)
+	if err != nil {
+		d.Err = err
+		d.Suggestion = suggest(data, maxLines)
+		return d
+	}
+
+	d.Factory = det.factory.String()
+	d.Source = det.source
+	d.Index = det.index
+	d.Spec = det.spec
+	d.Fold = shouldFold(det.factory) && o.multiline == nil
+
+	var (
+		parser  = det.factory.New()
+		scanner = bufio.NewScanner(bytes.NewReader(data))
+		lineNo  int
+	)
+
+	for scanner.Scan() && len(d.Stamps) < maxLines {
+		lineNo += 1
+
+		entry, err := parser.ReadEntry(scanner.Bytes())
+		if err != nil {
+			if len(d.Failed) < maxLines {
+				d.Failed = append(d.Failed, FailedLineT{
+					Line: lineNo,
+					Text: scanner.Text(),
+					Err:  err,
+				})
+			}
+			continue
+		}
+
+		if d.Line == 0 {
+			d.Line = lineNo
+		}
+
+		d.Stamps = append(d.Stamps, StampT{
+			Line:      lineNo,
+			Timestamp: time.Unix(0, entry.Timestamp).UTC(),
+		})
+	}
+
+	return d
+}
+
+// StampLines detects the timestamp format from the start of data and parses the timestamp
+// of every line. Lines without a timestamp get the zero time.
+func StampLines(data []byte, opts ...OptT) ([]time.Time, error) {
+
+	var (
+		o      = parseOpts(opts...)
+		sample = data[:min(len(data), detectSampleSize)]
+	)
+
+	det, err := detectFactory(sample, o)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		parser  = det.factory.New()
+		scanner = bufio.NewScanner(bytes.NewReader(data))
+		stamps  []time.Time
+	)
+
+	for scanner.Scan() {
+		var ts time.Time
+		if entry, err := parser.ReadEntry(scanner.Bytes()); err == nil {
+			ts = time.Unix(0, entry.Timestamp).UTC()
+		}
+		stamps = append(stamps, ts)
+	}
+
+	return stamps, scanner.Err()
+}
+
+func suggest(data []byte, maxLines int) *timez.SuggestionT {
+
+	var (
+		lines   []string
+		scanner = bufio.NewScanner(bytes.NewReader(data))
+	)
+
+	for scanner.Scan() && len(lines) < maxLines {
+		lines = append(lines, scanner.Text())
+	}
+
+	if s, ok := timez.Suggest(lines); ok {
+		return &s
+	}
+
+	return nil
+}
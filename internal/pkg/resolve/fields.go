@@ -0,0 +1,243 @@
+package resolve
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	FieldParserLogfmt   = "logfmt"
+	FieldParserCombined = "combined"
+	FieldParserNginx    = "nginx"
+	FieldParserApache   = "apache"
+	FieldParserRegex    = "regex"
+
+	// RawField holds the original line in extracted documents.
+	RawField = "_raw"
+
+	rawPrefix = `{"` + RawField + `":`
+)
+
+var (
+	ErrFieldParserType    = errors.New("unknown parser type")
+	ErrFieldParserPattern = errors.New("regex parser requires a pattern with named groups")
+)
+
+// NCSA combined log format, shared by the nginx and apache defaults.
+var combinedExp = regexp.MustCompile(
+	`^(?P<remote_addr>\S+) \S+ (?P<remote_user>\S+) \[(?P<time_local>[^\]]+)\] ` +
+		`"(?P<method>\S+) (?P<path>\S+) (?P<protocol>[^"]+)" (?P<status>\d{3}) (?P<bytes>\d+|-)` +
+		`(?: "(?P<referer>[^"]*)" "(?P<user_agent>[^"]*)")?`,
+)
+
+var combinedNumbers = map[string]struct{}{
+	"status": {},
+	"bytes":  {},
+}
+
+// FieldParserT turns each line into a JSON document so jq and field terms work on unstructured logs:
+//
+//	parser:
+//	  type: logfmt          # key=value pairs
+//	parser:
+//	  type: nginx           # or apache, combined: NCSA combined access log
+//	parser:
+//	  type: regex           # named groups become fields
+//	  pattern: '^(?P<level>[A-Z]+) \[(?P<thread>[^\]]+)\] (?P<msg>.*)$'
+//
+// The original line is kept under "_raw" and shown in the report. Only rules with jq terms see the document;
+// their raw and regex terms match "_raw". Other rules match the original line.
+type FieldParserT struct {
+	Type    string `yaml:"type"`
+	Pattern string `yaml:"pattern,omitempty"`
+
+	exp     *regexp.Regexp
+	numbers map[string]struct{}
+}
+
+func (p *FieldParserT) Compile() (err error) {
+
+	switch p.Type {
+	case FieldParserLogfmt:
+	case FieldParserCombined, FieldParserNginx, FieldParserApache:
+		p.exp = combinedExp
+		p.numbers = combinedNumbers
+	case FieldParserRegex:
+		if p.Pattern == "" {
+			return ErrFieldParserPattern
+		}
+		if p.exp, err = regexp.Compile(p.Pattern); err != nil {
+			return err
+		}
+		if !hasNamedGroup(p.exp) {
+			return ErrFieldParserPattern
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrFieldParserType, p.Type)
+	}
+
+	return nil
+}
+
+// Extract returns the line as a JSON document with the original line first under "_raw".
+// Lines that do not parse only have "_raw"; ok reports whether fields were extracted.
+func (p *FieldParserT) Extract(line string) (doc string, ok bool) {
+
+	var fields map[string]any
+
+	switch p.Type {
+	case FieldParserLogfmt:
+		fields = parseLogfmt(line)
+	default:
+		fields = p.extractRegex(line)
+	}
+
+	// Marshaling a string cannot fail
+	raw, _ := json.Marshal(line)
+
+	delete(fields, RawField)
+	if len(fields) == 0 {
+		return rawPrefix + string(raw) + "}", false
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return rawPrefix + string(raw) + "}", false
+	}
+
+	return rawPrefix + string(raw) + "," + string(data[1:]), true
+}
+
+func (p *FieldParserT) extractRegex(line string) map[string]any {
+
+	m := p.exp.FindStringSubmatch(line)
+	if m == nil {
+		return nil
+	}
+
+	fields := make(map[string]any, len(m))
+	for i, name := range p.exp.SubexpNames() {
+		if name == "" || i >= len(m) {
+			continue
+		}
+		if _, ok := p.numbers[name]; ok {
+			if n, err := strconv.ParseInt(m[i], 10, 64); err == nil {
+				fields[name] = n
+				continue
+			}
+		}
+		fields[name] = m[i]
+	}
+
+	return fields
+}
+
+// RawLine returns the original line of an extracted document. Only the leading "_raw"
+// string is decoded; other documents are returned as is.
+func RawLine(doc string) string {
+
+	s, ok := strings.CutPrefix(doc, rawPrefix)
+	if !ok {
+		return doc
+	}
+
+	raw, _, ok := unquote(s)
+	if !ok {
+		return doc
+	}
+
+	return raw
+}
+
+func hasNamedGroup(exp *regexp.Regexp) bool {
+	for _, name := range exp.SubexpNames() {
+		if name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseLogfmt parses key=value pairs. Values may be double quoted; bare keys are true.
+func parseLogfmt(line string) map[string]any {
+
+	var (
+		fields = make(map[string]any)
+		s      = line
+	)
+
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			break
+		}
+
+		end := strings.IndexAny(s, "= \t")
+		if end == 0 {
+			// Stray '='; not logfmt
+			return nil
+		}
+		if end == -1 {
+			fields[s] = true
+			break
+		}
+
+		key := s[:end]
+		s = s[end:]
+
+		if s[0] != '=' {
+			fields[key] = true
+			continue
+		}
+		s = s[1:]
+
+		if strings.HasPrefix(s, `"`) {
+			val, rest, ok := unquote(s)
+			if !ok {
+				return nil
+			}
+			fields[key] = val
+			s = rest
+			continue
+		}
+
+		end = strings.IndexAny(s, " \t")
+		if end == -1 {
+			end = len(s)
+		}
+		fields[key] = s[:end]
+		s = s[end:]
+	}
+
+	// A line of bare words is not logfmt
+	for _, v := range fields {
+		if _, ok := v.(string); ok {
+			return fields
+		}
+	}
+
+	return nil
+}
+
+// unquote reads a double quoted value from the start of s and returns the rest.
+func unquote(s string) (string, string, bool) {
+
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			val, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", false
+			}
+			return val, s[i+1:], true
+		}
+	}
+
+	return "", "", false
+}
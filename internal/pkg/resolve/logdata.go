@@ -48,6 +48,26 @@ func (ld *LogData) Size() int64 {
 	return total
 }
 
+// FieldParser returns the parser that extracts fields from the entries, or nil if none.
+func (ld *LogData) FieldParser() *FieldParserT {
+	for _, log := range ld.Logs {
+		if fp := log.FieldParser(); fp != nil {
+			return fp
+		}
+	}
+	return nil
+}
+
+// Synthetic returns true if any log in the collection uses synthetic timestamps.
+func (ld *LogData) Synthetic() bool {
+	for _, log := range ld.Logs {
+		if log.Synthetic() {
+			return true
+		}
+	}
+	return false
+}
+
 func (ld *LogData) Close() error {
 	var errList []error
 	for _, log := range ld.Logs {
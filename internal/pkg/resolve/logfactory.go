@@ -2,6 +2,9 @@ package resolve
 
 import (
 	"bytes"
+	"context"
+	"net/http"
+	"time"
 
 	"github.com/prequel-dev/preq/internal/pkg/timez"
 	"github.com/prequel-dev/prequel-logmatch/pkg/format"
@@ -46,44 +49,218 @@ func WithTimestampTries(tries int) func(*optsT) {
 	}
 }
 
+// WithYear pins the year for timestamp formats that do not carry one (e.g. RFC 3164).
+func WithYear(year int) func(*optsT) {
+	return func(o *optsT) {
+		o.year = year
+	}
+}
+
+// WithRefTime sets the reference time used to infer the year for timestamp formats that do not carry one.
+func WithRefTime(t time.Time) func(*optsT) {
+	return func(o *optsT) {
+		o.refTime = t
+	}
+}
+
+// withReverse resolves year-less timestamps for entries read newest first, when scanning back from the end of a file.
+func withReverse() func(*optsT) {
+	return func(o *optsT) {
+		o.reverse = true
+	}
+}
+
+// WithSynthetic assigns synthetic timestamps instead of detecting them; for logs that carry none.
+func WithSynthetic(mode timez.SyntheticMode) func(*optsT) {
+	return func(o *optsT) {
+		o.synthetic = mode
+	}
+}
+
+// WithTail limits scanning to the end of each file.
+func WithTail(tail *TailT) func(*optsT) {
+	return func(o *optsT) {
+		o.tail = tail
+	}
+}
+
+// WithTransforms sets the line pre-processing steps; see TransformT for where each step runs.
+func WithTransforms(ts TransformsT) func(*optsT) {
+	return func(o *optsT) {
+		o.transforms = ts
+	}
+}
+
+// WithFieldParser extracts fields from each entry into a JSON document before matching.
+func WithFieldParser(fp *FieldParserT) func(*optsT) {
+	return func(o *optsT) {
+		o.fields = fp
+	}
+}
+
+// WithContext bounds the requests of url locations; reads fail once it is done.
+func WithContext(ctx context.Context) func(*optsT) {
+	return func(o *optsT) {
+		o.ctx = ctx
+	}
+}
+
+// WithHeaders sets the request headers sent to url locations; see SourceT.Headers.
+func WithHeaders(hdr http.Header) func(*optsT) {
+	return func(o *optsT) {
+		o.headers = hdr
+	}
+}
+
+// rawTransforms are the transforms run on raw lines, before detection and parsing.
+func (o *optsT) rawTransforms() TransformsT {
+	raw, _ := o.transforms.split()
+	return raw
+}
+
+// entryTransforms are the transforms run on parsed entries.
+func (o *optsT) entryTransforms() TransformsT {
+	_, entry := o.transforms.split()
+	return entry
+}
+
+// wrapFactory returns a factory whose parsers run the raw line transforms.
+func (o *optsT) wrapFactory(f format.FactoryI) format.FactoryI {
+	raw := o.rawTransforms()
+	if len(raw) == 0 {
+		return f
+	}
+	return &transformFactoryT{FactoryI: f, ts: raw}
+}
+
 func (o *optsT) tryCustom() bool {
 	return o.customFmt != "" || o.customRegex != ""
 }
 
+const (
+	DetectAuto       = "auto"
+	DetectCustom     = "custom"
+	DetectTimestamps = "timestamps"
+	DetectSynthetic  = "synthetic"
+)
+
+// detectionT records which candidate produced the log factory.
+type detectionT struct {
+	factory format.FactoryI
+	stamp   int64
+	source  string
+	index   int
+	spec    FmtSpec
+}
+
 func NewLogFactory(data []byte, opts ...OptT) (format.FactoryI, int64, error) {
 	o := parseOpts(opts...)
 
+	raw := o.rawTransforms()
+	if len(raw) > 0 {
+		data = raw.applyLines(data)
+	}
+
+	d, err := detectFactory(data, o)
+	if err != nil {
+		return nil, 0, err
+	}
+	return o.wrapFactory(d.factory), d.stamp, nil
+}
+
+func detectFactory(data []byte, o *optsT) (d detectionT, err error) {
+
 	var (
-		err      error
-		stamp    int64
 		maxTries = o.timestampTries
-		factory  format.FactoryI
+		yopts    = o.yearOpts()
 	)
 
+	if o.synthetic != timez.SyntheticNone {
+		log.Info().Str("mode", string(o.synthetic)).Msg("Using synthetic timestamps")
+		d.source = DetectSynthetic
+		if d.factory, err = timez.NewSyntheticFactory(o.synthetic, o.refTime); err != nil {
+			return detectionT{}, err
+		}
+		d.stamp, err = d.factory.New().ReadTimestamp(bytes.NewReader(data))
+		return
+	}
+
 	log.Debug().Int("maxTries", maxTries).Msg("Trying custom timestamp format")
 
 	if o.tryCustom() {
-		return timez.TryTimestampFormat(o.customRegex, timez.TimestampFmt(o.customFmt), data, maxTries)
+		d.source = DetectCustom
+		d.spec = FmtSpec{Pattern: o.customRegex, Format: TimestampFmt(o.customFmt)}
+		d.factory, d.stamp, err = timez.TryTimestampFormat(o.customRegex, timez.TimestampFmt(o.customFmt), data, maxTries, yopts...)
+		return
 	}
 
 	// Detect format
-	if factory, stamp, err = format.Detect(bytes.NewReader(data)); err == nil {
-		return factory, stamp, nil
+	if d.factory, d.stamp, err = format.Detect(bytes.NewReader(data)); err == nil {
+		d.source = DetectAuto
+		return
 	}
 
-	// Failed to detect format, try timestamp regexes if any
-	for _, spec := range o.stampRegex {
-		if factory, stamp, err = timez.TryTimestampFormat(spec.Pattern, spec.Format, data, maxTries); err == nil {
-			break
+	// Failed to detect format, score every timestamp regex over the sample and keep the best fit
+	var (
+		best  timez.ScoreT
+		found bool
+	)
+
+	for idx, spec := range o.stampRegex {
+		factory, stamp, terr := timez.TryTimestampFormat(spec.Pattern, spec.Format, data, maxTries, yopts...)
+		if terr != nil {
+			err = terr
+			continue
+		}
+
+		score := timez.ScoreFactory(factory, data)
+
+		log.Debug().
+			Int("idx", idx).
+			Str("fmt", spec.Format.String()).
+			Int("lines", score.Lines).
+			Int("matched", score.Matched).
+			Int("ordered", score.Ordered).
+			Int("precision", score.Precision).
+			Msg("Scored timestamp format")
+
+		if found && !score.Better(best) {
+			continue
+		}
+
+		best, found = score, true
+		d = detectionT{
+			factory: factory,
+			stamp:   stamp,
+			source:  DetectTimestamps,
+			index:   idx,
+			spec:    spec,
 		}
 	}
 
-	if err != nil {
+	if !found {
 		log.Error().Err(err).Msg("Failed to detect timestamp format")
-		return nil, 0, err
+		return detectionT{}, err
 	}
 
-	return factory, stamp, nil
+	log.Info().
+		Int("idx", d.index).
+		Str("fmt", d.spec.Format.String()).
+		Str("pattern", d.spec.Pattern).
+		Int("matched", best.Matched).
+		Int("lines", best.Lines).
+		Msg("Selected best matching timestamp format")
+
+	return d, nil
+}
+
+// Only fold on Regex or rfc3339Nano; doesn't make sense on CRI or JSON
+func shouldFold(factory format.FactoryI) bool {
+	switch factory.String() {
+	case format.FactoryRegex, format.FactoryRfc3339Nano:
+		return true
+	}
+	return false
 }
 
 type optsT struct {
@@ -92,10 +269,34 @@ type optsT struct {
 	stampRegex     []FmtSpec
 	window         int64
 	timestampTries int
+	year           int
+	refTime        time.Time
+	reverse        bool
+	multiline      *MultilineT
+	synthetic      timez.SyntheticMode
+	tail           *TailT
+	transforms     TransformsT
+	fields         *FieldParserT
+	ctx            context.Context
+	headers        http.Header
+}
+
+func (o *optsT) yearOpts() []timez.OptT {
+	var opts []timez.OptT
+	if o.year != 0 {
+		opts = append(opts, timez.WithYear(o.year))
+	}
+	if !o.refTime.IsZero() {
+		opts = append(opts, timez.WithRefTime(o.refTime))
+	}
+	if o.reverse {
+		opts = append(opts, timez.WithReverse())
+	}
+	return opts
 }
 
 func parseOpts(opts ...OptT) *optsT {
-	o := &optsT{}
+	o := &optsT{ctx: context.Background()}
 	for _, opt := range opts {
 		opt(o)
 	}
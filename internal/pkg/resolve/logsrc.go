@@ -7,6 +7,8 @@ import (
 	"os"
 	"strings"
 
+	"github.com/klauspost/compress/zstd"
+	"github.com/prequel-dev/preq/internal/pkg/timez"
 	"github.com/prequel-dev/prequel-logmatch/pkg/format"
 	"github.com/rs/zerolog/log"
 )
@@ -17,17 +19,26 @@ type LogSrcI interface {
 	Name() string
 	Fold() bool
 	Window() int64
+	Multiline() *MultilineT
+	Synthetic() bool
+	Transforms() TransformsT
+	FieldParser() *FieldParserT
 	Parser() format.ParserI
+	Offset() int64 // Byte offset scanning starts at; nonzero when tailing
 }
 
 type logSrc struct {
 	sz      int64
+	start   int64
 	ts      int64
 	window  int64
 	fh      *os.File
 	rd      io.Reader
 	factory format.FactoryI
 	fold    bool
+	ml      *MultilineT
+	tr      TransformsT
+	fp      *FieldParserT
 }
 
 func newLogSrc(fn string, opts ...OptT) (src *logSrc, err error) {
@@ -45,6 +56,27 @@ func newLogSrc(fn string, opts ...OptT) (src *logSrc, err error) {
 		return
 	}
 
+	// Infer the year of year-less timestamps relative to the last write
+	if info, serr := fh.Stat(); serr == nil {
+		opts = append([]OptT{WithRefTime(info.ModTime())}, opts...)
+	}
+
+	o := parseOpts(opts...)
+
+	var start int64
+	if o.tail != nil {
+		var info os.FileInfo
+		if info, err = fh.Stat(); err != nil {
+			return
+		}
+		if start, err = tailStart(fn, fh, info.Size(), opts...); err != nil {
+			return
+		}
+		if _, err = fh.Seek(start, io.SeekStart); err != nil {
+			return
+		}
+	}
+
 	rd, err := newReader(fn, fh)
 	if err != nil {
 		return
@@ -59,14 +91,13 @@ func newLogSrc(fn string, opts ...OptT) (src *logSrc, err error) {
 	}
 	buffer = buffer[:n]
 
-	o := parseOpts(opts...)
 	factory, ts, err := NewLogFactory(buffer, opts...)
 
 	if err != nil {
 		return
 	}
 
-	if _, err = fh.Seek(0, io.SeekStart); err != nil {
+	if _, err = fh.Seek(start, io.SeekStart); err != nil {
 		return
 	}
 
@@ -75,40 +106,77 @@ func newLogSrc(fn string, opts ...OptT) (src *logSrc, err error) {
 	}
 
 	var sz int64 = -1
-	if !isGzip(fn) {
+	if !isCompressed(fn) {
 		if info, err := fh.Stat(); err == nil {
-			sz = info.Size()
+			sz = info.Size() - start
 		}
 	}
 
-	// Only fold on Regex or rfc3339Nano; doesn't make sense on CRI or JSON
-	var fold bool
-	switch factory.String() {
-	case format.FactoryRegex, format.FactoryRfc3339Nano:
-		fold = true
-	}
-
 	return &logSrc{
 		sz:      sz,
+		start:   start,
 		ts:      ts,
 		fh:      fh,
 		rd:      rd,
 		factory: factory,
 		window:  o.window,
-		fold:    fold,
+		fold:    shouldFold(factory),
+		ml:      o.multiline,
+		tr:      o.entryTransforms(),
+		fp:      o.fields,
 	}, nil
 }
 
+// tailStart returns the offset to start scanning from when tailing; compressed inputs are scanned in full.
+func tailStart(fn string, r io.ReaderAt, size int64, opts ...OptT) (int64, error) {
+
+	if isCompressed(fn) {
+		log.Warn().Str("path", fn).Msg("Cannot tail compressed log; scanning entire file")
+		return 0, nil
+	}
+
+	sample, err := tailSample(r, size)
+	if err != nil {
+		return 0, err
+	}
+
+	// The timestamp format is detected on the end of the file; it may start mid-entry.
+	// The tail is read backwards, so year-less timestamps are resolved from the last one written.
+	factory, err := detectTail(sample, append(opts, withReverse())...)
+	if err != nil {
+		return 0, err
+	}
+
+	start, err := tailOffset(r, size, parseOpts(opts...).tail, factory)
+	if err != nil {
+		return 0, err
+	}
+
+	// Skip continuation lines of an entry that started before the tail
+	return alignStart(r, start, factory)
+}
+
 func isGzip(fn string) bool {
 	return strings.HasSuffix(fn, ".gz") || strings.HasSuffix(fn, ".gzip")
 }
 
+func isZstd(fn string) bool {
+	return strings.HasSuffix(fn, ".zst") || strings.HasSuffix(fn, ".zstd")
+}
+
+func isCompressed(fn string) bool {
+	return isGzip(fn) || isZstd(fn)
+}
+
 func newReader(fn string, src io.Reader) (io.Reader, error) {
-	if !isGzip(fn) {
+	switch {
+	case isGzip(fn):
+		return gzip.NewReader(src)
+	case isZstd(fn):
+		return zstd.NewReader(src)
+	default:
 		return src, nil
 	}
-
-	return gzip.NewReader(src)
 }
 
 func (ls *logSrc) Size() int64 {
@@ -137,3 +205,23 @@ func (ls *logSrc) Fold() bool {
 func (ls *logSrc) Window() int64 {
 	return ls.window
 }
+
+func (ls *logSrc) Multiline() *MultilineT {
+	return ls.ml
+}
+
+func (ls *logSrc) Transforms() TransformsT {
+	return ls.tr
+}
+
+func (ls *logSrc) FieldParser() *FieldParserT {
+	return ls.fp
+}
+
+func (ls *logSrc) Synthetic() bool {
+	return timez.IsSynthetic(ls.factory)
+}
+
+func (ls *logSrc) Offset() int64 {
+	return ls.start
+}
@@ -0,0 +1,76 @@
+package resolve
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+const (
+	defaultMultilineMaxLines = 500
+)
+
+var (
+	ErrMultilinePattern = errors.New("multiline requires a start or continuation pattern")
+)
+
+// MultilineT groups consecutive lines (e.g. stack traces, panics) into a single entry.
+//
+// A line that matches Continuation, or does not match Start when no Continuation is set,
+// is appended to the pending entry. Lines that fail timestamp parsing are always continuations.
+type MultilineT struct {
+	Start        string        `yaml:"start,omitempty"`
+	Continuation string        `yaml:"continuation,omitempty"`
+	MaxLines     int           `yaml:"maxLines,omitempty"`
+	Timeout      time.Duration `yaml:"timeout,omitempty"`
+
+	start *regexp.Regexp
+	cont  *regexp.Regexp
+}
+
+func (m *MultilineT) Compile() (err error) {
+
+	if m.Start == "" && m.Continuation == "" {
+		return ErrMultilinePattern
+	}
+
+	if m.Start != "" {
+		if m.start, err = regexp.Compile(m.Start); err != nil {
+			return fmt.Errorf("multiline start: %w", err)
+		}
+	}
+
+	if m.Continuation != "" {
+		if m.cont, err = regexp.Compile(m.Continuation); err != nil {
+			return fmt.Errorf("multiline continuation: %w", err)
+		}
+	}
+
+	if m.MaxLines <= 0 {
+		m.MaxLines = defaultMultilineMaxLines
+	}
+
+	return nil
+}
+
+func (m *MultilineT) IsContinuation(line string) bool {
+	switch {
+	case m.cont != nil:
+		return m.cont.MatchString(line)
+	case m.start != nil:
+		return !m.start.MatchString(line)
+	}
+	return false
+}
+
+// Expired returns true if the gap between two grouped lines exceeds the timeout.
+func (m *MultilineT) Expired(last, ts int64) bool {
+	return m.Timeout > 0 && ts-last > int64(m.Timeout)
+}
+
+func WithMultiline(m *MultilineT) func(*optsT) {
+	return func(o *optsT) {
+		o.multiline = m
+	}
+}
@@ -0,0 +1,200 @@
+package resolve
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/prequel-dev/preq/internal/pkg/timez"
+	"github.com/prequel-dev/prequel-logmatch/pkg/format"
+	"github.com/rs/zerolog/log"
+)
+
+// candidatesT holds the factories tried when a stream switches format, in detection order.
+type candidatesT struct {
+	once      sync.Once
+	o         *optsT
+	factories []format.FactoryI
+}
+
+func newCandidates(o *optsT) *candidatesT {
+	return &candidatesT{o: o}
+}
+
+// compile builds the custom and timestamp regex factories once; auto detection runs per line.
+func (c *candidatesT) compile() {
+	c.once.Do(func() {
+
+		yopts := c.o.yearOpts()
+
+		if c.o.tryCustom() {
+			if f, err := timez.NewFactory(c.o.customRegex, TimestampFmt(c.o.customFmt), yopts...); err == nil {
+				c.factories = append(c.factories, f)
+			}
+		}
+
+		for _, spec := range c.o.stampRegex {
+			f, err := timez.NewFactory(spec.Pattern, spec.Format, yopts...)
+			if err != nil {
+				log.Warn().Err(err).Str("pattern", spec.Pattern).Msg("Skip invalid timestamp format")
+				continue
+			}
+			c.factories = append(c.factories, f)
+		}
+	})
+}
+
+// detect returns a parser for the first candidate that reads a timestamp from the line, and the entry it read.
+func (c *candidatesT) detect(line []byte) (format.ParserI, format.FactoryI, format.LogEntry, bool) {
+
+	// Candidates parse the raw line through the source transforms
+	try := func(f format.FactoryI) (format.ParserI, format.FactoryI, format.LogEntry, bool) {
+		f = c.o.wrapFactory(f)
+		p := f.New()
+		entry, err := p.ReadEntry(line)
+		return p, f, entry, err == nil && entry.Timestamp != 0
+	}
+
+	if !c.o.tryCustom() {
+		sample := line
+		if raw := c.o.rawTransforms(); len(raw) > 0 {
+			sample = raw.applyLines(line)
+		}
+
+		// Detect reads a newline terminated line
+		rdr := io.MultiReader(bytes.NewReader(sample), bytes.NewReader([]byte{'\n'}))
+		if f, _, err := format.Detect(rdr); err == nil {
+			if p, f, entry, ok := try(f); ok {
+				return p, f, entry, true
+			}
+		}
+	}
+
+	c.compile()
+
+	for _, f := range c.factories {
+		if p, f, entry, ok := try(f); ok {
+			return p, f, entry, true
+		}
+	}
+
+	return nil, nil, format.LogEntry{}, false
+}
+
+const (
+	redetectFailures   = 3    // Consecutive unrecognized lines before trying other formats
+	redetectMaxBackoff = 1024 // Most unrecognized lines skipped after detection found nothing
+)
+
+var (
+	ErrLineHeld = errors.New("unrecognized line held until the format is known")
+)
+
+// FoldParserI is implemented by parsers whose format, and so whether unparsed lines
+// fold into the previous entry, can change partway through a stream.
+//
+// Lines that may start the new format fail with ErrLineHeld. Once the next entry is read,
+// Switched reports whether the format changed, and if so the held lines are read again
+// with Reparse rather than folded into the entry before them.
+type FoldParserI interface {
+	format.ParserI
+	Fold() bool
+	Switched() bool
+	Reparse(line []byte) (format.LogEntry, error)
+}
+
+// redetectParserT switches to a newly detected format when the current parser stops recognizing lines,
+// e.g. on concatenated streams of previous and current container logs.
+//
+// Indented and blank lines are treated as continuations and never trigger detection. Detection
+// only runs after several consecutive unrecognized lines, so a stray unindented continuation
+// ("Caused by: ...") neither pays for detection nor flips the parser. When detection finds
+// nothing, the following unrecognized lines skip it with an increasing backoff.
+type redetectParserT struct {
+	cur      format.ParserI
+	factory  format.FactoryI
+	cands    *candidatesT
+	fails    int // Consecutive unrecognized lines
+	skip     int // Unrecognized lines left before detection runs again
+	backoff  int
+	switched bool // The format changed since Switched was last asked
+}
+
+func newRedetectParser(factory format.FactoryI, cands *candidatesT) *redetectParserT {
+	return &redetectParserT{
+		cur:     factory.New(),
+		factory: factory,
+		cands:   cands,
+	}
+}
+
+func (p *redetectParserT) ReadTimestamp(rdr io.Reader) (int64, error) {
+	return p.cur.ReadTimestamp(rdr)
+}
+
+// Fold reports whether lines the current format does not recognize are continuations.
+func (p *redetectParserT) Fold() bool {
+	return shouldFold(p.factory)
+}
+
+// Switched reports whether the format changed since the last call.
+func (p *redetectParserT) Switched() bool {
+	switched := p.switched
+	p.switched = false
+	return switched
+}
+
+// Reparse reads a line held before a switch with the current format.
+func (p *redetectParserT) Reparse(line []byte) (format.LogEntry, error) {
+	return p.cur.ReadEntry(line)
+}
+
+func (p *redetectParserT) ReadEntry(line []byte) (format.LogEntry, error) {
+
+	entry, err := p.cur.ReadEntry(line)
+	if err == nil {
+		p.fails = 0
+		return entry, nil
+	}
+
+	if isContinuation(line) || errors.Is(err, ErrLineDropped) {
+		return entry, err
+	}
+
+	// The line may start the next format, so hold it until detection has run
+	if p.fails++; p.fails < redetectFailures {
+		return entry, fmt.Errorf("%w: %w", ErrLineHeld, err)
+	}
+
+	if p.skip > 0 {
+		p.skip--
+		return entry, err
+	}
+
+	parser, factory, nentry, ok := p.cands.detect(line)
+	if !ok {
+		p.backoff = min(max(p.backoff*2, 1), redetectMaxBackoff)
+		p.skip = p.backoff
+		return entry, err
+	}
+
+	log.Info().
+		Str("from", p.factory.String()).
+		Str("to", factory.String()).
+		Msg("Log format changed; switching parser")
+
+	p.cur = parser
+	p.factory = factory
+	p.switched = true
+	p.fails = 0
+	p.skip = 0
+	p.backoff = 0
+
+	return nentry, nil
+}
+
+func isContinuation(line []byte) bool {
+	return len(bytes.TrimSpace(line)) == 0 || line[0] == ' ' || line[0] == '\t'
+}
@@ -9,6 +9,7 @@ import (
 
 	"path/filepath"
 
+	"github.com/prequel-dev/preq/internal/pkg/timez"
 	"github.com/prequel-dev/prequel-compiler/pkg/datasrc"
 	"github.com/rs/zerolog/log"
 )
@@ -26,9 +27,13 @@ type (
 )
 
 func Resolve(dss *DataSources, opts ...OptT) []*LogData {
+	return ResolveSources(ExtendSources(dss), opts...)
+}
+
+func ResolveSources(ss *SourcesT, opts ...OptT) []*LogData {
 	var sources []*LogData
 
-	for _, src := range dss.Sources {
+	for _, src := range ss.Sources {
 
 		dataSrc, err := resolveSource(src, opts...)
 		if err != nil {
@@ -45,7 +50,7 @@ func Resolve(dss *DataSources, opts ...OptT) []*LogData {
 	return sources
 }
 
-func resolveSource(src datasrc.Source, opts ...OptT) (*LogData, error) {
+func resolveSource(src SourceT, opts ...OptT) (*LogData, error) {
 	var (
 		errList []error
 	)
@@ -56,6 +61,43 @@ func resolveSource(src datasrc.Source, opts ...OptT) (*LogData, error) {
 		opts = append(opts, WithWindow(int64(src.Window)))
 	}
 
+	if src.Tail != nil {
+		opts = append(opts, WithTail(src.Tail))
+	}
+
+	if len(src.Transforms) > 0 {
+		if err := src.Transforms.Compile(); err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithTransforms(src.Transforms))
+	}
+
+	if src.Parser != nil {
+		if err := src.Parser.Compile(); err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithFieldParser(src.Parser))
+	}
+
+	if src.Synthetic != timez.SyntheticNone {
+		opts = append(opts, WithSynthetic(src.Synthetic))
+	}
+
+	if len(src.Headers) > 0 {
+		hdr, err := sourceHeaders(src.Headers)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithHeaders(hdr))
+	}
+
+	if src.Multiline != nil {
+		if err := src.Multiline.Compile(); err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithMultiline(src.Multiline))
+	}
+
 	for idx, location := range src.Locations {
 
 		switch location.Type {
@@ -71,6 +113,19 @@ func resolveSource(src datasrc.Source, opts ...OptT) (*LogData, error) {
 				errList = append(errList, err)
 			}
 
+		case urlType:
+			if usrc, err := resolveURL(location, ts, opts...); err == nil {
+				dataSrc := NewLogData([]LogSrcI{usrc}, src.Name, src.Type)
+				return dataSrc, nil
+			} else {
+				log.Info().
+					Err(err).
+					Int("idx", idx).
+					Str("url", location.Path).
+					Msg("Failed to resolve url source")
+				errList = append(errList, err)
+			}
+
 		default:
 			log.Info().
 				Int("idx", idx).
@@ -82,6 +137,34 @@ func resolveSource(src datasrc.Source, opts ...OptT) (*LogData, error) {
 	return nil, errors.Join(errList...)
 }
 
+func resolveURL(location datasrc.Location, ts *datasrc.Timestamp, opts ...OptT) (*urlSrc, error) {
+
+	if location.Timestamp != nil {
+		ts = location.Timestamp
+	}
+
+	if ts != nil && ts.Regex != "" && ts.Format != "" {
+		opts = append(opts, WithCustomFmt(ts.Regex, ts.Format))
+	}
+
+	if location.Window != 0 {
+		opts = append(opts, WithWindow(int64(location.Window)))
+	}
+
+	usrc, err := newURLSrc(location.Path, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Str("url", location.Path).
+		Str("format", usrc.factory.String()).
+		Int64("size", usrc.Size()).
+		Msg("Resolved url")
+
+	return usrc, nil
+}
+
 func resolveLog(location datasrc.Location, ts *datasrc.Timestamp, opts ...OptT) ([]LogSrcI, error) {
 
 	matches, err := filepath.Glob(location.Path)
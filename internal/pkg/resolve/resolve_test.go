@@ -1,13 +1,28 @@
 package resolve
 
 import (
+	"bytes"
 	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/klauspost/compress/zstd"
+	"github.com/prequel-dev/preq/internal/pkg/timez"
 	"github.com/prequel-dev/prequel-compiler/pkg/datasrc"
+	"github.com/prequel-dev/prequel-logmatch/pkg/format"
 )
 
 func createTestFile(t *testing.T, dir, name, content string, useGzip bool) string {
@@ -157,3 +172,784 @@ func TestPipeStdin(t *testing.T) {
 		t.Fatalf("Expected PipeStdin to return 1 LogData source, but got %d", len(results))
 	}
 }
+
+func TestParseSourcesMultiline(t *testing.T) {
+	data := []byte(`
+version: 0.0.1
+sources:
+  - name: java
+    type: cre.log.java
+    multiline:
+      start: '^\d{4}-\d{2}-\d{2} '
+      timeout: 5s
+    locations:
+      - path: /var/log/app.log
+  - name: plain
+    type: log
+    locations:
+      - path: /var/log/plain.log
+`)
+
+	ss, err := ParseSources(data)
+	if err != nil {
+		t.Fatalf("ParseSources failed: %v", err)
+	}
+
+	if err := ss.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	if len(ss.Sources) != 2 {
+		t.Fatalf("Expected 2 sources, got %d", len(ss.Sources))
+	}
+
+	ml := ss.Sources[0].Multiline
+	if ml == nil {
+		t.Fatal("Expected multiline settings on first source")
+	}
+	if ml.MaxLines != defaultMultilineMaxLines {
+		t.Errorf("Expected default max lines %d, got %d", defaultMultilineMaxLines, ml.MaxLines)
+	}
+	if !ml.IsContinuation("\tat com.example.Foo") || ml.IsContinuation("2025-01-01 next") {
+		t.Error("Unexpected continuation result")
+	}
+	if ss.Sources[1].Multiline != nil {
+		t.Error("Expected no multiline settings on second source")
+	}
+	if ss.DataSources().Sources[0].Locations[0].Path != "/var/log/app.log" {
+		t.Error("Expected inline compiler source fields to be parsed")
+	}
+
+	bad := &SourcesT{Sources: []SourceT{{Multiline: &MultilineT{}}}}
+	if err := bad.Validate(); err != ErrMultilinePattern {
+		t.Errorf("Expected ErrMultilinePattern, got %v", err)
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	t.Run("Detected", func(t *testing.T) {
+		data := []byte("2025-01-02T03:04:05Z one\nno timestamp\n2025-01-02T03:04:06Z two\n")
+		d := Diagnose(data, 10)
+		if d.Err != nil {
+			t.Fatalf("Diagnose failed: %v", d.Err)
+		}
+		if d.Source != DetectAuto {
+			t.Errorf("Expected source %q, got %q", DetectAuto, d.Source)
+		}
+		if len(d.Stamps) != 2 || d.Stamps[0].Line != 1 || d.Stamps[1].Line != 3 {
+			t.Errorf("Unexpected stamps: %+v", d.Stamps)
+		}
+		if len(d.Failed) != 1 || d.Failed[0].Line != 2 {
+			t.Errorf("Unexpected failed lines: %+v", d.Failed)
+		}
+	})
+
+	t.Run("Suggestion", func(t *testing.T) {
+		data := []byte("12/Mar/2024:10:00:01 +0000 GET /\n")
+		d := Diagnose(data, 10, WithStampRegex())
+		if d.Err == nil {
+			t.Fatal("Expected detection error")
+		}
+		if d.Suggestion == nil {
+			t.Fatal("Expected a suggestion")
+		}
+		if d.Suggestion.Format != "02/Jan/2006:15:04:05 -0700" {
+			t.Errorf("Unexpected format %q", d.Suggestion.Format)
+		}
+	})
+
+	t.Run("StampLines", func(t *testing.T) {
+		data := []byte("2025-01-02T03:04:05Z one\nno timestamp\n2025-01-02T03:04:06Z two\n")
+		stamps, err := StampLines(data)
+		if err != nil {
+			t.Fatalf("StampLines failed: %v", err)
+		}
+		if len(stamps) != 3 || !stamps[1].IsZero() || stamps[2].Sub(stamps[0]) != time.Second {
+			t.Errorf("Unexpected stamps: %v", stamps)
+		}
+	})
+}
+
+func TestBestMatchTimestampFormat(t *testing.T) {
+	data := []byte(`header
+{"timestamp":"2025-01-02T03:04:05Z","event":"start"}
+{"ts":"2025-01-02 03:04:06.250","event":"a"}
+{"ts":"2025-01-02 03:04:07.500","event":"b"}
+{"ts":"2025-01-02 03:04:08.750","event":"c"}
+`)
+
+	d, err := detectFactory(data, parseOpts(
+		WithTimestampTries(5),
+		WithStampRegex(
+			FmtSpec{Pattern: `"timestamp"\s*:\s*"([^"]+)"`, Format: "rfc3339"},
+			FmtSpec{Pattern: `"ts"\s*:\s*"([^"]+)"`, Format: "2006-01-02 15:04:05.000"},
+		),
+	))
+	if err != nil {
+		t.Fatalf("detectFactory failed: %v", err)
+	}
+
+	if d.source != DetectTimestamps || d.index != 1 {
+		t.Errorf("Expected timestamps[1], got %s[%d]", d.source, d.index)
+	}
+}
+
+func TestTail(t *testing.T) {
+	t.Run("ParseTail", func(t *testing.T) {
+		tests := []struct {
+			spec string
+			want TailT
+		}{
+			{"1000", TailT{Lines: 1000}},
+			{"64MB", TailT{Bytes: 64 << 20}},
+			{"512kb", TailT{Bytes: 512 << 10}},
+			{"2h", TailT{Since: 2 * time.Hour}},
+			{"10m", TailT{Since: 10 * time.Minute}},
+		}
+		for _, tc := range tests {
+			got, err := ParseTail(tc.spec)
+			if err != nil {
+				t.Errorf("ParseTail(%q) failed: %v", tc.spec, err)
+				continue
+			}
+			if *got != tc.want {
+				t.Errorf("ParseTail(%q) = %+v, want %+v", tc.spec, *got, tc.want)
+			}
+		}
+		for _, spec := range []string{"", "0", "-5", "lots"} {
+			if _, err := ParseTail(spec); err == nil {
+				t.Errorf("Expected error for %q", spec)
+			}
+		}
+	})
+
+	var (
+		dir   = t.TempDir()
+		lines = []string{
+			"2025-01-01T00:00:00Z old",
+			"2025-01-01T01:00:00Z older",
+			"2025-01-01T02:00:00Z recent",
+			"  continuation of recent",
+			"2025-01-01T02:30:00Z latest",
+		}
+		path = filepath.Join(dir, "tail.log")
+	)
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write log: %v", err)
+	}
+
+	readTail := func(t *testing.T, tail *TailT) string {
+		t.Helper()
+		src, err := newLogSrc(path, WithTail(tail))
+		if err != nil {
+			t.Fatalf("newLogSrc failed: %v", err)
+		}
+		defer src.Close()
+		data, err := io.ReadAll(src)
+		if err != nil {
+			t.Fatalf("ReadAll failed: %v", err)
+		}
+		return string(data)
+	}
+
+	t.Run("Lines", func(t *testing.T) {
+		if got := readTail(t, &TailT{Lines: 3}); got != strings.Join(lines[2:], "\n")+"\n" {
+			t.Errorf("Unexpected tail: %q", got)
+		}
+		// A tail that starts mid-entry skips the orphaned continuation
+		if got := readTail(t, &TailT{Lines: 2}); got != lines[4]+"\n" {
+			t.Errorf("Unexpected tail: %q", got)
+		}
+	})
+
+	t.Run("Bytes", func(t *testing.T) {
+		want := lines[4] + "\n"
+		if got := readTail(t, &TailT{Bytes: int64(len(want) + 3)}); got != want {
+			t.Errorf("Unexpected tail: %q", got)
+		}
+	})
+
+	t.Run("Since", func(t *testing.T) {
+		if got := readTail(t, &TailT{Since: time.Hour}); got != strings.Join(lines[2:], "\n")+"\n" {
+			t.Errorf("Unexpected tail: %q", got)
+		}
+	})
+
+	t.Run("Since across a year boundary", func(t *testing.T) {
+		var (
+			yl = []string{
+				"Dec 31 22:00:00 host app: old",
+				"Dec 31 23:50:00 host app: before midnight",
+				"Jan  1 00:05:00 host app: after midnight",
+			}
+			yp    = filepath.Join(dir, "syslog.log")
+			mtime = time.Date(2026, time.January, 1, 0, 6, 0, 0, time.UTC)
+		)
+		if err := os.WriteFile(yp, []byte(strings.Join(yl, "\n")+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write log: %v", err)
+		}
+		if err := os.Chtimes(yp, mtime, mtime); err != nil {
+			t.Fatalf("Chtimes failed: %v", err)
+		}
+
+		src, err := newLogSrc(yp, WithTail(&TailT{Since: 30 * time.Minute}), WithStampRegex(
+			FmtSpec{Pattern: `^([A-Z][a-z]{2}\s{1,2}\d{1,2}\s\d{2}:\d{2}:\d{2})`, Format: "Jan 2 15:04:05"},
+		))
+		if err != nil {
+			t.Fatalf("newLogSrc failed: %v", err)
+		}
+		defer src.Close()
+		data, err := io.ReadAll(src)
+		if err != nil {
+			t.Fatalf("ReadAll failed: %v", err)
+		}
+
+		// December entries are in the year before the last write, not after it
+		if got := string(data); got != strings.Join(yl[1:], "\n")+"\n" {
+			t.Errorf("Unexpected tail: %q", got)
+		}
+	})
+
+	t.Run("Yaml", func(t *testing.T) {
+		ss, err := ParseSources([]byte(`
+sources:
+  - name: short
+    type: log
+    tail: 2h
+    locations:
+      - path: /var/log/a.log
+  - name: long
+    type: log
+    tail:
+      lines: 500
+    locations:
+      - path: /var/log/b.log
+`))
+		if err != nil {
+			t.Fatalf("ParseSources failed: %v", err)
+		}
+		if ss.Sources[0].Tail.Since != 2*time.Hour || ss.Sources[1].Tail.Lines != 500 {
+			t.Errorf("Unexpected tails: %+v %+v", ss.Sources[0].Tail, ss.Sources[1].Tail)
+		}
+	})
+}
+
+func TestPipeRedetect(t *testing.T) {
+
+	read := func(t *testing.T, lines []string) ([]string, *redetectParserT) {
+		t.Helper()
+
+		rdr, err := newPipeReader(strings.NewReader(strings.Join(lines, "\n")), WithStampRegex(
+			FmtSpec{Pattern: `^(\S+) `, Format: timez.FmtRfc3339},
+		))
+		if err != nil {
+			t.Fatalf("newPipeReader failed: %v", err)
+		}
+
+		parser, ok := rdr.Parser().(*redetectParserT)
+		if !ok {
+			t.Fatalf("Expected a redetect parser, got %T", rdr.Parser())
+		}
+
+		var got []string
+		for _, line := range lines {
+			entry, err := parser.ReadEntry([]byte(line))
+			if err != nil {
+				got = append(got, "")
+				continue
+			}
+			got = append(got, time.Unix(0, entry.Timestamp).UTC().Format(time.RFC3339))
+		}
+
+		return got, parser
+	}
+
+	t.Run("switches after consecutive unrecognized lines", func(t *testing.T) {
+		got, parser := read(t, []string{
+			`{"log":"previous container\n","stream":"stdout","time":"2025-01-01T00:00:01Z"}`,
+			`{"log":"crashed\n","stream":"stderr","time":"2025-01-01T00:00:02Z"}`,
+			`2025-01-01T00:01:00Z current container`,
+			`	indented continuation`,
+			`2025-01-01T00:01:01Z starting`,
+			`2025-01-01T00:01:02Z listening`,
+			`2025-01-01T00:01:03Z ready`,
+		})
+
+		want := []string{
+			"2025-01-01T00:00:01Z",
+			"2025-01-01T00:00:02Z",
+			"",
+			"",
+			"",
+			"2025-01-01T00:01:02Z",
+			"2025-01-01T00:01:03Z",
+		}
+
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+		if !parser.Fold() {
+			t.Errorf("Expected the text format to fold continuation lines")
+		}
+	})
+
+	t.Run("held lines are read again after a switch", func(t *testing.T) {
+		lines := []string{
+			`{"log":"previous container\n","stream":"stdout","time":"2025-01-01T00:00:01Z"}`,
+			`2025-01-01T00:01:00Z current container`,
+			`2025-01-01T00:01:01Z starting`,
+			`2025-01-01T00:01:02Z listening`,
+		}
+
+		rdr, err := newPipeReader(strings.NewReader(strings.Join(lines, "\n")))
+		if err != nil {
+			t.Fatalf("newPipeReader failed: %v", err)
+		}
+		parser := rdr.Parser().(*redetectParserT)
+
+		for i, line := range lines {
+			_, err := parser.ReadEntry([]byte(line))
+			switch i {
+			case 1, 2:
+				if !errors.Is(err, ErrLineHeld) {
+					t.Errorf("Expected line %d held, got %v", i+1, err)
+				}
+			default:
+				if err != nil {
+					t.Errorf("Expected line %d to parse, got %v", i+1, err)
+				}
+			}
+		}
+
+		if !parser.Switched() || parser.Switched() {
+			t.Fatalf("Expected the switch reported once")
+		}
+
+		entry, err := parser.Reparse([]byte(lines[1]))
+		if err != nil || time.Unix(0, entry.Timestamp).UTC().Format(time.RFC3339) != "2025-01-01T00:01:00Z" {
+			t.Errorf("Expected the held line read with the new format, got %v, %v", entry, err)
+		}
+	})
+
+	t.Run("stray lines do not switch", func(t *testing.T) {
+		got, parser := read(t, []string{
+			`2025-01-01T00:00:01Z java.lang.IllegalStateException: boom`,
+			`Caused by: java.io.IOException: disk`,
+			`2025-01-01T00:00:02Z retrying`,
+			`{"log":"stray\n","stream":"stdout","time":"2025-01-01T00:00:03Z"}`,
+			`2025-01-01T00:00:04Z ok`,
+		})
+
+		want := []string{"2025-01-01T00:00:01Z", "", "2025-01-01T00:00:02Z", "", "2025-01-01T00:00:04Z"}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+		if parser.factory.String() != format.FactoryRfc3339Nano {
+			t.Errorf("Expected the parser to stay on %s, got %s", format.FactoryRfc3339Nano, parser.factory)
+		}
+	})
+
+	t.Run("backs off when detection finds nothing", func(t *testing.T) {
+		lines := []string{`2025-01-01T00:00:01Z start`}
+		for range 10 {
+			lines = append(lines, "no timestamp here")
+		}
+
+		_, parser := read(t, lines)
+
+		// Detection ran on the 3rd and 5th unrecognized lines, then backed off 4 lines
+		if parser.backoff != 4 || parser.skip != 2 {
+			t.Errorf("Expected backoff 4 with 2 lines to skip, got %d and %d", parser.backoff, parser.skip)
+		}
+	})
+}
+
+func TestTransforms(t *testing.T) {
+	ss, err := ParseSources([]byte(`
+sources:
+  - name: app
+    type: cre.log.app
+    transforms:
+      - type: json
+        field: .log
+      - type: ansi
+      - type: replace
+        match: '^\[(web|worker)\] '
+        replace: '$1: '
+      - type: drop
+        match: 'GET /healthz'
+    locations:
+      - path: /var/log/app.log
+`))
+	if err != nil {
+		t.Fatalf("ParseSources failed: %v", err)
+	}
+	if err := ss.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	ts := ss.Sources[0].Transforms
+
+	tests := []struct {
+		line string
+		want string
+		keep bool
+	}{
+		{`{"log":"[web] \u001b[31mERROR\u001b[0m boom\n","stream":"stderr"}`, "web: ERROR boom", true},
+		{"[worker] plain line", "worker: plain line", true},
+		{`{"log":"[web] GET /healthz 200\n"}`, "", false},
+		{`{"other":"field"}`, `{"other":"field"}`, true},
+	}
+
+	for _, tc := range tests {
+		got, keep := ts.Apply(tc.line)
+		if keep != tc.keep || got != tc.want {
+			t.Errorf("Apply(%q) = %q, %v; want %q, %v", tc.line, got, keep, tc.want, tc.keep)
+		}
+	}
+
+	t.Run("Keep", func(t *testing.T) {
+		ts := TransformsT{{Type: TransformKeep, Match: "ERROR"}}
+		if err := ts.Compile(); err != nil {
+			t.Fatalf("Compile failed: %v", err)
+		}
+		if _, keep := ts.Apply("INFO ok"); keep {
+			t.Error("Expected line to be dropped")
+		}
+		if _, keep := ts.Apply("ERROR bad"); !keep {
+			t.Error("Expected line to be kept")
+		}
+	})
+
+	t.Run("Before parsing", func(t *testing.T) {
+		ts := TransformsT{
+			{Type: TransformAnsi},
+			{Type: TransformReplace, Match: `^\[(web|worker)\] `},
+			{Type: TransformDrop, Match: "GET /healthz"},
+		}
+		if err := ts.Compile(); err != nil {
+			t.Fatalf("Compile failed: %v", err)
+		}
+
+		lines := []string{
+			"\x1b[2m[web] 2025-01-01T00:00:01Z\x1b[0m starting",
+			"[worker] 2025-01-01T00:00:02Z GET /healthz 200",
+			"[worker] 2025-01-01T00:00:03Z ERROR boom",
+		}
+
+		factory, _, err := NewLogFactory([]byte(strings.Join(lines, "\n")), WithTransforms(ts))
+		if err != nil {
+			t.Fatalf("NewLogFactory failed: %v", err)
+		}
+
+		parser := factory.New()
+
+		entry, err := parser.ReadEntry([]byte(lines[0]))
+		if err != nil || time.Unix(0, entry.Timestamp).UTC().Format(time.RFC3339) != "2025-01-01T00:00:01Z" {
+			t.Errorf("Expected the timestamp behind the prefix, got %v, %v", entry, err)
+		}
+
+		if _, err := parser.ReadEntry([]byte(lines[1])); !errors.Is(err, ErrLineDropped) {
+			t.Errorf("Expected ErrLineDropped, got %v", err)
+		}
+
+		if entry, err = parser.ReadEntry([]byte(lines[2])); err != nil || !strings.Contains(entry.Line, "ERROR boom") {
+			t.Errorf("Expected the transformed entry, got %v, %v", entry, err)
+		}
+	})
+
+	t.Run("Json unwrap runs on entries", func(t *testing.T) {
+		ts := TransformsT{{Type: TransformAnsi}, {Type: TransformJSON, Field: "log"}, {Type: TransformDrop, Match: "x"}}
+		raw, entry := ts.split()
+		if len(raw) != 1 || len(entry) != 2 {
+			t.Errorf("Expected 1 raw and 2 entry transforms, got %d and %d", len(raw), len(entry))
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, ts := range []TransformsT{
+			{{Type: "upper"}},
+			{{Type: TransformDrop}},
+			{{Type: TransformJSON}},
+			{{Type: TransformReplace, Match: "("}},
+		} {
+			if err := ts.Compile(); err == nil {
+				t.Errorf("Expected error for %+v", ts[0])
+			}
+		}
+	})
+}
+
+func TestFieldParser(t *testing.T) {
+	tests := []struct {
+		name   string
+		parser FieldParserT
+		line   string
+		want   map[string]any
+	}{
+		{
+			name:   "Logfmt",
+			parser: FieldParserT{Type: FieldParserLogfmt},
+			line:   `level=error msg="disk \"data\" full" retry`,
+			want:   map[string]any{"level": "error", "msg": `disk "data" full`, "retry": true},
+		},
+		{
+			name:   "Nginx",
+			parser: FieldParserT{Type: FieldParserNginx},
+			line:   `10.0.0.1 - - [12/Mar/2024:10:00:01 +0000] "GET /api/v1 HTTP/1.1" 502 157 "-" "curl/8.0"`,
+			want: map[string]any{
+				"remote_addr": "10.0.0.1", "remote_user": "-", "time_local": "12/Mar/2024:10:00:01 +0000",
+				"method": "GET", "path": "/api/v1", "protocol": "HTTP/1.1", "status": float64(502), "bytes": float64(157),
+				"referer": "-", "user_agent": "curl/8.0",
+			},
+		},
+		{
+			name:   "Regex",
+			parser: FieldParserT{Type: FieldParserRegex, Pattern: `^(?P<level>[A-Z]+) \[(?P<thread>[^\]]+)\] (?P<msg>.*)$`},
+			line:   "WARN [pool-1] slow query",
+			want:   map[string]any{"level": "WARN", "thread": "pool-1", "msg": "slow query"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.parser.Compile(); err != nil {
+				t.Fatalf("Compile failed: %v", err)
+			}
+
+			doc, ok := tc.parser.Extract(tc.line)
+			if !ok {
+				t.Fatalf("Extract failed on %q", tc.line)
+			}
+
+			var got map[string]any
+			if err := json.Unmarshal([]byte(doc), &got); err != nil {
+				t.Fatalf("Invalid document %q: %v", doc, err)
+			}
+
+			tc.want[RawField] = tc.line
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Extract = %v, want %v", got, tc.want)
+			}
+
+			if raw := RawLine(doc); raw != tc.line {
+				t.Errorf("RawLine = %q, want %q", raw, tc.line)
+			}
+		})
+	}
+
+	t.Run("NoMatch", func(t *testing.T) {
+		p := FieldParserT{Type: FieldParserLogfmt}
+		if err := p.Compile(); err != nil {
+			t.Fatalf("Compile failed: %v", err)
+		}
+		doc, ok := p.Extract(`just "some" words`)
+		if ok || doc != `{"_raw":"just \"some\" words"}` {
+			t.Errorf("Expected only the raw line, got %q", doc)
+		}
+		if raw := RawLine(doc); raw != `just "some" words` {
+			t.Errorf("RawLine = %q", raw)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, p := range []FieldParserT{
+			{Type: "xml"},
+			{Type: FieldParserRegex},
+			{Type: FieldParserRegex, Pattern: `^(\w+)$`},
+		} {
+			if err := p.Compile(); err == nil {
+				t.Errorf("Expected error for %+v", p)
+			}
+		}
+	})
+}
+
+func TestURLSource(t *testing.T) {
+	var lines []string
+	for i := 0; i < 200; i++ {
+		lines = append(lines, fmt.Sprintf("2025-01-01T00:%02d:%02dZ line %d", i/60, i%60, i))
+	}
+	content := []byte(strings.Join(lines, "\n") + "\n")
+
+	var zcontent bytes.Buffer
+	zw, err := zstd.NewWriter(&zcontent)
+	if err != nil {
+		t.Fatalf("zstd writer failed: %v", err)
+	}
+	zw.Write(content)
+	zw.Close()
+
+	var (
+		modTime = time.Date(2025, time.January, 1, 1, 0, 0, 0, time.UTC)
+		cut     atomic.Bool
+	)
+
+	var leaked atomic.Bool
+	other := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The client itself only drops Authorization across hosts
+		if r.Header.Get("Authorization") != "" || r.Header.Get("X-Api-Key") != "" {
+			leaked.Store(true)
+		}
+		http.ServeContent(w, r, r.URL.Path, modTime, bytes.NewReader(content))
+	}))
+	defer other.Close()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved.log":
+			http.Redirect(w, r, other.URL+"/app.log", http.StatusFound)
+			return
+		case "/renamed.log":
+			http.Redirect(w, r, "/app.log", http.StatusFound)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		data := content
+		if strings.HasSuffix(r.URL.Path, ".zst") {
+			data = zcontent.Bytes()
+		}
+
+		// Drop the connection half way through the first full download
+		if r.URL.Path == "/flaky.log" && r.Method == http.MethodGet && r.Header.Get("Range") == "" && cut.CompareAndSwap(false, true) {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.WriteHeader(http.StatusOK)
+			w.Write(data[:len(data)/2])
+			w.(http.Flusher).Flush()
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+
+		http.ServeContent(w, r, r.URL.Path, modTime, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	// Both test servers share a certificate
+	tr := httpClient.Transport.(*http.Transport)
+	cfg := tr.TLSClientConfig
+	tr.TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+	defer func() { tr.TLSClientConfig = cfg }()
+
+	t.Setenv("PREQ_TEST_AUTH", "Bearer secret")
+	t.Setenv("PREQ_TEST_KEY", "key")
+
+	headers := map[string]string{"Authorization": "PREQ_TEST_AUTH", "X-Api-Key": "PREQ_TEST_KEY"}
+	hdr, err := sourceHeaders(headers)
+	if err != nil {
+		t.Fatalf("sourceHeaders failed: %v", err)
+	}
+
+	readURL := func(t *testing.T, path string, opts ...OptT) (*urlSrc, string) {
+		t.Helper()
+		src, err := newURLSrc(srv.URL+path, append(opts, WithHeaders(hdr))...)
+		if err != nil {
+			t.Fatalf("newURLSrc failed: %v", err)
+		}
+		defer src.Close()
+		data, err := io.ReadAll(src)
+		if err != nil {
+			t.Fatalf("ReadAll failed: %v", err)
+		}
+		return src, string(data)
+	}
+
+	t.Run("Plain", func(t *testing.T) {
+		src, data := readURL(t, "/app.log")
+		if src.Size() != int64(len(content)) {
+			t.Errorf("Expected size %d, got %d", len(content), src.Size())
+		}
+		if data != string(content) {
+			t.Error("Content mismatch")
+		}
+	})
+
+	t.Run("Zstd", func(t *testing.T) {
+		src, data := readURL(t, "/app.log.zst")
+		if src.Size() != -1 {
+			t.Errorf("Expected unknown size for compressed object, got %d", src.Size())
+		}
+		if data != string(content) {
+			t.Error("Content mismatch")
+		}
+	})
+
+	t.Run("Tail", func(t *testing.T) {
+		src, data := readURL(t, "/app.log", WithTail(&TailT{Lines: 3}))
+		want := strings.Join(lines[197:], "\n") + "\n"
+		if data != want {
+			t.Errorf("Unexpected tail: %q", data)
+		}
+		if src.Size() != int64(len(want)) {
+			t.Errorf("Expected size %d, got %d", len(want), src.Size())
+		}
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		if _, data := readURL(t, "/flaky.log"); data != string(content) {
+			t.Errorf("Content mismatch after resume: got %d bytes", len(data))
+		}
+		if !cut.Load() {
+			t.Error("Expected the first download to be cut")
+		}
+	})
+
+	t.Run("Unauthorized", func(t *testing.T) {
+		if _, err := newURLSrc(srv.URL + "/app.log"); err == nil {
+			t.Error("Expected error without credentials")
+		}
+	})
+
+	t.Run("MissingEnv", func(t *testing.T) {
+		if _, err := sourceHeaders(map[string]string{"Authorization": "PREQ_TEST_UNSET"}); !errors.Is(err, ErrURLHeaderEnv) {
+			t.Errorf("Expected ErrURLHeaderEnv, got %v", err)
+		}
+	})
+
+	t.Run("Insecure", func(t *testing.T) {
+		u := strings.Replace(srv.URL, "https://", "http://", 1) + "/app.log"
+		if _, err := newURLSrc(u, WithHeaders(hdr)); !errors.Is(err, ErrURLInsecureHeaders) {
+			t.Errorf("Expected ErrURLInsecureHeaders, got %v", err)
+		}
+	})
+
+	t.Run("Redirect", func(t *testing.T) {
+		if _, data := readURL(t, "/renamed.log"); data != string(content) {
+			t.Error("Content mismatch after same host redirect")
+		}
+		if _, data := readURL(t, "/moved.log"); data != string(content) {
+			t.Error("Content mismatch after cross host redirect")
+		}
+		if leaked.Load() {
+			t.Error("Headers sent to another host")
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := newURLSrc(srv.URL+"/app.log", WithHeaders(hdr), WithContext(ctx)); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+
+	t.Run("Resolve", func(t *testing.T) {
+		ld, err := resolveSource(SourceT{Source: datasrc.Source{
+			Name:      "remote",
+			Type:      "cre.log.app",
+			Locations: []datasrc.Location{{Type: urlType, Path: srv.URL + "/app.log"}},
+		}, Headers: headers})
+		if err != nil {
+			t.Fatalf("resolveSource failed: %v", err)
+		}
+		defer ld.Close()
+		if ld.Size() != int64(len(content)) {
+			t.Errorf("Expected size %d, got %d", len(content), ld.Size())
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package resolve
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/prequel-dev/preq/internal/pkg/timez"
+	"github.com/prequel-dev/prequel-compiler/pkg/datasrc"
+	"gopkg.in/yaml.v2"
+)
+
+// SourcesT extends the compiler data sources schema with preq specific per-source settings:
+//
+//	sources:
+//	  - name: my-java-app
+//	    type: cre.log.java
+//	    multiline:
+//	      start: '^\d{4}-\d{2}-\d{2} '
+//	      maxLines: 200
+//	      timeout: 5s
+//	    locations:
+//	      - path: /var/log/app.log
+//	  - name: my-batch-job
+//	    type: cre.log.batch
+//	    synthetic: line
+//	    locations:
+//	      - path: /var/log/job.out
+//	  - name: my-busy-app
+//	    type: cre.log.app
+//	    tail: 2h
+//	    locations:
+//	      - path: /var/log/busy.log
+//
+// Synthetic timestamps ("line" or "mtime") are assigned to logs that carry none.
+// Tail limits scanning to the end of each file; see TailT.
+// Transforms pre-process each entry before matching; see TransformT.
+// Parser extracts fields from unstructured lines for jq and field terms; see FieldParserT.
+//
+// Locations of type "url" stream a remote object over HTTP(S). Headers are sent only to the
+// url locations of their source and only over https; each value is read from the named
+// environment variable:
+//
+//	sources:
+//	  - name: archive
+//	    type: cre.log.app
+//	    headers:
+//	      Authorization: ARCHIVE_AUTH   # e.g. ARCHIVE_AUTH="Bearer ..."
+//	    locations:
+//	      - type: url
+//	        path: https://logs.example.com/app.log.gz
+type SourcesT struct {
+	Version string    `yaml:"version"`
+	Sources []SourceT `yaml:"sources"`
+}
+
+type SourceT struct {
+	datasrc.Source `yaml:",inline"`
+	Multiline      *MultilineT         `yaml:"multiline,omitempty"`
+	Synthetic      timez.SyntheticMode `yaml:"synthetic,omitempty"`
+	Tail           *TailT              `yaml:"tail,omitempty"`
+	Transforms     TransformsT         `yaml:"transforms,omitempty"`
+	Parser         *FieldParserT       `yaml:"parser,omitempty"`
+	Headers        map[string]string   `yaml:"headers,omitempty"`
+}
+
+func ParseSources(data []byte) (*SourcesT, error) {
+	var ss SourcesT
+	if err := yaml.Unmarshal(data, &ss); err != nil {
+		return nil, err
+	}
+	return &ss, nil
+}
+
+func ParseSourcesFile(fn string) (*SourcesT, error) {
+
+	data, err := os.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseSources(data)
+}
+
+// ExtendSources wraps plain compiler data sources with no preq specific settings.
+func ExtendSources(dss *DataSources) *SourcesT {
+	ss := &SourcesT{
+		Version: dss.Version,
+		Sources: make([]SourceT, 0, len(dss.Sources)),
+	}
+
+	for _, src := range dss.Sources {
+		ss.Sources = append(ss.Sources, SourceT{Source: src})
+	}
+
+	return ss
+}
+
+// DataSources returns the compiler view of the sources.
+func (ss *SourcesT) DataSources() *DataSources {
+	dss := &DataSources{
+		Version: ss.Version,
+		Sources: make([]datasrc.Source, 0, len(ss.Sources)),
+	}
+
+	for _, src := range ss.Sources {
+		dss.Sources = append(dss.Sources, src.Source)
+	}
+
+	return dss
+}
+
+func (ss *SourcesT) Validate() error {
+
+	if err := datasrc.Validate(ss.DataSources()); err != nil {
+		return err
+	}
+
+	for _, src := range ss.Sources {
+		if err := src.Synthetic.Validate(); err != nil {
+			return fmt.Errorf("%w: %s", err, src.Synthetic)
+		}
+		if err := src.Transforms.Compile(); err != nil {
+			return err
+		}
+		if src.Parser != nil {
+			if err := src.Parser.Compile(); err != nil {
+				return err
+			}
+		}
+		if src.Tail != nil {
+			if err := src.Tail.Validate(); err != nil {
+				return err
+			}
+		}
+		if src.Multiline == nil {
+			continue
+		}
+		if err := src.Multiline.Compile(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 
+	"github.com/prequel-dev/preq/internal/pkg/timez"
 	"github.com/prequel-dev/prequel-logmatch/pkg/format"
 	"github.com/rs/zerolog/log"
 )
@@ -37,6 +38,22 @@ func PipeEval(data []byte, opts ...OptT) ([]*LogData, error) {
 	}, nil
 }
 
+// PipeEvalSource returns in-memory logs of one source type as a single data source.
+func PipeEvalSource(name, srcType string, data [][]byte, opts ...OptT) (*LogData, error) {
+
+	logs := make([]LogSrcI, 0, len(data))
+
+	for _, d := range data {
+		rdr, err := newPipeReader(bytes.NewReader(d), opts...)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, rdr)
+	}
+
+	return NewLogData(logs, name, srcType), nil
+}
+
 func newPipeReader(r io.Reader, opts ...OptT) (*PipeRdrT, error) {
 	// Read a sample to detect format
 	buf := make([]byte, detectSampleSize)
@@ -57,19 +74,16 @@ func newPipeReader(r io.Reader, opts ...OptT) (*PipeRdrT, error) {
 		return nil, err
 	}
 
-	// Only fold on Regex or rfc3339Nano; doesn't make sense on CRI or JSON
-	var fold bool
-	switch factory.String() {
-	case format.FactoryRegex, format.FactoryRfc3339Nano:
-		fold = true
-	}
-
 	return &PipeRdrT{
 		src:      r,
 		prologue: bytes.NewBuffer(buf),
 		factory:  factory,
 		window:   o.window,
-		fold:     fold,
+		fold:     shouldFold(factory),
+		ml:       o.multiline,
+		cands:    newCandidates(o),
+		tr:       o.entryTransforms(),
+		fp:       o.fields,
 	}, nil
 }
 
@@ -94,10 +108,18 @@ type PipeRdrT struct {
 	prologue *bytes.Buffer
 	factory  format.FactoryI
 	fold     bool
+	ml       *MultilineT
+	cands    *candidatesT
+	tr       TransformsT
+	fp       *FieldParserT
 }
 
+// Parser follows format changes in the stream, e.g. several files concatenated into one pipe.
 func (p *PipeRdrT) Parser() format.ParserI {
-	return p.factory.New()
+	if timez.IsSynthetic(p.factory) {
+		return p.factory.New()
+	}
+	return newRedetectParser(p.factory, p.cands)
 }
 
 func (p *PipeRdrT) Close() error {
@@ -120,6 +142,26 @@ func (p *PipeRdrT) Window() int64 {
 	return p.window
 }
 
+func (p *PipeRdrT) Multiline() *MultilineT {
+	return p.ml
+}
+
+func (p *PipeRdrT) Transforms() TransformsT {
+	return p.tr
+}
+
+func (p *PipeRdrT) FieldParser() *FieldParserT {
+	return p.fp
+}
+
+func (p *PipeRdrT) Synthetic() bool {
+	return timez.IsSynthetic(p.factory)
+}
+
+func (p *PipeRdrT) Offset() int64 {
+	return 0
+}
+
 func (p *PipeRdrT) Read(b []byte) (int, error) {
 	if p.prologue != nil {
 		n, err := p.prologue.Read(b)
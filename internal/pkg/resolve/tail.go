@@ -0,0 +1,251 @@
+package resolve
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/icza/backscanner"
+	"github.com/prequel-dev/preq/internal/pkg/timez"
+	"github.com/prequel-dev/prequel-logmatch/pkg/format"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrTailSpec = errors.New("tail requires exactly one of bytes, lines or since")
+)
+
+var tailUnits = []struct {
+	suffix string
+	mult   int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// TailT limits scanning to the end of each file: the last Bytes, the last Lines,
+// or the entries within Since of the last timestamp in the file.
+//
+// In a data sources file it is either a mapping or the short form accepted by ParseTail:
+//
+//	tail: 64MB
+//	tail:
+//	  since: 2h
+type TailT struct {
+	Bytes int64         `yaml:"bytes,omitempty"`
+	Lines int           `yaml:"lines,omitempty"`
+	Since time.Duration `yaml:"since,omitempty"`
+}
+
+// ParseTail parses a tail spec: a line count ("1000"), a size ("64MB"; B, KB, MB or GB) or a duration ("2h").
+func ParseTail(s string) (*TailT, error) {
+
+	s = strings.TrimSpace(s)
+
+	if n, err := strconv.Atoi(s); err == nil {
+		t := &TailT{Lines: n}
+		return t, t.Validate()
+	}
+
+	upper := strings.ToUpper(s)
+	for _, u := range tailUnits {
+		if !strings.HasSuffix(upper, u.suffix) {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(s[:len(s)-len(u.suffix)]), 10, 64)
+		if err != nil {
+			break
+		}
+		t := &TailT{Bytes: n * u.mult}
+		return t, t.Validate()
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrTailSpec, s)
+	}
+
+	t := &TailT{Since: d}
+	return t, t.Validate()
+}
+
+func (t *TailT) UnmarshalYAML(unmarshal func(any) error) error {
+
+	var s string
+	if err := unmarshal(&s); err == nil {
+		pt, err := ParseTail(s)
+		if err != nil {
+			return err
+		}
+		*t = *pt
+		return nil
+	}
+
+	type tailT TailT
+	return unmarshal((*tailT)(t))
+}
+
+func (t *TailT) Validate() error {
+
+	var n int
+	if t.Bytes > 0 {
+		n += 1
+	}
+	if t.Lines > 0 {
+		n += 1
+	}
+	if t.Since > 0 {
+		n += 1
+	}
+
+	if n != 1 || t.Bytes < 0 || t.Lines < 0 || t.Since < 0 {
+		return ErrTailSpec
+	}
+
+	return nil
+}
+
+// tailSample returns up to the detection sample size from the end of the input, starting on a line boundary.
+func tailSample(r io.ReaderAt, size int64) ([]byte, error) {
+
+	var (
+		off = max(0, size-detectSampleSize)
+		buf = make([]byte, size-off)
+	)
+
+	n, err := r.ReadAt(buf, off)
+	switch err {
+	case nil, io.EOF:
+	default:
+		return nil, err
+	}
+	buf = buf[:n]
+
+	if off > 0 {
+		if idx := bytes.IndexByte(buf, '\n'); idx != -1 {
+			buf = buf[idx+1:]
+		}
+	}
+
+	return buf, nil
+}
+
+// detectTail detects the format of a tail sample, dropping leading lines that belong to an earlier entry.
+func detectTail(sample []byte, opts ...OptT) (format.FactoryI, error) {
+
+	var (
+		factory format.FactoryI
+		err     error
+	)
+
+	for i := 0; i < timez.DefaultSkip && len(sample) > 0; i++ {
+		if factory, _, err = NewLogFactory(sample, opts...); err == nil {
+			return factory, nil
+		}
+
+		idx := bytes.IndexByte(sample, '\n')
+		if idx == -1 {
+			break
+		}
+		sample = sample[idx+1:]
+	}
+
+	return nil, err
+}
+
+// alignStart moves the start offset forward to the first line with a timestamp.
+func alignStart(r io.ReaderAt, start int64, factory format.FactoryI) (int64, error) {
+
+	buf := make([]byte, detectSampleSize)
+	n, err := r.ReadAt(buf, start)
+	switch err {
+	case nil, io.EOF:
+	default:
+		return 0, err
+	}
+
+	var (
+		parser = factory.New()
+		off    int64
+	)
+
+	for _, line := range bytes.SplitAfter(buf[:n], []byte{'\n'}) {
+		if entry, err := parser.ReadEntry(bytes.TrimRight(line, "\r\n")); err == nil && entry.Timestamp != 0 {
+			return start + off, nil
+		}
+		off += int64(len(line))
+	}
+
+	return start, nil
+}
+
+// tailOffset scans backwards from the end of the input and returns the offset of the first line to scan.
+// The factory is only used when tailing by duration; its parsers must read the entries newest first.
+func tailOffset(r io.ReaderAt, size int64, t *TailT, factory format.FactoryI) (int64, error) {
+
+	var (
+		sc     = backscanner.New(r, int(size))
+		start  = size
+		lines  int
+		latest int64
+		parser format.ParserI
+	)
+
+	if t.Since > 0 {
+		parser = factory.New()
+	}
+
+LOOP:
+	for {
+		line, pos, err := sc.LineBytes()
+		switch {
+		case err == io.EOF:
+			break LOOP
+		case err != nil:
+			return 0, err
+		}
+
+		// Skip the empty line after a trailing newline
+		if int64(pos) == size && len(line) == 0 {
+			continue
+		}
+
+		switch {
+		case t.Bytes > 0:
+			if size-int64(pos) > t.Bytes {
+				break LOOP
+			}
+		case t.Lines > 0:
+			if lines += 1; lines > t.Lines {
+				break LOOP
+			}
+		case t.Since > 0:
+			entry, err := parser.ReadEntry(line)
+			if err != nil || entry.Timestamp == 0 {
+				// Continuation lines are kept with the entry that precedes them
+				continue
+			}
+			if latest == 0 {
+				latest = entry.Timestamp
+			}
+			if entry.Timestamp < latest-int64(t.Since) {
+				break LOOP
+			}
+		}
+
+		start = int64(pos)
+	}
+
+	log.Debug().
+		Int64("size", size).
+		Int64("offset", start).
+		Msg("Tail offset")
+
+	return start, nil
+}
@@ -0,0 +1,229 @@
+package resolve
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/prequel-dev/prequel-logmatch/pkg/format"
+)
+
+const (
+	TransformAnsi    = "ansi"
+	TransformReplace = "replace"
+	TransformDrop    = "drop"
+	TransformKeep    = "keep"
+	TransformJSON    = "json"
+)
+
+var (
+	ErrTransformType  = errors.New("unknown transform type")
+	ErrTransformMatch = errors.New("transform requires a match pattern")
+	ErrTransformField = errors.New("json transform requires a field")
+	ErrLineDropped    = errors.New("line dropped by transform")
+)
+
+var (
+	ansiExp = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)`)
+)
+
+// TransformT is a single line pre-processing step, applied in order before matchers see the entry.
+// Steps before the first json unwrap run on the raw line, before timestamps are detected and parsed,
+// so they can strip colors or a prefix in front of the timestamp. The json unwrap and later steps run
+// on the parsed entry, since unwrapping drops the fields container log parsers read timestamps from:
+//
+//	transforms:
+//	  - type: ansi                # strip ANSI color and cursor sequences
+//	  - type: json                # replace the line with a JSON field
+//	    field: log
+//	  - type: replace             # regex replace; supports $1 expansion
+//	    match: '^\[[a-z-]+\] '
+//	    replace: ''
+//	  - type: drop                # drop entries that match
+//	    match: 'GET /healthz'
+//	  - type: keep                # drop entries that do not match
+//	    match: 'ERROR|WARN'
+type TransformT struct {
+	Type    string `yaml:"type"`
+	Match   string `yaml:"match,omitempty"`
+	Replace string `yaml:"replace,omitempty"`
+	Field   string `yaml:"field,omitempty"`
+
+	exp  *regexp.Regexp
+	path []string
+}
+
+type TransformsT []TransformT
+
+func (ts TransformsT) Compile() error {
+	for i := range ts {
+		if err := ts[i].compile(); err != nil {
+			return fmt.Errorf("transform %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (t *TransformT) compile() (err error) {
+
+	switch t.Type {
+	case TransformAnsi:
+	case TransformReplace, TransformDrop, TransformKeep:
+		if t.Match == "" {
+			return ErrTransformMatch
+		}
+		if t.exp, err = regexp.Compile(t.Match); err != nil {
+			return err
+		}
+	case TransformJSON:
+		field := strings.TrimPrefix(t.Field, ".")
+		if field == "" {
+			return ErrTransformField
+		}
+		t.path = strings.Split(field, ".")
+	default:
+		return fmt.Errorf("%w: %s", ErrTransformType, t.Type)
+	}
+
+	return nil
+}
+
+// split returns the steps that run on raw lines and the steps that run on parsed entries.
+func (ts TransformsT) split() (raw, entry TransformsT) {
+	i := slices.IndexFunc(ts, func(t TransformT) bool {
+		return t.Type == TransformJSON
+	})
+	if i < 0 {
+		return ts, nil
+	}
+	return ts[:i], ts[i:]
+}
+
+// applyLines runs the transforms on each line of a detection sample, leaving out dropped lines.
+func (ts TransformsT) applyLines(data []byte) []byte {
+
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(data, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		nl := bytes.HasSuffix(line, []byte{'\n'})
+		s, ok := ts.Apply(strings.TrimRight(string(line), "\r\n"))
+		if !ok {
+			continue
+		}
+		out.WriteString(s)
+		if nl {
+			out.WriteByte('\n')
+		}
+	}
+
+	return out.Bytes()
+}
+
+// transformFactoryT creates parsers that run the raw line transforms before parsing.
+type transformFactoryT struct {
+	format.FactoryI
+	ts TransformsT
+}
+
+func (f *transformFactoryT) New() format.ParserI {
+	return &transformParserT{
+		ParserI: f.FactoryI.New(),
+		ts:      f.ts,
+	}
+}
+
+type transformParserT struct {
+	format.ParserI
+	ts TransformsT
+}
+
+// ReadEntry returns ErrLineDropped for lines a transform drops; they are neither entries nor continuations.
+func (p *transformParserT) ReadEntry(line []byte) (format.LogEntry, error) {
+	s, ok := p.ts.Apply(string(line))
+	if !ok {
+		return format.LogEntry{}, ErrLineDropped
+	}
+	return p.ParserI.ReadEntry([]byte(s))
+}
+
+func (p *transformParserT) ReadTimestamp(rdr io.Reader) (int64, error) {
+
+	sc := bufio.NewScanner(rdr)
+	for sc.Scan() {
+		if s, ok := p.ts.Apply(sc.Text()); ok {
+			return p.ParserI.ReadTimestamp(strings.NewReader(s + "\n"))
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, ErrLineDropped
+}
+
+// Apply runs the transforms on a line. Returns false if the entry should be dropped.
+func (ts TransformsT) Apply(line string) (string, bool) {
+
+	for i := range ts {
+		var t = &ts[i]
+
+		switch t.Type {
+		case TransformAnsi:
+			line = ansiExp.ReplaceAllString(line, "")
+		case TransformReplace:
+			line = t.exp.ReplaceAllString(line, t.Replace)
+		case TransformDrop:
+			if t.exp.MatchString(line) {
+				return "", false
+			}
+		case TransformKeep:
+			if !t.exp.MatchString(line) {
+				return "", false
+			}
+		case TransformJSON:
+			line = t.unwrap(line)
+		}
+	}
+
+	return line, true
+}
+
+// unwrap returns the field from a JSON line; lines that are not JSON or lack the field are unchanged.
+func (t *TransformT) unwrap(line string) string {
+
+	var v any
+	if err := json.Unmarshal([]byte(line), &v); err != nil {
+		return line
+	}
+
+	for _, key := range t.path {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return line
+		}
+		if v, ok = m[key]; !ok {
+			return line
+		}
+	}
+
+	switch f := v.(type) {
+	case string:
+		// Docker json-file keeps the trailing newline
+		return strings.TrimRight(f, "\r\n")
+	default:
+		data, err := json.Marshal(f)
+		if err != nil {
+			return line
+		}
+		return string(data)
+	}
+}
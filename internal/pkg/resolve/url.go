@@ -0,0 +1,374 @@
+package resolve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	urlType = "url"
+
+	urlMaxResumes   = 5
+	urlMaxRedirects = 10
+	urlBlockSize    = 256 << 10
+
+	urlDialTimeout   = 10 * time.Second
+	urlTLSTimeout    = 10 * time.Second
+	urlHeaderTimeout = 30 * time.Second
+)
+
+var (
+	ErrURLStatus          = errors.New("unexpected http status")
+	ErrRangeUnsupported   = errors.New("server does not support range requests")
+	ErrURLHeaderEnv       = errors.New("header environment variable not set")
+	ErrURLInsecureHeaders = errors.New("headers are only sent over https")
+	ErrURLRedirects       = errors.New("too many redirects")
+)
+
+// Bodies stream for as long as the scan takes, so only connecting and waiting
+// for the response are bounded; the run context cancels the transfer.
+var (
+	httpClient = &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   urlDialTimeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout:   urlTLSTimeout,
+			ResponseHeaderTimeout: urlHeaderTimeout,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		CheckRedirect: checkRedirect,
+	}
+)
+
+// sourceHeaders reads the value of each header from the environment variable it names.
+func sourceHeaders(headers map[string]string) (http.Header, error) {
+
+	hdr := make(http.Header, len(headers))
+
+	for key, env := range headers {
+		val, ok := os.LookupEnv(env)
+		if !ok || val == "" {
+			return nil, fmt.Errorf("%w: %s for %s", ErrURLHeaderEnv, env, key)
+		}
+		hdr.Set(key, val)
+	}
+
+	return hdr, nil
+}
+
+// checkRedirect drops the configured headers when a redirect leaves the original
+// scheme and host; only the range of a resume is kept.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+
+	if len(via) >= urlMaxRedirects {
+		return ErrURLRedirects
+	}
+
+	orig := via[0].URL
+	if req.URL.Scheme == orig.Scheme && req.URL.Host == orig.Host {
+		return nil
+	}
+
+	log.Info().
+		Str("from", orig.Host).
+		Str("to", req.URL.Host).
+		Msg("Redirected to another host; dropping headers")
+
+	rng := req.Header.Get("Range")
+	req.Header = make(http.Header)
+	if rng != "" {
+		req.Header.Set("Range", rng)
+	}
+
+	return nil
+}
+
+type urlInfoT struct {
+	size    int64
+	ranges  bool
+	modTime time.Time
+}
+
+// headURL returns the object size, range support and modification time; servers that reject HEAD are streamed without them.
+func headURL(ctx context.Context, u string, hdr http.Header) urlInfoT {
+
+	info := urlInfoT{size: -1}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u, nil)
+	if err != nil {
+		return info
+	}
+	req.Header = hdr.Clone()
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		log.Warn().Err(err).Str("url", u).Msg("HEAD request failed")
+		return info
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return info
+	}
+
+	info.size = resp.ContentLength
+	info.ranges = resp.Header.Get("Accept-Ranges") == "bytes"
+
+	if lm := resp.Header.Get("Last-Modified"); lm != "" {
+		if t, err := http.ParseTime(lm); err == nil {
+			info.modTime = t
+		}
+	}
+
+	return info
+}
+
+// rangeRdrT streams an object and resumes with a range request from the current offset if the transfer breaks.
+type rangeRdrT struct {
+	ctx     context.Context
+	url     string
+	hdr     http.Header
+	off     int64
+	ranges  bool
+	resumes int
+	body    io.ReadCloser
+}
+
+func (r *rangeRdrT) open() error {
+
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = r.hdr.Clone()
+
+	if r.off > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.off))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case r.off == 0 && resp.StatusCode == http.StatusOK:
+	case r.off > 0 && resp.StatusCode == http.StatusPartialContent:
+	case r.off > 0 && resp.StatusCode == http.StatusOK:
+		resp.Body.Close()
+		return ErrRangeUnsupported
+	default:
+		resp.Body.Close()
+		return fmt.Errorf("%w: %s", ErrURLStatus, resp.Status)
+	}
+
+	r.body = resp.Body
+	return nil
+}
+
+func (r *rangeRdrT) Read(p []byte) (int, error) {
+
+	for {
+		if r.body == nil {
+			if err := r.open(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := r.body.Read(p)
+		r.off += int64(n)
+
+		if err == nil || err == io.EOF || !r.ranges || r.resumes >= urlMaxResumes || r.ctx.Err() != nil {
+			return n, err
+		}
+
+		log.Warn().
+			Err(err).
+			Str("url", r.url).
+			Int64("offset", r.off).
+			Msg("Transfer interrupted; resuming")
+
+		r.body.Close()
+		r.body = nil
+		r.resumes += 1
+
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (r *rangeRdrT) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	return r.body.Close()
+}
+
+// urlReaderAt reads an object with range requests, caching the last block fetched.
+// Used to find the tail offset without downloading the whole object.
+type urlReaderAt struct {
+	ctx   context.Context
+	url   string
+	hdr   http.Header
+	size  int64
+	off   int64
+	block []byte
+}
+
+func (r *urlReaderAt) ReadAt(p []byte, off int64) (int, error) {
+
+	var n int
+
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= r.size {
+			return n, io.EOF
+		}
+
+		if r.block == nil || pos < r.off || pos >= r.off+int64(len(r.block)) {
+			if err := r.fetch(pos - pos%urlBlockSize); err != nil {
+				return n, err
+			}
+		}
+
+		n += copy(p[n:], r.block[pos-r.off:])
+	}
+
+	return n, nil
+}
+
+func (r *urlReaderAt) fetch(off int64) error {
+
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header = r.hdr.Clone()
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, min(off+urlBlockSize, r.size)-1))
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("%w: %s", ErrRangeUnsupported, resp.Status)
+	}
+
+	if r.block, err = io.ReadAll(resp.Body); err != nil {
+		return err
+	}
+	r.off = off
+
+	return nil
+}
+
+// urlSrc is a remote log streamed over HTTP(S).
+type urlSrc struct {
+	*PipeRdrT
+	url   string
+	sz    int64
+	start int64
+	body  io.Closer
+}
+
+func newURLSrc(u string, opts ...OptT) (*urlSrc, error) {
+
+	pu, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		o     = parseOpts(opts...)
+		ctx   = o.ctx
+		hdr   = o.headers
+		start int64
+	)
+
+	if len(hdr) > 0 && pu.Scheme != "https" {
+		return nil, fmt.Errorf("%w: %s", ErrURLInsecureHeaders, u)
+	}
+
+	info := headURL(ctx, u, hdr)
+
+	// Infer the year of year-less timestamps relative to the last write
+	if !info.modTime.IsZero() {
+		opts = append([]OptT{WithRefTime(info.modTime)}, opts...)
+	}
+
+	if o.tail != nil {
+		switch {
+		case !info.ranges || info.size < 0:
+			log.Warn().Str("url", u).Msg("Cannot tail without range support; scanning entire object")
+		default:
+			ra := &urlReaderAt{ctx: ctx, url: u, hdr: hdr, size: info.size}
+			if start, err = tailStart(pu.Path, ra, info.size, opts...); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	rr := &rangeRdrT{
+		ctx:    ctx,
+		url:    u,
+		hdr:    hdr,
+		off:    start,
+		ranges: info.ranges,
+	}
+
+	rd, err := newReader(pu.Path, rr)
+	if err != nil {
+		rr.Close()
+		return nil, err
+	}
+
+	pr, err := newPipeReader(rd, opts...)
+	if err != nil {
+		rr.Close()
+		return nil, err
+	}
+
+	var sz int64 = -1
+	if !isCompressed(pu.Path) && info.size >= 0 {
+		sz = info.size - start
+	}
+
+	return &urlSrc{
+		PipeRdrT: pr,
+		url:      u,
+		sz:       sz,
+		start:    start,
+		body:     rr,
+	}, nil
+}
+
+func (us *urlSrc) Name() string {
+	return us.url
+}
+
+func (us *urlSrc) Size() int64 {
+	return us.sz
+}
+
+func (us *urlSrc) Offset() int64 {
+	return us.start
+}
+
+func (us *urlSrc) Close() error {
+	return us.body.Close()
+}
@@ -0,0 +1,487 @@
+package rulegen
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/prequel-dev/preq/internal/pkg/resolve"
+	"github.com/prequel-dev/preq/pkg/eval"
+	"github.com/prequel-dev/prequel-compiler/pkg/parser"
+)
+
+const (
+	KindSet      = "set"
+	KindSequence = "sequence"
+
+	defaultWindow = 10 * time.Second
+)
+
+var (
+	ErrNoLines      = errors.New("no log lines selected")
+	ErrLineRange    = errors.New("invalid line range")
+	ErrNoStableText = errors.New("line has no stable text to match")
+	ErrKind         = errors.New("rule kind must be set or sequence")
+	ErrSequence     = errors.New("a sequence needs two or more lines")
+	ErrNoMatch      = errors.New("generated rule does not match the selected lines")
+)
+
+var (
+	// Tokens with digits or random looking ids vary between occurrences of the same event
+	uuidExp   = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	ipExp     = regexp.MustCompile(`^\d{1,3}(\.\d{1,3}){3}(:\d+)?$`)
+	hexExp    = regexp.MustCompile(`^(0x)?[0-9a-fA-F]{8,}$`)
+	idExp     = regexp.MustCompile(`^[A-Za-z0-9_-]{12,}$`)
+	digitsExp = regexp.MustCompile(`\d+`)
+	letterExp = regexp.MustCompile(`[A-Za-z]`)
+	piecesExp = regexp.MustCompile(`\S+|\s+`)
+
+	// Month and day names are part of timestamps
+	dateWords = []string{
+		"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec",
+		"mon", "tue", "wed", "thu", "fri", "sat", "sun",
+	}
+
+	// Nice window sizes to round suggestions up to
+	windowSteps = []time.Duration{
+		time.Second, 2 * time.Second, 5 * time.Second, 10 * time.Second, 15 * time.Second, 30 * time.Second,
+		time.Minute, 2 * time.Minute, 5 * time.Minute, 10 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+		time.Hour, 2 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+	}
+)
+
+// LineT is a log line selected as an example of the problem.
+type LineT struct {
+	Num       int
+	Text      string
+	Timestamp time.Time
+}
+
+// TermT matches a line on its stable text, as a plain value or a regex when variable tokens were replaced.
+type TermT struct {
+	Value string
+	Regex bool
+	Line  int
+}
+
+// RuleT is a generated rule skeleton.
+type RuleT struct {
+	CreId  string
+	Source string
+	Kind   string
+	Window time.Duration
+	Span   time.Duration // Between the first and last example line, if they had timestamps
+	Timed  bool
+	Terms  []TermT
+	Data   []byte
+}
+
+type optsT struct {
+	creId  string
+	source string
+	kind   string
+}
+
+type OptT func(*optsT)
+
+// WithCreId sets the CRE id; defaults to a placeholder for the current year.
+func WithCreId(id string) OptT {
+	return func(o *optsT) {
+		o.creId = id
+	}
+}
+
+// WithSource sets the event source of the rule.
+func WithSource(source string) OptT {
+	return func(o *optsT) {
+		o.source = source
+	}
+}
+
+// WithKind generates a set or sequence; by default one line makes a set and several a sequence.
+func WithKind(kind string) OptT {
+	return func(o *optsT) {
+		o.kind = kind
+	}
+}
+
+func parseOpts(opts ...OptT) *optsT {
+	o := &optsT{
+		creId:  fmt.Sprintf("CRE-%d-XXXX", time.Now().Year()),
+		source: "cre.log.app",
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// SelectLines picks lines from a log by 1-based line numbers and ranges ("3,7-9"), by a regex, or both.
+// Timestamps are parsed with the detected format where possible.
+func SelectLines(data []byte, lines string, match *regexp.Regexp, opts ...resolve.OptT) ([]LineT, error) {
+
+	var (
+		nums     = make(map[int]bool)
+		selected []LineT
+		err      error
+	)
+
+	if lines != "" {
+		if nums, err = parseLineSpec(lines); err != nil {
+			return nil, err
+		}
+	}
+
+	// Lines without timestamps are still usable; the window is then a guess
+	stamps, _ := resolve.StampLines(data, opts...)
+
+	var (
+		scanner = bufio.NewScanner(bytes.NewReader(data))
+		num     int
+	)
+
+	for scanner.Scan() {
+		num++
+		text := scanner.Text()
+
+		if !nums[num] && (match == nil || !match.MatchString(text)) {
+			continue
+		}
+
+		l := LineT{Num: num, Text: text}
+		if num <= len(stamps) {
+			l.Timestamp = stamps[num-1]
+		}
+		selected = append(selected, l)
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(selected) == 0 {
+		return nil, ErrNoLines
+	}
+
+	return selected, nil
+}
+
+func parseLineSpec(spec string) (map[int]bool, error) {
+
+	var nums = make(map[int]bool)
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+
+		first, last, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(first)
+		if err != nil || from < 1 {
+			return nil, fmt.Errorf("%w: %q", ErrLineRange, part)
+		}
+
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(last); err != nil || to < from {
+				return nil, fmt.Errorf("%w: %q", ErrLineRange, part)
+			}
+		}
+
+		for n := from; n <= to; n++ {
+			nums[n] = true
+		}
+	}
+
+	return nums, nil
+}
+
+// Generate builds a rule skeleton with a term for each line, in line order.
+func Generate(lines []LineT, opts ...OptT) (*RuleT, error) {
+
+	var (
+		o    = parseOpts(opts...)
+		rule = &RuleT{
+			CreId:  o.creId,
+			Source: o.source,
+			Kind:   o.kind,
+		}
+	)
+
+	if len(lines) == 0 {
+		return nil, ErrNoLines
+	}
+
+	if rule.Kind == "" {
+		rule.Kind = KindSet
+		if len(lines) > 1 {
+			rule.Kind = KindSequence
+		}
+	}
+
+	if rule.Kind != KindSet && rule.Kind != KindSequence {
+		return nil, fmt.Errorf("%w: %q", ErrKind, rule.Kind)
+	}
+
+	for _, l := range lines {
+		term, err := termFor(l)
+		if err != nil {
+			return nil, err
+		}
+
+		// Set terms match in any order, so repeats add nothing
+		if rule.Kind == KindSet && slices.ContainsFunc(rule.Terms, func(t TermT) bool {
+			return t.Value == term.Value && t.Regex == term.Regex
+		}) {
+			continue
+		}
+
+		rule.Terms = append(rule.Terms, term)
+	}
+
+	if rule.Kind == KindSequence && len(rule.Terms) < 2 {
+		return nil, ErrSequence
+	}
+
+	if len(rule.Terms) > 1 {
+		rule.Span, rule.Window, rule.Timed = suggestWindow(lines)
+	}
+
+	data, err := render(rule, parser.ParseRuleMetadataT{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Ids are generated as they are for user rules without them
+	rules, err := parser.Read(bytes.NewReader(data), parser.WithGenIds())
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := parser.ParseRules(rules, []parser.ParseOptT{parser.WithGenIds()})
+	if err != nil {
+		return nil, err
+	}
+
+	if rule.Data, err = render(rule, parser.ParseRuleMetadataT{
+		Id:   tree.Nodes[0].Metadata.RuleId,
+		Hash: tree.Nodes[0].Metadata.RuleHash,
+	}); err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+// Verify runs the rule over the selected lines and returns the detections.
+func Verify(ctx context.Context, cfg string, rule *RuleT, lines []LineT) (int, error) {
+
+	var buf bytes.Buffer
+	for _, l := range lines {
+		buf.WriteString(l.Text)
+		buf.WriteByte('\n')
+	}
+
+	report, _, err := eval.DetectSources(ctx, cfg, string(rule.Data), []eval.SourceT{
+		{Name: "selected lines", Type: rule.Source, Data: buf.Bytes()},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	hits := len(report.CreHits[rule.CreId])
+	if hits == 0 {
+		return 0, ErrNoMatch
+	}
+
+	return hits, nil
+}
+
+// termFor matches the line from its first to its last stable token, replacing variable tokens in between.
+func termFor(l LineT) (TermT, error) {
+
+	var (
+		pieces      = piecesExp.FindAllString(l.Text, -1)
+		exprs       = make([]string, len(pieces))
+		stable      = make([]bool, len(pieces))
+		first, last = -1, -1
+		variable    bool
+	)
+
+	for i, p := range pieces {
+		if strings.TrimSpace(p) == "" {
+			exprs[i] = regexp.QuoteMeta(p)
+			if p != " " {
+				exprs[i] = `\s+`
+			}
+			continue
+		}
+
+		if exprs[i], stable[i] = tokenExpr(p); stable[i] {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+
+	if first < 0 {
+		return TermT{}, fmt.Errorf("%w: line %d", ErrNoStableText, l.Num)
+	}
+
+	for i := first; i <= last; i++ {
+		if exprs[i] != regexp.QuoteMeta(pieces[i]) {
+			variable = true
+		}
+	}
+
+	if !variable {
+		return TermT{Value: strings.Join(pieces[first:last+1], ""), Line: l.Num}, nil
+	}
+
+	return TermT{Value: strings.Join(exprs[first:last+1], ""), Regex: true, Line: l.Num}, nil
+}
+
+// tokenExpr returns a regex for a token and whether the token is stable text.
+func tokenExpr(tok string) (string, bool) {
+
+	var (
+		core   = strings.TrimLeft(tok, "\"'([{<")
+		prefix = tok[:len(tok)-len(core)]
+	)
+
+	core = strings.TrimRight(core, "\"')]}>,;:.")
+
+	var (
+		suffix = tok[len(prefix)+len(core):]
+		expr   string
+	)
+
+	switch {
+	case core == "":
+		return regexp.QuoteMeta(tok), true
+	case slices.Contains(dateWords, strings.ToLower(core)):
+		expr = `[A-Za-z]+`
+	case uuidExp.MatchString(core):
+		expr = `[0-9a-fA-F-]{36}`
+	case ipExp.MatchString(core):
+		expr = `\d{1,3}(?:\.\d{1,3}){3}`
+		if strings.Contains(core, ":") {
+			expr += `:\d+`
+		}
+	case hexExp.MatchString(core) && digitsExp.MatchString(core) && letterExp.MatchString(strings.TrimPrefix(core, "0x")):
+		expr = `(?:0x)?[0-9a-fA-F]+`
+	case idExp.MatchString(core) && digitsExp.MatchString(core) && letterExp.MatchString(core):
+		expr = `[A-Za-z0-9_-]+`
+	case digitsExp.MatchString(core):
+		// Keep the text around numbers, as in pid#tid or key=value
+		var (
+			b    strings.Builder
+			prev int
+		)
+		for _, loc := range digitsExp.FindAllStringIndex(core, -1) {
+			b.WriteString(regexp.QuoteMeta(core[prev:loc[0]]))
+			b.WriteString(`\d+`)
+			prev = loc[1]
+		}
+		b.WriteString(regexp.QuoteMeta(core[prev:]))
+		expr = b.String()
+	default:
+		return regexp.QuoteMeta(tok), true
+	}
+
+	return regexp.QuoteMeta(prefix) + expr + regexp.QuoteMeta(suffix), false
+}
+
+// suggestWindow returns the time between the first and last line, and a window with room to spare.
+func suggestWindow(lines []LineT) (time.Duration, time.Duration, bool) {
+
+	var first, last time.Time
+	for _, l := range lines {
+		if l.Timestamp.IsZero() {
+			continue
+		}
+		if first.IsZero() || l.Timestamp.Before(first) {
+			first = l.Timestamp
+		}
+		if l.Timestamp.After(last) {
+			last = l.Timestamp
+		}
+	}
+
+	if first.IsZero() {
+		return 0, defaultWindow, false
+	}
+
+	span := last.Sub(first)
+
+	for _, w := range windowSteps {
+		if w >= span+span/2 {
+			return span, w, true
+		}
+	}
+
+	return span, windowSteps[len(windowSteps)-1], true
+}
+
+var ruleTmpl = template.Must(template.New("rule").Funcs(template.FuncMap{
+	"quote": func(s string) string {
+		return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+	},
+}).Parse(`rules:
+  - cre:
+      id: {{ .Rule.CreId }}
+      severity: 2 # TODO: 0 critical, 1 high, 2 medium, 3 low, 4 info
+      title: "TODO: short title of the problem"
+      category: "TODO"
+      tags:
+        - TODO
+      author: "TODO"
+      description: |
+        TODO: what goes wrong
+      cause: |
+        TODO: why it happens
+      impact: |
+        TODO: what it affects
+      mitigation: |
+        TODO: how to fix it
+      references:
+        - "TODO: https://..."
+      applications:
+        - name: "TODO"
+    metadata:
+{{- if .Meta.Id }}
+      id: {{ .Meta.Id }}
+      hash: {{ .Meta.Hash }}
+{{- end }}
+      generation: 1
+    rule:
+      {{ .Rule.Kind }}:
+{{- if .Rule.Window }}
+        window: {{ .Rule.Window }}{{ if .Rule.Timed }} # example lines span {{ .Rule.Span }}{{ else }} # TODO: no timestamps found in the example lines{{ end }}
+{{- end }}
+        event:
+          source: {{ .Rule.Source }}
+        {{ if eq .Rule.Kind "sequence" }}order{{ else }}match{{ end }}:
+{{- range .Rule.Terms }}
+          - {{ if .Regex }}regex{{ else }}value{{ end }}: {{ quote .Value }} # line {{ .Line }}
+{{- end }}
+`))
+
+func render(rule *RuleT, meta parser.ParseRuleMetadataT) ([]byte, error) {
+
+	var buf bytes.Buffer
+
+	err := ruleTmpl.Execute(&buf, struct {
+		Rule *RuleT
+		Meta parser.ParseRuleMetadataT
+	}{rule, meta})
+
+	return buf.Bytes(), err
+}
@@ -0,0 +1,159 @@
+package rulegen
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prequel-dev/preq/internal/pkg/config"
+	"github.com/prequel-dev/preq/internal/pkg/resolve"
+)
+
+const testLog = `2019/02/05 12:07:37 [notice] 1629#1629: signal process started
+2019/02/05 12:07:37 [error] 1629#1629: open() "/run/nginx.pid" failed (2: No such file or directory)
+2019/02/05 12:07:38 [emerg] 1655#1655: bind() to 0.0.0.0:80 failed (98: Address already in use)
+2019/02/05 12:07:41 [alert] 1631#1631: unlink() "/run/nginx.pid" failed
+2019/02/05 12:07:42 request 6f1c2a9e-3b4d-4e5f-8a7b-9c0d1e2f3a4b done
+`
+
+// The default config has the nginx timestamp format
+func testOpts(t *testing.T) []resolve.OptT {
+	c, err := config.LoadConfigFromBytes(config.Marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.ResolveOpts()
+}
+
+func TestSelectLines(t *testing.T) {
+
+	t.Run("line numbers and ranges", func(t *testing.T) {
+		lines, err := SelectLines([]byte(testLog), "1,3-4", nil, testOpts(t)...)
+		if err != nil {
+			t.Fatalf("SelectLines failed: %v", err)
+		}
+		if len(lines) != 3 || lines[0].Num != 1 || lines[1].Num != 3 || lines[2].Num != 4 {
+			t.Fatalf("Unexpected lines: %+v", lines)
+		}
+		if lines[2].Timestamp.Sub(lines[0].Timestamp) != 4*time.Second {
+			t.Errorf("Expected parsed timestamps, got %v and %v", lines[0].Timestamp, lines[2].Timestamp)
+		}
+	})
+
+	t.Run("regex", func(t *testing.T) {
+		lines, err := SelectLines([]byte(testLog), "", regexp.MustCompile(`nginx\.pid`))
+		if err != nil {
+			t.Fatalf("SelectLines failed: %v", err)
+		}
+		if len(lines) != 2 || lines[0].Num != 2 || lines[1].Num != 4 {
+			t.Errorf("Unexpected lines: %+v", lines)
+		}
+	})
+
+	t.Run("invalid range", func(t *testing.T) {
+		if _, err := SelectLines([]byte(testLog), "4-2", nil); !errors.Is(err, ErrLineRange) {
+			t.Errorf("Expected ErrLineRange, got %v", err)
+		}
+	})
+
+	t.Run("no lines", func(t *testing.T) {
+		if _, err := SelectLines([]byte(testLog), "", regexp.MustCompile(`kafka`)); !errors.Is(err, ErrNoLines) {
+			t.Errorf("Expected ErrNoLines, got %v", err)
+		}
+	})
+}
+
+func TestTermFor(t *testing.T) {
+
+	tests := []struct {
+		line  string
+		value string
+		regex bool
+	}{
+		{`2019/02/05 12:07:37 [notice] signal process started`, `[notice] signal process started`, false},
+		{`2019/02/05 12:07:37 [notice] 1629#1629: signal process started`, `\[notice\] \d+#\d+: signal process started`, true},
+		{`2019/02/05 12:07:38 bind() to 0.0.0.0:80 failed`, `bind\(\) to \d{1,3}(?:\.\d{1,3}){3}:\d+ failed`, true},
+		{`2019/02/05 12:07:42 request 6f1c2a9e-3b4d-4e5f-8a7b-9c0d1e2f3a4b done`, `request [0-9a-fA-F-]{36} done`, true},
+		{`Feb  5 12:07:42 host kernel: out of memory`, `host kernel: out of memory`, false},
+	}
+
+	for _, tt := range tests {
+		term, err := termFor(LineT{Text: tt.line})
+		if err != nil {
+			t.Fatalf("termFor(%q) failed: %v", tt.line, err)
+		}
+		if term.Value != tt.value || term.Regex != tt.regex {
+			t.Errorf("termFor(%q) = %q regex %v, expected %q regex %v", tt.line, term.Value, term.Regex, tt.value, tt.regex)
+		}
+		if term.Regex && !regexp.MustCompile(term.Value).MatchString(tt.line) {
+			t.Errorf("Term %q does not match %q", term.Value, tt.line)
+		}
+	}
+
+	if _, err := termFor(LineT{Text: "12:07:42 404"}); !errors.Is(err, ErrNoStableText) {
+		t.Errorf("Expected ErrNoStableText, got %v", err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+
+	lines, err := SelectLines([]byte(testLog), "1,3-4", nil, testOpts(t)...)
+	if err != nil {
+		t.Fatalf("SelectLines failed: %v", err)
+	}
+
+	t.Run("sequence", func(t *testing.T) {
+		rule, err := Generate(lines, WithCreId("CRE-2025-9999"), WithSource("cre.log.nginx"))
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+
+		if rule.Kind != KindSequence || len(rule.Terms) != 3 {
+			t.Errorf("Expected a sequence of 3 terms, got %s of %d", rule.Kind, len(rule.Terms))
+		}
+		if rule.Span != 4*time.Second || rule.Window != 10*time.Second {
+			t.Errorf("Expected span 4s and window 10s, got %s and %s", rule.Span, rule.Window)
+		}
+		for _, want := range []string{"id: CRE-2025-9999", "source: cre.log.nginx", "window: 10s", "order:", "hash: "} {
+			if !strings.Contains(string(rule.Data), want) {
+				t.Errorf("Expected rule to contain %q:\n%s", want, rule.Data)
+			}
+		}
+
+		hits, err := Verify(context.Background(), "", rule, lines)
+		if err != nil {
+			t.Fatalf("Verify failed: %v\n%s", err, rule.Data)
+		}
+		if hits != 1 {
+			t.Errorf("Expected 1 detection, got %d", hits)
+		}
+	})
+
+	t.Run("set", func(t *testing.T) {
+		rule, err := Generate(lines[:1])
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		if rule.Kind != KindSet || rule.Window != 0 {
+			t.Errorf("Expected a set without window, got %s window %s", rule.Kind, rule.Window)
+		}
+		if _, err := Verify(context.Background(), "", rule, lines[:1]); err != nil {
+			t.Errorf("Verify failed: %v\n%s", err, rule.Data)
+		}
+	})
+
+	t.Run("sequence of one line", func(t *testing.T) {
+		if _, err := Generate(lines[:1], WithKind(KindSequence)); !errors.Is(err, ErrSequence) {
+			t.Errorf("Expected ErrSequence, got %v", err)
+		}
+	})
+
+	t.Run("invalid kind", func(t *testing.T) {
+		if _, err := Generate(lines, WithKind("chain")); !errors.Is(err, ErrKind) {
+			t.Errorf("Expected ErrKind, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrBundleFileMissing = errors.New("rules bundle file missing")
+	ErrInvalidBundleHash = errors.New("invalid rules bundle hash file")
+)
+
+// ImportRulesBundle verifies a downloaded community rules package and installs it into the config dir
+// for use without network access. The package's .sha2 and .sig files must sit next to it, named either
+// <package>.gz.sha2 or <package>.sha2.
+func ImportRulesBundle(configDir, path string) (*RulesPackageT, error) {
+
+	var (
+		rb, hb, sb []byte
+		hashPath   string
+		err        error
+	)
+
+	if rb, err = os.ReadFile(path); err != nil {
+		return nil, err
+	}
+
+	if hashPath, hb, err = readBundleFile(path, prequelRulesSha256Suffix); err != nil {
+		return nil, err
+	}
+
+	if _, sb, err = readBundleFile(path, prequelRulesSigSuffix); err != nil {
+		return nil, err
+	}
+
+	// Accept both a bare hash and sha256sum output
+	fields := strings.Fields(string(hb))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidBundleHash, hashPath)
+	}
+
+	if err = verifyRulesPackage(rb, sb, fields[0]); err != nil {
+		return nil, err
+	}
+
+	ver, err := readRulesVersion(rb)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("path", path).Str("version", ver.String()).Msg("Verified rules bundle")
+
+	var (
+		base            = filepath.Base(path)
+		pattern         = fmt.Sprintf(rulesFilenameFmt, "*")
+		ok, _           = filepath.Match(pattern, base)
+		installPath     string
+		installHashPath string
+	)
+
+	// Keep the release name so the package is listed alongside downloaded ones
+	if !ok {
+		base = fmt.Sprintf(rulesFilenameFmt, "."+ver.String())
+	}
+
+	installPath = filepath.Join(configDir, base)
+	installHashPath = installPath + prequelRulesSha256Suffix
+
+	if err = os.MkdirAll(configDir, 0755); err != nil {
+		return nil, err
+	}
+
+	if err = os.WriteFile(installPath, rb, 0644); err != nil {
+		return nil, err
+	}
+
+	if err = os.WriteFile(installHashPath, hb, 0644); err != nil {
+		return nil, err
+	}
+
+	log.Debug().
+		Str("src_path", path).
+		Str("dst_path", installPath).
+		Msg("Imported rule path")
+
+	return &RulesPackageT{Version: ver, Path: installPath}, nil
+}
+
+func readBundleFile(path, suffix string) (string, []byte, error) {
+
+	var (
+		full = path + suffix
+		bare = strings.TrimSuffix(path, prequelRulesSuffix) + suffix
+	)
+
+	for _, p := range []string{full, bare} {
+		data, err := os.ReadFile(p)
+		switch {
+		case err == nil:
+			return p, data, nil
+		case !os.IsNotExist(err):
+			return "", nil, err
+		}
+	}
+
+	return "", nil, fmt.Errorf("%w: %s", ErrBundleFileMissing, full)
+}
+
+// offlineRules returns the installed community rules package without contacting the update server.
+func offlineRules(configDir, confVersion string) (string, error) {
+
+	pin, err := pinnedRulesVersion(configDir, confVersion)
+	if err != nil {
+		return "", err
+	}
+
+	if pin == nil {
+		_, path, err := GetCurrentRulesVersion(configDir)
+		return path, err
+	}
+
+	pkgs, err := ListRulesVersions(configDir)
+	if err != nil {
+		return "", err
+	}
+
+	_, path, err := currentRulesVersion(pkgs, pin)
+
+	return path, err
+}
@@ -0,0 +1,435 @@
+package rules
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	mirrorFilesPath = "/files/"
+)
+
+var (
+	ErrMirrorDir = errors.New("mirror directory has no signed rules packages")
+
+	// Exe releases are named preq_<version>_<os>_<arch> with .sha2 and .sig files alongside
+	mirrorExeExp = regexp.MustCompile(`^preq_v?([0-9][^_]*)_([a-z0-9]+)_([a-z0-9]+)(\.exe)?$`)
+)
+
+// MirrorT serves a directory of signed rules and exe releases over the update protocol, so
+// clients can update from an internal host. The directory is rescanned on every request;
+// drop new releases in with their .sha2 and .sig files to publish them.
+type MirrorT struct {
+	dir     string
+	token   string
+	baseUrl string
+}
+
+type MirrorOptT func(*MirrorT)
+
+// WithMirrorToken requires clients to send this bearer token.
+func WithMirrorToken(token string) MirrorOptT {
+	return func(m *MirrorT) {
+		m.token = token
+	}
+}
+
+// WithMirrorBaseUrl sets the URL clients use to reach the mirror; defaults to the request host.
+func WithMirrorBaseUrl(baseUrl string) MirrorOptT {
+	return func(m *MirrorT) {
+		m.baseUrl = strings.TrimSuffix(baseUrl, "/")
+	}
+}
+
+func NewMirror(dir string, opts ...MirrorOptT) *MirrorT {
+	m := &MirrorT{dir: dir}
+	for _, o := range opts {
+		o(m)
+	}
+	return m
+}
+
+type mirrorFileT struct {
+	path string
+	size int64
+}
+
+type mirrorExeT struct {
+	version *semver.Version
+	urls    PackageUrls
+	files   [3]string
+}
+
+// mirrorIndexT is a scan of the mirror directory. Files maps the served names to paths.
+type mirrorIndexT struct {
+	rules []RulesPackageT
+	exes  []mirrorExeT
+	files map[string]mirrorFileT
+}
+
+// Handler serves checkins, download auth and package downloads. With a token, every
+// endpoint requires it; downloads get it back from rules_auth as their Authorization header.
+func (m *MirrorT) Handler() http.Handler {
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /v1/rules/update", m.auth(m.handleUpdate))
+	mux.HandleFunc("POST /v1/rules/rules_auth", m.auth(m.handleDownloadAuth))
+	mux.HandleFunc("GET "+mirrorFilesPath+"{name}", m.auth(m.handleFile))
+
+	return mux
+}
+
+// ServeUDP answers fast update checks until ctx is done.
+func (m *MirrorT) ServeUDP(ctx context.Context, addr string) error {
+
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, maxResp)
+
+	for {
+		n, raddr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if string(buf[:n]) != fastReq {
+			continue
+		}
+
+		resp, err := m.respond(nil, "")
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to scan mirror")
+			continue
+		}
+
+		// Versions only; clients do a full checkin for the URLs
+		data, err := json.Marshal(&RuleUpdateResponse{
+			LatestRuleVersion: resp.LatestRuleVersion,
+			LatestExeVersion:  resp.LatestExeVersion,
+		})
+		if err != nil {
+			continue
+		}
+
+		if _, err = conn.WriteTo(data, raddr); err != nil {
+			log.Warn().Err(err).Str("addr", raddr.String()).Msg("Failed to answer fast update check")
+		}
+	}
+}
+
+func (m *MirrorT) auth(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if m.token != "" {
+			want := "Bearer " + m.token
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(want)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		h(w, r)
+	}
+}
+
+func (m *MirrorT) handleUpdate(w http.ResponseWriter, r *http.Request) {
+
+	var who RulesWhoAmI
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxResp))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = json.Unmarshal(data, &who); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := m.respond(r, who.PinVersion)
+	if err != nil {
+		log.Error().Err(err).Str("pin", who.PinVersion).Msg("Failed to answer checkin")
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	log.Info().
+		Str("os", who.Os).
+		Str("version", who.Version).
+		Str("rule_version", who.RuleVersion).
+		Str("pin", who.PinVersion).
+		Str("remote", r.RemoteAddr).
+		Msg("Checkin")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleDownloadAuth returns the headers for a download: the mirror's bearer token, if any.
+func (m *MirrorT) handleDownloadAuth(w http.ResponseWriter, _ *http.Request) {
+
+	var auth RulesDownloadAuth
+	if m.token != "" {
+		auth.Auth = "Bearer " + m.token
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&auth)
+}
+
+func (m *MirrorT) handleFile(w http.ResponseWriter, r *http.Request) {
+
+	idx, err := m.scan()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Only files in the index are served
+	f, ok := idx.files[r.PathValue("name")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.ServeFile(w, r, f.path)
+}
+
+// respond builds the checkin response for the latest release, or the pinned rules version.
+func (m *MirrorT) respond(r *http.Request, pin string) (*RuleUpdateResponse, error) {
+
+	idx, err := m.scan()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(idx.rules) == 0 {
+		return nil, ErrMirrorDir
+	}
+
+	var (
+		pkg     = idx.rules[len(idx.rules)-1]
+		baseUrl = m.downloadBase(r)
+		resp    = &RuleUpdateResponse{}
+	)
+
+	if pin != "" {
+		ver, err := parseRulesVersion(pin)
+		if err != nil {
+			return nil, err
+		}
+		p, ok := findRulesVersion(idx.rules, ver)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrRulesVersionNotFound, ver)
+		}
+		pkg = *p
+	}
+
+	urls, hash, err := idx.packageUrls(pkg.Path, baseUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.LatestRuleVersion = pkg.Version.String()
+	resp.LatestRuleHash = hash
+	resp.RuleUrls = urls
+
+	if len(idx.exes) == 0 {
+		return resp, nil
+	}
+
+	// Every platform of the latest exe release
+	latest := idx.exes[0].version
+	for _, e := range idx.exes {
+		if e.version.GreaterThan(latest) {
+			latest = e.version
+		}
+	}
+
+	resp.LatestExeVersion = latest.String()
+
+	for _, e := range idx.exes {
+		if !e.version.Equal(latest) {
+			continue
+		}
+		urls := e.urls
+		urls.DataUrl = baseUrl + e.files[0]
+		urls.HashUrl = baseUrl + e.files[1]
+		urls.SigUrl = baseUrl + e.files[2]
+		resp.ExeUrls = append(resp.ExeUrls, &urls)
+	}
+
+	return resp, nil
+}
+
+func (m *MirrorT) downloadBase(r *http.Request) string {
+
+	if m.baseUrl != "" {
+		return m.baseUrl + mirrorFilesPath
+	}
+
+	scheme := "http"
+	if r != nil && r.TLS != nil {
+		scheme = "https"
+	}
+
+	host := "localhost"
+	if r != nil {
+		host = r.Host
+	}
+
+	return fmt.Sprintf("%s://%s%s", scheme, host, mirrorFilesPath)
+}
+
+func (m *MirrorT) scan() (*mirrorIndexT, error) {
+
+	idx := &mirrorIndexT{files: make(map[string]mirrorFileT)}
+
+	pkgs, err := ListRulesVersions(m.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Skip unsigned packages; clients would reject them
+	for _, p := range pkgs {
+		if _, err := idx.addSigned(p.Path); err != nil {
+			log.Warn().Err(err).Str("path", p.Path).Msg("Skipping rules package")
+			continue
+		}
+		idx.rules = append(idx.rules, p)
+	}
+
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range entries {
+		match := mirrorExeExp.FindStringSubmatch(e.Name())
+		if match == nil || e.IsDir() {
+			continue
+		}
+
+		ver, err := semver.NewVersion(match[1])
+		if err != nil {
+			log.Warn().Err(err).Str("name", e.Name()).Msg("Skipping exe release")
+			continue
+		}
+
+		path := filepath.Join(m.dir, e.Name())
+
+		files, err := idx.addSigned(path)
+		if err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("Skipping exe release")
+			continue
+		}
+
+		hb, err := os.ReadFile(idx.files[files[1]].path)
+		if err != nil {
+			return nil, err
+		}
+
+		fields := strings.Fields(string(hb))
+		if len(fields) == 0 {
+			log.Warn().Str("path", path).Msg("Skipping exe release with empty hash")
+			continue
+		}
+
+		idx.exes = append(idx.exes, mirrorExeT{
+			version: ver,
+			files:   files,
+			urls: PackageUrls{
+				DataSize: idx.files[files[0]].size,
+				Hash:     fields[0],
+				HashSize: idx.files[files[1]].size,
+				SigSize:  idx.files[files[2]].size,
+				Os:       match[2],
+				Arch:     match[3],
+			},
+		})
+	}
+
+	return idx, nil
+}
+
+// addSigned indexes a package with its hash and signature files and returns their served names.
+func (idx *mirrorIndexT) addSigned(path string) ([3]string, error) {
+
+	var names [3]string
+
+	hashPath, _, err := readBundleFile(path, prequelRulesSha256Suffix)
+	if err != nil {
+		return names, err
+	}
+
+	sigPath, _, err := readBundleFile(path, prequelRulesSigSuffix)
+	if err != nil {
+		return names, err
+	}
+
+	for i, p := range []string{path, hashPath, sigPath} {
+		info, err := os.Stat(p)
+		if err != nil {
+			return names, err
+		}
+		names[i] = filepath.Base(p)
+		idx.files[names[i]] = mirrorFileT{path: p, size: info.Size()}
+	}
+
+	return names, nil
+}
+
+func (idx *mirrorIndexT) packageUrls(path, baseUrl string) (*PackageUrls, string, error) {
+
+	var (
+		data = filepath.Base(path)
+		urls = &PackageUrls{DataUrl: baseUrl + data, DataSize: idx.files[data].size}
+	)
+
+	hashPath, hb, err := readBundleFile(path, prequelRulesSha256Suffix)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sigPath, _, err := readBundleFile(path, prequelRulesSigSuffix)
+	if err != nil {
+		return nil, "", err
+	}
+
+	fields := strings.Fields(string(hb))
+	if len(fields) == 0 {
+		return nil, "", fmt.Errorf("%w: %s", ErrInvalidBundleHash, hashPath)
+	}
+
+	urls.Hash = fields[0]
+	urls.HashUrl = baseUrl + filepath.Base(hashPath)
+	urls.HashSize = idx.files[filepath.Base(hashPath)].size
+	urls.SigUrl = baseUrl + filepath.Base(sigPath)
+	urls.SigSize = idx.files[filepath.Base(sigPath)].size
+
+	return urls, urls.Hash, nil
+}
@@ -4,20 +4,18 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
-	"crypto/ecdsa"
-	"crypto/sha256"
-	"crypto/x509"
 	"encoding/json"
-	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
-	"sort"
+	"strings"
 	"time"
 
 	"github.com/Masterminds/semver"
@@ -102,10 +100,18 @@ func GetRules(ctx context.Context, conf *config.Config, configDir, cmdLineRules,
 		err           error
 	)
 
-	// Sync rules
-	if syncRulesPath, err = syncUpdates(ctx, conf, configDir, token, ruleUpdateFile, baseAddr, tlsPort, udpPort); err != nil {
-		// Continue on error. If we cannot download any rules at all on first run, a user will have to provide them on the command line or config
-		log.Error().Err(err).Msg("Failed to sync updates. Continue...")
+	switch {
+	case conf.Offline:
+		// Use the installed or imported rules only
+		if syncRulesPath, err = offlineRules(configDir, conf.RulesVersion); err != nil {
+			log.Warn().Err(err).Msg("No community rules installed for offline mode. Continue...")
+		}
+	default:
+		// Sync rules
+		if syncRulesPath, err = syncUpdates(ctx, conf, configDir, token, ruleUpdateFile, baseAddr, tlsPort, udpPort); err != nil {
+			// Continue on error. If we cannot download any rules at all on first run, a user will have to provide them on the command line or config
+			log.Error().Err(err).Msg("Failed to sync updates. Continue...")
+		}
 	}
 
 	if syncRulesPath != "" && !conf.Rules.Disabled {
@@ -115,18 +121,24 @@ func GetRules(ctx context.Context, conf *config.Config, configDir, cmdLineRules,
 		})
 	}
 
+	userPaths := conf.Rules.Paths
 	if cmdLineRules != "" {
-		rulePaths = append(rulePaths, utils.RulePathT{
-			Path: cmdLineRules,
-			Type: utils.RuleTypeUser,
-		})
+		userPaths = append([]string{cmdLineRules}, userPaths...)
 	}
 
-	for _, path := range conf.Rules.Paths {
-		rulePaths = append(rulePaths, utils.RulePathT{
-			Path: path,
-			Type: utils.RuleTypeUser,
-		})
+	for _, path := range userPaths {
+		var files []string
+		if files, err = utils.ExpandRulesPath(path); err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			log.Warn().Str("path", path).Msg("No rule files found")
+		}
+		var paths []utils.RulePathT
+		if paths, err = userRulePaths(conf.Rules.Signing, files); err != nil {
+			return nil, err
+		}
+		rulePaths = append(rulePaths, paths...)
 	}
 
 	if len(rulePaths) == 0 {
@@ -144,13 +156,28 @@ func syncUpdates(ctx context.Context, conf *config.Config, configDir, token, upd
 		localCheckUpdate bool
 		currRulesVer     *semver.Version
 		currRulesPath    string
-		apiUrl           = fmt.Sprintf("https://%s:%d", baseAddr, tlsPort)
+		pinVer           *semver.Version
+		apiUrl, udpAddr  = updateEndpoints(conf.Updates, baseAddr, tlsPort, udpPort)
 		dur              = defaultLocalCheckDur
 		timeout          = slowCheckTimeout
 		err              error
 	)
 
-	if currRulesVer, currRulesPath, err = GetCurrentRulesVersion(configDir); err != nil {
+	if pinVer, err = pinnedRulesVersion(configDir, conf.RulesVersion); err != nil {
+		return "", err
+	}
+
+	if pinVer == nil {
+		currRulesVer, currRulesPath, err = GetCurrentRulesVersion(configDir)
+	} else {
+		var pkgs []RulesPackageT
+		if pkgs, err = ListRulesVersions(configDir); err == nil {
+			currRulesVer, currRulesPath, err = currentRulesVersion(pkgs, pinVer)
+		}
+		log.Info().Str("version", pinVer.String()).Msg("Rules version pinned")
+	}
+
+	if err != nil {
 		log.Error().Err(err).Msg("Failed to get current rules version")
 		currRulesVer = semver.MustParse("0.0.0")
 	}
@@ -166,7 +193,7 @@ func syncUpdates(ctx context.Context, conf *config.Config, configDir, token, upd
 		return currRulesPath, err
 	}
 
-	// If we don't have any rules installed, then bump the timeout and force a full checkin
+	// If we don't have any rules installed (or not the pinned version), then bump the timeout and force a full checkin
 	if currRulesPath == "" {
 		timeout = noRulesTimeout
 		localCheckUpdate = true
@@ -176,32 +203,40 @@ func syncUpdates(ctx context.Context, conf *config.Config, configDir, token, upd
 	}
 
 	// If we don't need to do a full check in, do a fast one (~30ms)
-	if !localCheckUpdate {
-		if tinyResp, err = fastUpdateSync(ctx, fmt.Sprintf("%s:%d", udpBaseAddr, udpPort), fastCheckTimeout); err != nil {
+	switch {
+	case !localCheckUpdate && udpAddr == "":
+		log.Debug().Msg("No fast update endpoint")
+	case !localCheckUpdate:
+		if tinyResp, err = fastUpdateSync(ctx, udpAddr, fastCheckTimeout); err != nil {
 			return currRulesPath, err
 		}
-	} else {
+	default:
 		// Otherwise, do a full check in (~130ms). Uses slowCheckTimeout
-		if fullResp, err = checkin(ctx, apiUrl, token, currRulesVer, timeout); err != nil {
+		if fullResp, err = checkin(ctx, apiUrl, token, currRulesVer, pinVer, timeout); err != nil {
 			return currRulesPath, err
 		}
 	}
 
 	// We might have a tiny or full response. If we need to do one or more updates, then just do one full update checkin for a full response
-	if shouldUpdateExe(tinyResp) || shouldUpdateRules(currRulesVer, tinyResp) {
+	if shouldUpdateExe(tinyResp) || (pinVer == nil && shouldUpdateRules(currRulesVer, tinyResp)) {
 		// Ok, we need to do one or more updates. But we don't know if we have a full response.
 		if fullResp == nil {
 			// Otherwise, do a full check in (~130ms). Uses slowCheckTimeout
-			if fullResp, err = checkin(ctx, apiUrl, token, currRulesVer, timeout); err != nil {
+			if fullResp, err = checkin(ctx, apiUrl, token, currRulesVer, pinVer, timeout); err != nil {
 				return currRulesPath, err
 			}
 		}
 	}
 
-	if fullResp == nil || fullResp.LatestExeVersion == "" || fullResp.LatestRuleVersion == "" {
+	// Mirrors may serve rules without exe releases
+	if fullResp == nil || fullResp.LatestRuleVersion == "" || (fullResp.LatestExeVersion == "" && !conf.Updates.IsMirror()) {
 		return currRulesPath, nil
 	}
 
+	if err = rewriteDownloadUrls(fullResp, conf.Updates.DownloadUrl); err != nil {
+		return currRulesPath, err
+	}
+
 	// If we had a tiny response earlier, we have a full one now. If we had a full one earlier, we still have it.
 	if shouldUpdateExe(fullResp) && !isKrewPluginEnabled() {
 		if err = requestExeUpdate(ctx, fullResp, apiUrl, token, slowCheckTimeout, downloadTimeout, conf.AcceptUpdates); err != nil {
@@ -209,15 +244,69 @@ func syncUpdates(ctx context.Context, conf *config.Config, configDir, token, upd
 		}
 	}
 
-	if shouldUpdateRules(currRulesVer, fullResp) {
+	switch {
+	case pinVer == nil && shouldUpdateRules(currRulesVer, fullResp):
 		if currRulesPath, err = requestRuleUpdate(ctx, fullResp, apiUrl, token, configDir, slowCheckTimeout, downloadTimeout, conf.AcceptUpdates); err != nil {
 			return "", err
 		}
+	case pinVer != nil && currRulesPath == "":
+		// Download the pinned release, even if older than the latest. Pinning is consent to the update.
+		pinResp := fullResp
+		if !isRulesVersion(pinVer, fullResp) {
+			// Servers that ignore the pin in the checkin describe the latest release instead
+			if pinResp, err = pinnedRelease(fullResp, pinVer); err != nil {
+				return "", err
+			}
+		}
+		if currRulesPath, err = requestRuleUpdate(ctx, pinResp, apiUrl, token, configDir, slowCheckTimeout, downloadTimeout, true); err != nil {
+			return "", err
+		}
 	}
 
 	return currRulesPath, nil
 }
 
+// updateEndpoints returns the checkin URL and fast check UDP address, from the config if set.
+func updateEndpoints(u config.Updates, baseAddr string, tlsPort, udpPort int) (string, string) {
+
+	if u.IsMirror() {
+		return strings.TrimSuffix(u.Endpoint, "/"), u.FastEndpoint
+	}
+
+	return fmt.Sprintf("https://%s:%d", baseAddr, tlsPort), fmt.Sprintf("%s:%d", udpBaseAddr, udpPort)
+}
+
+// rewriteDownloadUrls points package URLs at the download base URL, keeping their file names.
+func rewriteDownloadUrls(r *RuleUpdateResponse, downloadUrl string) error {
+
+	if downloadUrl == "" {
+		return nil
+	}
+
+	var (
+		base = strings.TrimSuffix(downloadUrl, "/")
+		urls = append([]*PackageUrls{r.RuleUrls}, r.ExeUrls...)
+	)
+
+	for _, u := range urls {
+		if u == nil {
+			continue
+		}
+		for _, p := range []*string{&u.DataUrl, &u.HashUrl, &u.SigUrl} {
+			if *p == "" {
+				continue
+			}
+			name, err := utils.UrlBase(*p)
+			if err != nil {
+				return err
+			}
+			*p = base + "/" + name
+		}
+	}
+
+	return nil
+}
+
 func isKrewPluginEnabled() bool {
 	log.Debug().Bool("enabled", len(krewPluginEnabled) > 0).Msg("Krew plugin")
 	return len(krewPluginEnabled) > 0
@@ -422,30 +511,10 @@ func requestExeUpdate(ctx context.Context, fullResp *RuleUpdateResponse, apiUrl,
 		Str("path", newExeSigPath).
 		Msg("Temp updated exe sig path")
 
-	block, _ := pem.Decode(publicRulesKeyPEM)
-	if block == nil {
-		return ErrInvalidKey
-	}
-
-	pubKeyInterface, err := x509.ParsePKIXPublicKey(block.Bytes)
-	if err != nil {
+	if err = verifySignature(publicRulesKeyPEM, eb, sb); err != nil {
 		return err
 	}
 
-	pubKey, ok := pubKeyInterface.(*ecdsa.PublicKey)
-	if !ok {
-		return ErrInvalidKey
-	}
-
-	hash := sha256.New()
-	hash.Write(eb)
-	hashed := hash.Sum(nil)
-
-	valid := ecdsa.VerifyASN1(pubKey, hashed, sb)
-	if !valid {
-		return ErrInvalidSignature
-	}
-
 	ebHash := utils.Sha256Sum(eb)
 	if ebHash != exeHash {
 		return ErrHashMismatch
@@ -553,36 +622,16 @@ func requestRuleUpdate(ctx context.Context, fullResp *RuleUpdateResponse, apiUrl
 		Str("path", newRuleSigPath).
 		Msg("Temp updated rule sig path")
 
-	block, _ := pem.Decode(publicRulesKeyPEM)
-	if block == nil {
-		return "", ErrInvalidKey
+	// Pinned releases derived from the latest one carry no hash; the signature still authenticates the package
+	expectHash := fullResp.LatestRuleHash
+	if fields := strings.Fields(string(hb)); expectHash == "" && len(fields) > 0 {
+		expectHash = fields[0]
 	}
 
-	pubKeyInterface, err := x509.ParsePKIXPublicKey(block.Bytes)
-	if err != nil {
+	if err = verifyRulesPackage(rb, sb, expectHash); err != nil {
 		return "", err
 	}
 
-	pubKey, ok := pubKeyInterface.(*ecdsa.PublicKey)
-	if !ok {
-		return "", ErrInvalidKey
-	}
-
-	hash := sha256.New()
-	hash.Write(rb)
-	hashed := hash.Sum(nil)
-
-	valid := ecdsa.VerifyASN1(pubKey, hashed, sb)
-	if !valid {
-		return "", ErrInvalidSignature
-	}
-
-	ebHash := utils.Sha256Sum(rb)
-	if ebHash != fullResp.LatestRuleHash {
-		log.Error().Str("expected", fullResp.LatestRuleHash).Str("actual", ebHash).Msg("Hash mismatch")
-		return "", ErrHashMismatch
-	}
-
 	fmt.Println("ECDSA signature and sha256 hash verified")
 
 	baseRulesName, err := utils.UrlBase(fullResp.RuleUrls.DataUrl)
@@ -617,6 +666,22 @@ func requestRuleUpdate(ctx context.Context, fullResp *RuleUpdateResponse, apiUrl
 	return updatedRulesPath, nil
 }
 
+// verifyRulesPackage checks the package's signature against the embedded public key and its sha256 hash.
+func verifyRulesPackage(rb, sb []byte, expectHash string) error {
+
+	if err := verifySignature(publicRulesKeyPEM, rb, sb); err != nil {
+		return err
+	}
+
+	ebHash := utils.Sha256Sum(rb)
+	if ebHash != expectHash {
+		log.Error().Str("expected", expectHash).Str("actual", ebHash).Msg("Hash mismatch")
+		return ErrHashMismatch
+	}
+
+	return nil
+}
+
 func shouldUpdateRules(currVer *semver.Version, r *RuleUpdateResponse) bool {
 
 	var (
@@ -635,15 +700,91 @@ func shouldUpdateRules(currVer *semver.Version, r *RuleUpdateResponse) bool {
 	return newVer.GreaterThan(currVer)
 }
 
+func isRulesVersion(ver *semver.Version, r *RuleUpdateResponse) bool {
+
+	if r == nil || r.LatestRuleVersion == "" {
+		return false
+	}
+
+	newVer, err := semver.NewVersion(r.LatestRuleVersion)
+	if err != nil {
+		return false
+	}
+
+	return newVer.Equal(ver)
+}
+
+// pinnedRelease describes the pinned rules release from the latest one. Package file names
+// carry the version, so the pinned download URLs replace it in the latest URLs. Sizes and
+// the hash are unknown until the files are downloaded.
+func pinnedRelease(r *RuleUpdateResponse, ver *semver.Version) (*RuleUpdateResponse, error) {
+
+	if r == nil || r.RuleUrls == nil || r.LatestRuleVersion == "" {
+		return nil, fmt.Errorf("%w: %s", ErrPinnedRulesUnavailable, ver)
+	}
+
+	latest, err := semver.NewVersion(r.LatestRuleVersion)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrPinnedRulesUnavailable, ver, err)
+	}
+
+	var (
+		from = prefix.PrequelPublicRulesPrefix + "." + latest.String()
+		to   = prefix.PrequelPublicRulesPrefix + "." + ver.String()
+		urls = &PackageUrls{}
+	)
+
+	for _, u := range []struct{ src, dst *string }{
+		{&r.RuleUrls.DataUrl, &urls.DataUrl},
+		{&r.RuleUrls.HashUrl, &urls.HashUrl},
+		{&r.RuleUrls.SigUrl, &urls.SigUrl},
+	} {
+		parsed, err := url.Parse(*u.src)
+		if err != nil {
+			return nil, err
+		}
+
+		base := path.Base(parsed.Path)
+		if !strings.HasPrefix(base, from) {
+			return nil, fmt.Errorf("%w: %s: unversioned download url %s", ErrPinnedRulesUnavailable, ver, *u.src)
+		}
+
+		// Query strings sign the latest files only
+		parsed.Path = path.Join(path.Dir(parsed.Path), to+strings.TrimPrefix(base, from))
+		parsed.RawQuery = ""
+		*u.dst = parsed.String()
+	}
+
+	return &RuleUpdateResponse{
+		LatestRuleVersion: ver.String(),
+		LatestExeVersion:  r.LatestExeVersion,
+		RuleUrls:          urls,
+		ExeUrls:           r.ExeUrls,
+	}, nil
+}
+
+// GetCurrentRulesVersion returns the active rules package: the version selected with
+// `preq rules use|rollback` if it is still installed, otherwise the latest.
 func GetCurrentRulesVersion(configDir string) (*semver.Version, string, error) {
 
 	var (
+		pkgs     []RulesPackageT
 		currVer  *semver.Version
 		currPath string
 		err      error
 	)
 
-	if currVer, currPath, err = _getCurrentRulesVersion(configDir); err != nil {
+	if pkgs, err = ListRulesVersions(configDir); err != nil {
+		return nil, "", err
+	}
+
+	currVer, currPath, err = currentRulesVersion(pkgs, selectedRulesVersion(configDir))
+	if errors.Is(err, ErrRulesVersionNotFound) {
+		log.Warn().Err(err).Msg("Selected rules version missing, using latest")
+		currVer, currPath, err = currentRulesVersion(pkgs, nil)
+	}
+
+	if err != nil {
 		return nil, "", err
 	}
 
@@ -696,10 +837,13 @@ type RulesWhoAmI struct {
 	Version     string `json:"version"`
 	GitHash     string `json:"git_hash"`
 	RuleVersion string `json:"rule_version"`
+	PinVersion  string `json:"pin_version,omitempty"`
 	Timezone    string `json:"timezone"`
 }
 
-func checkin(ctx context.Context, apiUrl, token string, currRulesVer *semver.Version, timeout time.Duration) (*RuleUpdateResponse, error) {
+// checkin reports the installed versions. When pinVer is set, servers that support pinning,
+// such as `preq mirror`, describe that rules release instead of the latest.
+func checkin(ctx context.Context, apiUrl, token string, currRulesVer, pinVer *semver.Version, timeout time.Duration) (*RuleUpdateResponse, error) {
 
 	var (
 		u = fmt.Sprintf("%s/v1/rules/update", apiUrl)
@@ -719,6 +863,10 @@ func checkin(ctx context.Context, apiUrl, token string, currRulesVer *semver.Ver
 
 	w.Timezone = fmt.Sprintf("%s/%d", tzName, tzOffset)
 
+	if pinVer != nil {
+		w.PinVersion = pinVer.String()
+	}
+
 	if data, err = json.Marshal(w); err != nil {
 		log.Error().Err(err).Msg("Fail json.Marshal")
 		return nil, err
@@ -806,6 +954,11 @@ func getRulesVersion(path string) (*semver.Version, error) {
 		return nil, err
 	}
 
+	return readRulesVersion(data)
+}
+
+func readRulesVersion(data []byte) (*semver.Version, error) {
+
 	// Decompress the gzip file
 	gz, err := gzip.NewReader(bytes.NewReader(data))
 	if err != nil {
@@ -863,41 +1016,3 @@ func getRulesVersion(path string) (*semver.Version, error) {
 
 	return ver, nil
 }
-
-func _getCurrentRulesVersion(configDir string) (*semver.Version, string, error) {
-
-	var (
-		pattern  = filepath.Join(configDir, fmt.Sprintf(rulesFilenameFmt, "*"))
-		packages []string
-		err      error
-		curr     *semver.Version
-		currPath string
-	)
-
-	if packages, err = filepath.Glob(pattern); err != nil {
-		return nil, "", err
-	}
-
-	if len(packages) == 0 {
-		return nil, "", ErrNoRulesRelease
-	}
-
-	sort.Strings(packages)
-
-	for _, p := range packages {
-
-		var ver *semver.Version
-
-		if ver, err = getRulesVersion(p); err != nil {
-			log.Error().Err(err).Msg("Failed to get rules version")
-			return nil, "", err
-		}
-
-		if curr == nil || ver.Compare(curr) > 0 {
-			curr = ver
-			currPath = p
-		}
-	}
-
-	return curr, currPath, nil
-}
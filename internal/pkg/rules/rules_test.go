@@ -1,15 +1,30 @@
 package rules
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/Masterminds/semver"
+	"github.com/prequel-dev/preq/internal/pkg/config"
+	"github.com/prequel-dev/preq/internal/pkg/utils"
 	"github.com/prequel-dev/preq/internal/pkg/verz"
 )
 
@@ -168,3 +183,516 @@ func TestPostUrl(t *testing.T) {
 		t.Errorf("Response body does not match expected. Got %v", actualResponse)
 	}
 }
+
+func writeRulesPackage(t *testing.T, dir, version string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	fmt.Fprintf(gz, "section: version\ncontent:\n  - version: %s\n---\nsection: rules\n", version)
+	if err := gz.Close(); err != nil {
+		t.Fatalf("Failed to gzip rules package: %v", err)
+	}
+
+	path := filepath.Join(dir, fmt.Sprintf(rulesFilenameFmt, "."+version))
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write rules package: %v", err)
+	}
+
+	return path
+}
+
+func TestRulesVersions(t *testing.T) {
+	dir := t.TempDir()
+
+	writeRulesPackage(t, dir, "0.3.2")
+	v10 := writeRulesPackage(t, dir, "0.3.10")
+	v9 := writeRulesPackage(t, dir, "0.3.9")
+
+	t.Run("List sorts by version", func(t *testing.T) {
+		pkgs, err := ListRulesVersions(dir)
+		if err != nil {
+			t.Fatalf("ListRulesVersions: %v", err)
+		}
+		var got []string
+		for _, p := range pkgs {
+			got = append(got, p.Version.String())
+		}
+		if strings.Join(got, ",") != "0.3.2,0.3.9,0.3.10" {
+			t.Errorf("Expected 0.3.2,0.3.9,0.3.10, got %v", got)
+		}
+	})
+
+	t.Run("Latest without selection", func(t *testing.T) {
+		ver, path, err := GetCurrentRulesVersion(dir)
+		if err != nil {
+			t.Fatalf("GetCurrentRulesVersion: %v", err)
+		}
+		if ver.String() != "0.3.10" || path != v10 {
+			t.Errorf("Expected 0.3.10 at %s, got %s at %s", v10, ver, path)
+		}
+	})
+
+	t.Run("Rollback selects previous", func(t *testing.T) {
+		pkg, err := RollbackRulesVersion(dir)
+		if err != nil {
+			t.Fatalf("RollbackRulesVersion: %v", err)
+		}
+		if pkg.Version.String() != "0.3.9" {
+			t.Errorf("Expected 0.3.9, got %s", pkg.Version)
+		}
+		ver, path, err := GetCurrentRulesVersion(dir)
+		if err != nil || ver.String() != "0.3.9" || path != v9 {
+			t.Errorf("Expected current 0.3.9 at %s, got %v at %s (err=%v)", v9, ver, path, err)
+		}
+	})
+
+	t.Run("Rollback past oldest fails", func(t *testing.T) {
+		if _, err := RollbackRulesVersion(dir); err != nil {
+			t.Fatalf("RollbackRulesVersion: %v", err)
+		}
+		if _, err := RollbackRulesVersion(dir); !errors.Is(err, ErrNoPrevRulesVersion) {
+			t.Errorf("Expected ErrNoPrevRulesVersion, got %v", err)
+		}
+	})
+
+	t.Run("Use missing version fails", func(t *testing.T) {
+		if _, err := UseRulesVersion(dir, "0.4.0"); !errors.Is(err, ErrRulesVersionNotFound) {
+			t.Errorf("Expected ErrRulesVersionNotFound, got %v", err)
+		}
+		if _, err := UseRulesVersion(dir, "bogus"); !errors.Is(err, ErrInvalidRulesVersion) {
+			t.Errorf("Expected ErrInvalidRulesVersion, got %v", err)
+		}
+	})
+
+	t.Run("Use latest clears selection", func(t *testing.T) {
+		if _, err := UseRulesVersion(dir, "0.3.9"); err != nil {
+			t.Fatalf("UseRulesVersion: %v", err)
+		}
+		if sel, _ := SelectedRulesVersion(dir); sel == nil || sel.String() != "0.3.9" {
+			t.Errorf("Expected selection 0.3.9, got %v", sel)
+		}
+		if _, err := UseRulesVersion(dir, "latest"); err != nil {
+			t.Fatalf("UseRulesVersion: %v", err)
+		}
+		if sel, _ := SelectedRulesVersion(dir); sel != nil {
+			t.Errorf("Expected no selection, got %s", sel)
+		}
+	})
+
+	t.Run("Config pin overrides selection", func(t *testing.T) {
+		if _, err := UseRulesVersion(dir, "0.3.2"); err != nil {
+			t.Fatalf("UseRulesVersion: %v", err)
+		}
+		pin, err := pinnedRulesVersion(dir, "0.3.10")
+		if err != nil || pin.String() != "0.3.10" {
+			t.Errorf("Expected pin 0.3.10, got %v (err=%v)", pin, err)
+		}
+		pin, err = pinnedRulesVersion(dir, "")
+		if err != nil || pin.String() != "0.3.2" {
+			t.Errorf("Expected pin 0.3.2, got %v (err=%v)", pin, err)
+		}
+	})
+}
+
+func TestIsRulesVersion(t *testing.T) {
+	ver := semver.MustParse("0.3.9")
+
+	if !isRulesVersion(ver, &RuleUpdateResponse{LatestRuleVersion: "0.3.9"}) {
+		t.Errorf("Expected pinned release to match")
+	}
+	if isRulesVersion(ver, &RuleUpdateResponse{LatestRuleVersion: "0.3.10"}) {
+		t.Errorf("Expected latest release not to match pin")
+	}
+	if isRulesVersion(ver, nil) {
+		t.Errorf("Expected nil response not to match")
+	}
+}
+
+func TestPinnedRelease(t *testing.T) {
+	var (
+		ver    = semver.MustParse("0.3.9")
+		latest = &RuleUpdateResponse{
+			LatestRuleVersion: "0.3.10",
+			LatestRuleHash:    "abc",
+			RuleUrls: &PackageUrls{
+				DataUrl: "https://cdn.example.com/pkgs/prequel-public-cre-rules.0.3.10.gz?sig=abc",
+				HashUrl: "https://cdn.example.com/pkgs/prequel-public-cre-rules.0.3.10.gz.sha2",
+				SigUrl:  "https://cdn.example.com/pkgs/prequel-public-cre-rules.0.3.10.gz.sig",
+			},
+		}
+	)
+
+	r, err := pinnedRelease(latest, ver)
+	if err != nil {
+		t.Fatalf("pinnedRelease: %v", err)
+	}
+
+	if r.LatestRuleVersion != "0.3.9" || r.LatestRuleHash != "" {
+		t.Errorf("Expected 0.3.9 without a hash, got %s %q", r.LatestRuleVersion, r.LatestRuleHash)
+	}
+
+	want := []string{
+		"https://cdn.example.com/pkgs/prequel-public-cre-rules.0.3.9.gz",
+		"https://cdn.example.com/pkgs/prequel-public-cre-rules.0.3.9.gz.sha2",
+		"https://cdn.example.com/pkgs/prequel-public-cre-rules.0.3.9.gz.sig",
+	}
+	if got := []string{r.RuleUrls.DataUrl, r.RuleUrls.HashUrl, r.RuleUrls.SigUrl}; !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	latest.RuleUrls.DataUrl = "https://cdn.example.com/pkgs/latest.gz"
+	if _, err := pinnedRelease(latest, ver); !errors.Is(err, ErrPinnedRulesUnavailable) {
+		t.Errorf("Expected ErrPinnedRulesUnavailable for unversioned url, got %v", err)
+	}
+}
+
+// useTestKey replaces the embedded public key with a generated one for the test.
+func useTestKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v", err)
+	}
+
+	origKey := publicRulesKeyPEM
+	publicRulesKeyPEM = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	t.Cleanup(func() {
+		publicRulesKeyPEM = origKey
+	})
+
+	return key
+}
+
+func signFile(t *testing.T, key *ecdsa.PrivateKey, path string) ([]byte, []byte) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+
+	digest := sha256.Sum256(data)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign %s: %v", path, err)
+	}
+
+	return data, sig
+}
+
+func writeSigned(t *testing.T, key *ecdsa.PrivateKey, path string) {
+	t.Helper()
+
+	data, sig := signFile(t, key, path)
+	os.WriteFile(path+prequelRulesSha256Suffix, []byte(utils.Sha256Sum(data)+"\n"), 0644)
+	os.WriteFile(path+prequelRulesSigSuffix, sig, 0644)
+}
+
+func TestImportRulesBundle(t *testing.T) {
+	var (
+		key       = useTestKey(t)
+		srcDir    = t.TempDir()
+		configDir = t.TempDir()
+		bundle    = writeRulesPackage(t, srcDir, "0.4.1")
+		data, sig = signFile(t, key, bundle)
+	)
+
+	t.Run("Missing signature", func(t *testing.T) {
+		os.WriteFile(bundle+prequelRulesSha256Suffix, []byte(utils.Sha256Sum(data)+"  bundle.gz\n"), 0644)
+		if _, err := ImportRulesBundle(configDir, bundle); !errors.Is(err, ErrBundleFileMissing) {
+			t.Errorf("Expected ErrBundleFileMissing, got %v", err)
+		}
+	})
+
+	t.Run("Bad signature", func(t *testing.T) {
+		os.WriteFile(bundle+prequelRulesSigSuffix, sig[:len(sig)-1], 0644)
+		if _, err := ImportRulesBundle(configDir, bundle); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("Expected ErrInvalidSignature, got %v", err)
+		}
+	})
+
+	t.Run("Hash mismatch", func(t *testing.T) {
+		os.WriteFile(bundle+prequelRulesSigSuffix, sig, 0644)
+		os.WriteFile(bundle+prequelRulesSha256Suffix, []byte(strings.Repeat("0", 64)), 0644)
+		if _, err := ImportRulesBundle(configDir, bundle); !errors.Is(err, ErrHashMismatch) {
+			t.Errorf("Expected ErrHashMismatch, got %v", err)
+		}
+	})
+
+	t.Run("Verified and installed", func(t *testing.T) {
+		os.WriteFile(bundle+prequelRulesSha256Suffix, []byte(utils.Sha256Sum(data)+"  bundle.gz\n"), 0644)
+		pkg, err := ImportRulesBundle(configDir, bundle)
+		if err != nil {
+			t.Fatalf("ImportRulesBundle: %v", err)
+		}
+		if pkg.Version.String() != "0.4.1" || filepath.Dir(pkg.Path) != configDir {
+			t.Errorf("Expected 0.4.1 in %s, got %s at %s", configDir, pkg.Version, pkg.Path)
+		}
+
+		path, err := offlineRules(configDir, "")
+		if err != nil || path != pkg.Path {
+			t.Errorf("Expected offline rules %s, got %s (err=%v)", pkg.Path, path, err)
+		}
+
+		if _, err := offlineRules(configDir, "0.4.0"); !errors.Is(err, ErrRulesVersionNotFound) {
+			t.Errorf("Expected ErrRulesVersionNotFound for missing pin, got %v", err)
+		}
+	})
+}
+
+func TestMirror(t *testing.T) {
+	var (
+		key       = useTestKey(t)
+		mirrorDir = t.TempDir()
+		configDir = t.TempDir()
+		ctx       = context.Background()
+	)
+
+	for _, v := range []string{"0.5.0", "0.5.1"} {
+		writeSigned(t, key, writeRulesPackage(t, mirrorDir, v))
+	}
+
+	// Unsigned packages are not served
+	writeRulesPackage(t, mirrorDir, "0.6.0")
+
+	exe := filepath.Join(mirrorDir, "preq_1.4.0_linux_amd64")
+	os.WriteFile(exe, []byte("binary"), 0755)
+	writeSigned(t, key, exe)
+
+	srv := httptest.NewServer(NewMirror(mirrorDir, WithMirrorToken("secret")).Handler())
+	t.Cleanup(srv.Close)
+
+	t.Run("Rejects bad token", func(t *testing.T) {
+		if _, err := checkin(ctx, srv.URL, "wrong", semver.MustParse("0.0.0"), nil, 5*time.Second); err == nil {
+			t.Errorf("Expected checkin with bad token to fail")
+		}
+	})
+
+	t.Run("Checkin returns latest signed release", func(t *testing.T) {
+		resp, err := checkin(ctx, srv.URL, "secret", semver.MustParse("0.0.0"), nil, 5*time.Second)
+		if err != nil {
+			t.Fatalf("checkin: %v", err)
+		}
+		if resp.LatestRuleVersion != "0.5.1" || resp.LatestExeVersion != "1.4.0" {
+			t.Errorf("Expected rules 0.5.1 and exe 1.4.0, got %s and %s", resp.LatestRuleVersion, resp.LatestExeVersion)
+		}
+		if len(resp.ExeUrls) != 1 || resp.ExeUrls[0].Os != "linux" || resp.ExeUrls[0].Arch != "amd64" {
+			t.Errorf("Expected one linux/amd64 exe, got %+v", resp.ExeUrls)
+		}
+	})
+
+	t.Run("Pinned download verifies and installs", func(t *testing.T) {
+		resp, err := checkin(ctx, srv.URL, "secret", semver.MustParse("0.0.0"), semver.MustParse("0.5.0"), 5*time.Second)
+		if err != nil {
+			t.Fatalf("checkin: %v", err)
+		}
+		if !isRulesVersion(semver.MustParse("0.5.0"), resp) {
+			t.Fatalf("Expected pinned 0.5.0, got %s", resp.LatestRuleVersion)
+		}
+
+		path, err := requestRuleUpdate(ctx, resp, srv.URL, "secret", configDir, time.Second, 5*time.Second, true)
+		if err != nil {
+			t.Fatalf("requestRuleUpdate: %v", err)
+		}
+
+		ver, err := getRulesVersion(path)
+		if err != nil || ver.String() != "0.5.0" {
+			t.Errorf("Expected installed 0.5.0, got %v (err=%v)", ver, err)
+		}
+	})
+
+	t.Run("Pinned download from latest urls", func(t *testing.T) {
+		// Servers that ignore the pin describe the latest release
+		resp, err := checkin(ctx, srv.URL, "secret", semver.MustParse("0.0.0"), nil, 5*time.Second)
+		if err != nil {
+			t.Fatalf("checkin: %v", err)
+		}
+
+		pinResp, err := pinnedRelease(resp, semver.MustParse("0.5.0"))
+		if err != nil {
+			t.Fatalf("pinnedRelease: %v", err)
+		}
+
+		path, err := requestRuleUpdate(ctx, pinResp, srv.URL, "secret", t.TempDir(), time.Second, 5*time.Second, true)
+		if err != nil {
+			t.Fatalf("requestRuleUpdate: %v", err)
+		}
+
+		ver, err := getRulesVersion(path)
+		if err != nil || ver.String() != "0.5.0" {
+			t.Errorf("Expected installed 0.5.0, got %v (err=%v)", ver, err)
+		}
+	})
+
+	getFile := func(t *testing.T, name, token string) int {
+		t.Helper()
+		req, err := http.NewRequest("GET", srv.URL+mirrorFilesPath+name, nil)
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	t.Run("Serves indexed files only", func(t *testing.T) {
+		if code := getFile(t, filepath.Base(fmt.Sprintf(rulesFilenameFmt, ".0.6.0")), "secret"); code != http.StatusNotFound {
+			t.Errorf("Expected unsigned package to be 404, got %d", code)
+		}
+	})
+
+	t.Run("Files require the token", func(t *testing.T) {
+		name := filepath.Base(fmt.Sprintf(rulesFilenameFmt, ".0.5.1"))
+		for token, want := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, "secret": http.StatusOK} {
+			if code := getFile(t, name, token); code != want {
+				t.Errorf("Expected %d with token %q, got %d", want, token, code)
+			}
+		}
+	})
+}
+
+func TestRewriteDownloadUrls(t *testing.T) {
+	r := &RuleUpdateResponse{
+		RuleUrls: &PackageUrls{
+			DataUrl: "https://origin.example.com/pkgs/prequel-public-cre-rules.0.5.1.gz?sig=abc",
+			HashUrl: "https://origin.example.com/pkgs/prequel-public-cre-rules.0.5.1.gz.sha2",
+		},
+	}
+
+	if err := rewriteDownloadUrls(r, "https://cdn.internal/preq/"); err != nil {
+		t.Fatalf("rewriteDownloadUrls: %v", err)
+	}
+
+	if r.RuleUrls.DataUrl != "https://cdn.internal/preq/prequel-public-cre-rules.0.5.1.gz" {
+		t.Errorf("Unexpected data url %s", r.RuleUrls.DataUrl)
+	}
+	if r.RuleUrls.SigUrl != "" {
+		t.Errorf("Expected empty sig url to stay empty, got %s", r.RuleUrls.SigUrl)
+	}
+}
+
+func TestUserRulesSignatures(t *testing.T) {
+
+	dir := t.TempDir()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	sec1, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal private key: %v", err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal private key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %v", err)
+	}
+
+	var (
+		privPEM  = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1})
+		pkcs8PEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+		pubPEM   = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+		pubPath  = filepath.Join(dir, "org_pub.pem")
+		rulePath = filepath.Join(dir, "rules.yaml")
+	)
+
+	if err := os.WriteFile(pubPath, pubPEM, 0644); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+
+	writeRules := func(t *testing.T, data string) {
+		t.Helper()
+		if err := os.WriteFile(rulePath, []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to write rules: %v", err)
+		}
+	}
+
+	getRules := func(require bool) error {
+		conf := &config.Config{Offline: true}
+		conf.Rules.Signing = config.Signing{PublicKey: pubPath, Require: require}
+		_, err := GetRules(context.Background(), conf, dir, rulePath, "", "", "", 0, 0)
+		return err
+	}
+
+	writeRules(t, "rules: []\n")
+
+	t.Run("Unsigned", func(t *testing.T) {
+		if err := VerifyRulesFile(rulePath, pubPEM); !errors.Is(err, ErrUnsignedRules) {
+			t.Errorf("Expected ErrUnsignedRules, got %v", err)
+		}
+		if err := getRules(true); !errors.Is(err, ErrUnsignedRules) {
+			t.Errorf("Expected required signatures to refuse unsigned rules, got %v", err)
+		}
+		if err := getRules(false); err != nil {
+			t.Errorf("Expected optional signatures to load unsigned rules, got %v", err)
+		}
+	})
+
+	for name, priv := range map[string][]byte{"SEC 1": privPEM, "PKCS 8": pkcs8PEM} {
+		t.Run("Signed with "+name+" key", func(t *testing.T) {
+			writeRules(t, "rules: []\n")
+			if _, err := SignRulesFile(rulePath, priv); err != nil {
+				t.Fatalf("SignRulesFile failed: %v", err)
+			}
+			if err := VerifyRulesFile(rulePath, pubPEM); err != nil {
+				t.Errorf("VerifyRulesFile failed: %v", err)
+			}
+			if err := getRules(true); err != nil {
+				t.Errorf("Expected signed rules to load, got %v", err)
+			}
+		})
+	}
+
+	t.Run("Verified contents are compiled", func(t *testing.T) {
+		writeRules(t, "rules: []\n")
+		if _, err := SignRulesFile(rulePath, privPEM); err != nil {
+			t.Fatalf("SignRulesFile failed: %v", err)
+		}
+
+		conf := &config.Config{Offline: true}
+		conf.Rules.Signing = config.Signing{PublicKey: pubPath, Require: true}
+		paths, err := GetRules(context.Background(), conf, dir, rulePath, "", "", "", 0, 0)
+		if err != nil {
+			t.Fatalf("GetRules failed: %v", err)
+		}
+
+		writeRules(t, "rules: []\n# replaced\n")
+
+		if len(paths) != 1 || string(paths[0].Data) != "rules: []\n" {
+			t.Errorf("Expected the verified contents, got %+v", paths)
+		}
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		writeRules(t, "rules: []\n# silenced\n")
+		if err := VerifyRulesFile(rulePath, pubPEM); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("Expected ErrInvalidSignature, got %v", err)
+		}
+		if err := getRules(true); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("Expected required signatures to refuse tampered rules, got %v", err)
+		}
+	})
+
+	t.Run("Invalid key", func(t *testing.T) {
+		if _, err := SignRulesFile(rulePath, pubPEM); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Expected ErrInvalidKey, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package rules
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/prequel-dev/preq/internal/pkg/config"
+	"github.com/prequel-dev/preq/internal/pkg/utils"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrUnsignedRules = errors.New("unsigned rules")
+)
+
+// SigPath is where the signature of a user rules file is kept.
+func SigPath(path string) string {
+	return path + prequelRulesSigSuffix
+}
+
+// verifySignature checks an ASN.1 ECDSA signature of the data's sha256 against a PEM public key.
+func verifySignature(pubPEM, data, sig []byte) error {
+
+	block, _ := pem.Decode(pubPEM)
+	if block == nil {
+		return ErrInvalidKey
+	}
+
+	pubKeyInterface, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	pubKey, ok := pubKeyInterface.(*ecdsa.PublicKey)
+	if !ok {
+		return ErrInvalidKey
+	}
+
+	hashed := sha256.Sum256(data)
+
+	if !ecdsa.VerifyASN1(pubKey, hashed[:], sig) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+func parsePrivateKey(privPEM []byte) (*ecdsa.PrivateKey, error) {
+
+	block, _ := pem.Decode(privPEM)
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+
+	// openssl ecparam writes SEC 1 keys; openssl genpkey writes PKCS #8
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	keyInterface, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+
+	key, ok := keyInterface.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+
+	return key, nil
+}
+
+// SignRulesFile signs a user rules file with a PEM ECDSA private key and writes the
+// signature next to it. Returns the signature path.
+func SignRulesFile(path string, privPEM []byte) (string, error) {
+
+	key, err := parsePrivateKey(privPEM)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	hashed := sha256.Sum256(data)
+
+	sig, err := ecdsa.SignASN1(rand.Reader, key, hashed[:])
+	if err != nil {
+		return "", err
+	}
+
+	sigPath := SigPath(path)
+	if err = os.WriteFile(sigPath, sig, 0644); err != nil {
+		return "", err
+	}
+
+	return sigPath, nil
+}
+
+// VerifyRulesFile checks a user rules file against its signature and a PEM ECDSA public key.
+// Returns ErrUnsignedRules if there is no signature and ErrInvalidSignature if it does not match.
+func VerifyRulesFile(path string, pubPEM []byte) error {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	return verifyRulesData(path, data, pubPEM)
+}
+
+// verifyRulesData checks the contents of a user rules file against the signature kept next to it.
+func verifyRulesData(path string, data, pubPEM []byte) error {
+
+	sig, err := os.ReadFile(SigPath(path))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return fmt.Errorf("%w: %s", ErrUnsignedRules, path)
+	case err != nil:
+		return err
+	}
+
+	if err = verifySignature(pubPEM, data, sig); err != nil {
+		return fmt.Errorf("%w: %s", err, path)
+	}
+
+	return nil
+}
+
+// userRulePaths checks user rules files against the org key, if one is configured.
+// Unsigned or tampered files are refused when signatures are required, otherwise logged.
+// Checked files are read once and their contents compiled, so a file replaced after the
+// check is not picked up.
+func userRulePaths(s config.Signing, files []string) ([]utils.RulePathT, error) {
+
+	var paths = make([]utils.RulePathT, 0, len(files))
+
+	if s.PublicKey == "" {
+		for _, fn := range files {
+			paths = append(paths, utils.RulePathT{Path: fn, Type: utils.RuleTypeUser})
+		}
+		return paths, nil
+	}
+
+	pubPEM, err := os.ReadFile(s.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fn := range files {
+
+		data, err := os.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+
+		err = verifyRulesData(fn, data, pubPEM)
+		switch {
+		case err == nil:
+			log.Info().Str("path", fn).Msg("Verified user rules signature")
+		case s.Require:
+			log.Error().Err(err).Str("path", fn).Msg("Refusing user rules")
+			return nil, err
+		default:
+			log.Warn().Err(err).Str("path", fn).Msg("User rules signature not verified. Continue...")
+		}
+
+		paths = append(paths, utils.RulePathT{Path: fn, Type: utils.RuleTypeUser, Data: data})
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,197 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// Records the version selected with `preq rules use|rollback`
+	rulesSelectFile = "rules-version"
+	rulesLatest     = "latest"
+)
+
+var (
+	ErrInvalidRulesVersion    = errors.New("invalid rules version")
+	ErrRulesVersionNotFound   = errors.New("rules version not installed")
+	ErrNoPrevRulesVersion     = errors.New("no earlier rules version installed")
+	ErrPinnedRulesUnavailable = errors.New("pinned rules version not available for download")
+)
+
+// RulesPackageT is a signed community rules package downloaded to the config dir.
+type RulesPackageT struct {
+	Version *semver.Version
+	Path    string
+}
+
+// ListRulesVersions returns the installed rules packages, oldest first.
+func ListRulesVersions(configDir string) ([]RulesPackageT, error) {
+
+	var (
+		pattern  = filepath.Join(configDir, fmt.Sprintf(rulesFilenameFmt, "*"))
+		packages []string
+		pkgs     []RulesPackageT
+		err      error
+	)
+
+	if packages, err = filepath.Glob(pattern); err != nil {
+		return nil, err
+	}
+
+	for _, p := range packages {
+		ver, err := getRulesVersion(p)
+		if err != nil {
+			log.Error().Err(err).Str("path", p).Msg("Failed to get rules version")
+			return nil, err
+		}
+		pkgs = append(pkgs, RulesPackageT{Version: ver, Path: p})
+	}
+
+	sort.SliceStable(pkgs, func(i, j int) bool {
+		return pkgs[i].Version.LessThan(pkgs[j].Version)
+	})
+
+	return pkgs, nil
+}
+
+// SelectedRulesVersion returns the version selected with `preq rules use|rollback`, or nil if none.
+func SelectedRulesVersion(configDir string) (*semver.Version, error) {
+
+	data, err := os.ReadFile(filepath.Join(configDir, rulesSelectFile))
+	switch {
+	case os.IsNotExist(err):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	return parseRulesVersion(strings.TrimSpace(string(data)))
+}
+
+// UseRulesVersion selects an installed rules version. "latest" clears the selection so updates apply again.
+func UseRulesVersion(configDir, version string) (*RulesPackageT, error) {
+
+	pkgs, err := ListRulesVersions(configDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if version == rulesLatest {
+		if err = os.Remove(filepath.Join(configDir, rulesSelectFile)); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if len(pkgs) == 0 {
+			return nil, ErrNoRulesRelease
+		}
+		return &pkgs[len(pkgs)-1], nil
+	}
+
+	ver, err := parseRulesVersion(version)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg, ok := findRulesVersion(pkgs, ver)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRulesVersionNotFound, ver)
+	}
+
+	if err = selectRulesVersion(configDir, ver); err != nil {
+		return nil, err
+	}
+
+	return pkg, nil
+}
+
+// RollbackRulesVersion selects the newest installed version older than the active one.
+func RollbackRulesVersion(configDir string) (*RulesPackageT, error) {
+
+	pkgs, err := ListRulesVersions(configDir)
+	if err != nil {
+		return nil, err
+	}
+
+	curr, _, err := currentRulesVersion(pkgs, selectedRulesVersion(configDir))
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(pkgs) - 1; i >= 0; i-- {
+		if pkgs[i].Version.LessThan(curr) {
+			if err = selectRulesVersion(configDir, pkgs[i].Version); err != nil {
+				return nil, err
+			}
+			return &pkgs[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrNoPrevRulesVersion, curr)
+}
+
+// pinnedRulesVersion returns the version pinned by the config, else the one selected with
+// `preq rules use|rollback`. Pinned versions are never updated past.
+func pinnedRulesVersion(configDir, confVersion string) (*semver.Version, error) {
+
+	if confVersion != "" {
+		return parseRulesVersion(confVersion)
+	}
+
+	return SelectedRulesVersion(configDir)
+}
+
+// currentRulesVersion returns the pinned package, or the latest if pin is nil.
+func currentRulesVersion(pkgs []RulesPackageT, pin *semver.Version) (*semver.Version, string, error) {
+
+	if pin != nil {
+		pkg, ok := findRulesVersion(pkgs, pin)
+		if !ok {
+			return nil, "", fmt.Errorf("%w: %s", ErrRulesVersionNotFound, pin)
+		}
+		return pkg.Version, pkg.Path, nil
+	}
+
+	if len(pkgs) == 0 {
+		return nil, "", ErrNoRulesRelease
+	}
+
+	latest := pkgs[len(pkgs)-1]
+
+	return latest.Version, latest.Path, nil
+}
+
+func selectedRulesVersion(configDir string) *semver.Version {
+	ver, err := SelectedRulesVersion(configDir)
+	if err != nil {
+		log.Warn().Err(err).Msg("Ignoring invalid rules version selection")
+		return nil
+	}
+	return ver
+}
+
+func selectRulesVersion(configDir string, ver *semver.Version) error {
+	return os.WriteFile(filepath.Join(configDir, rulesSelectFile), []byte(ver.String()+"\n"), 0644)
+}
+
+func findRulesVersion(pkgs []RulesPackageT, ver *semver.Version) (*RulesPackageT, bool) {
+	for i := len(pkgs) - 1; i >= 0; i-- {
+		if pkgs[i].Version.Equal(ver) {
+			return &pkgs[i], true
+		}
+	}
+	return nil, false
+}
+
+func parseRulesVersion(s string) (*semver.Version, error) {
+	ver, err := semver.NewVersion(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRulesVersion, s)
+	}
+	return ver, nil
+}
@@ -0,0 +1,281 @@
+package ruletest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/prequel-dev/preq/internal/pkg/utils"
+	"github.com/prequel-dev/preq/internal/pkg/ux"
+	"github.com/prequel-dev/preq/pkg/eval"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrNoRules    = errors.New("test spec requires a rules file")
+	ErrNoTests    = errors.New("test spec has no tests")
+	ErrNoFixtures = errors.New("test requires at least one fixture")
+	ErrNoCre      = errors.New("expectation requires a cre id")
+)
+
+// SpecT is a rule test spec. Paths are relative to the spec file. Rules are compiled as
+// user rules the same way as preq -r, and may be a file, directory or glob pattern:
+//
+//	rules: ../rules/kafka.yaml
+//	config: config.yaml          # optional timestamp formats, window, etc.
+//	tests:
+//	  - name: broker oom
+//	    fixtures:
+//	      - path: logs/broker-oom.log
+//	        type: cre.log.kafka  # omit to match every rule
+//	    expect:
+//	      - cre: CRE-2025-0001
+//	        hits: 1              # detections; omit for at least one
+//	        timestamps:
+//	          - 2025-03-01T10:00:05Z
+//	      - cre: CRE-2025-0002
+//	        hits: 0              # must not match
+//
+// Detections of CREs not listed in expect fail the test.
+type SpecT struct {
+	Rules  string  `yaml:"rules"`
+	Config string  `yaml:"config,omitempty"`
+	Tests  []TestT `yaml:"tests"`
+
+	dir string
+}
+
+type TestT struct {
+	Name     string     `yaml:"name"`
+	Fixtures []FixtureT `yaml:"fixtures"`
+	Expect   []ExpectT  `yaml:"expect"`
+}
+
+type FixtureT struct {
+	Path string `yaml:"path"`
+	Type string `yaml:"type,omitempty"`
+}
+
+type ExpectT struct {
+	Cre        string      `yaml:"cre"`
+	Hits       *int        `yaml:"hits,omitempty"`
+	Timestamps []time.Time `yaml:"timestamps,omitempty"`
+}
+
+// ResultT is the outcome of one test. Diffs lists each expectation that did not hold.
+type ResultT struct {
+	Name  string
+	Err   error
+	Diffs []string
+}
+
+func (r ResultT) Passed() bool {
+	return r.Err == nil && len(r.Diffs) == 0
+}
+
+func LoadSpec(path string) (*SpecT, error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var spec SpecT
+	if err = yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err = spec.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	spec.dir = filepath.Dir(path)
+
+	return &spec, nil
+}
+
+func (s *SpecT) Validate() error {
+
+	if s.Rules == "" {
+		return ErrNoRules
+	}
+
+	if len(s.Tests) == 0 {
+		return ErrNoTests
+	}
+
+	for i, t := range s.Tests {
+		if len(t.Fixtures) == 0 {
+			return fmt.Errorf("test %d: %w", i, ErrNoFixtures)
+		}
+		for _, e := range t.Expect {
+			if e.Cre == "" {
+				return fmt.Errorf("test %d: %w", i, ErrNoCre)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *SpecT) path(p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(s.dir, p)
+}
+
+// Run runs each test in the spec.
+func (s *SpecT) Run(ctx context.Context) ([]ResultT, error) {
+
+	var (
+		cfg     []byte
+		files   []string
+		rules   = s.path(s.Rules)
+		results = make([]ResultT, 0, len(s.Tests))
+		err     error
+	)
+
+	// Fail the spec rather than each test when the rules are missing
+	if files, err = utils.ExpandRulesPath(rules); err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%w: no rule files in %s", ErrNoRules, rules)
+	}
+
+	for _, fn := range files {
+		if _, err = os.Stat(fn); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.Config != "" {
+		if cfg, err = os.ReadFile(s.path(s.Config)); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, t := range s.Tests {
+		r := s.runTest(ctx, string(cfg), rules, t)
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("test %d", i)
+		}
+		results = append(results, r)
+	}
+
+	return results, nil
+}
+
+func (s *SpecT) runTest(ctx context.Context, cfg, rules string, t TestT) ResultT {
+
+	var (
+		res  = ResultT{Name: t.Name}
+		srcs = make([]eval.SourceT, 0, len(t.Fixtures))
+	)
+
+	for _, f := range t.Fixtures {
+		data, err := os.ReadFile(s.path(f.Path))
+		if err != nil {
+			res.Err = err
+			return res
+		}
+		srcs = append(srcs, eval.SourceT{Name: f.Path, Type: f.Type, Data: data})
+	}
+
+	report, _, err := eval.DetectSourcesFiles(ctx, cfg, []string{rules}, srcs)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	res.Diffs = Compare(t.Expect, report)
+
+	return res
+}
+
+// Compare returns a description of each difference between the expectations and the detections in the report.
+func Compare(expect []ExpectT, report *ux.ReportT) []string {
+
+	var (
+		diffs    []string
+		expected = make(map[string]struct{}, len(expect))
+	)
+
+	for _, e := range expect {
+		expected[e.Cre] = struct{}{}
+
+		got := detections(report, e.Cre)
+
+		switch {
+		case e.Hits != nil && *e.Hits != len(got):
+			diffs = append(diffs, fmt.Sprintf("%s: expected %d detection(s), got %d", e.Cre, *e.Hits, len(got)))
+		case e.Hits == nil && len(got) == 0:
+			diffs = append(diffs, fmt.Sprintf("%s: expected detection, got none", e.Cre))
+		}
+
+		if len(e.Timestamps) > 0 {
+			diffs = append(diffs, diffTimestamps(e.Cre, e.Timestamps, got)...)
+		}
+	}
+
+	unexpected := make([]string, 0)
+	for cre := range report.CreHits {
+		if _, ok := expected[cre]; !ok {
+			unexpected = append(unexpected, cre)
+		}
+	}
+	sort.Strings(unexpected)
+
+	for _, cre := range unexpected {
+		diffs = append(diffs, fmt.Sprintf("%s: unexpected %d detection(s)", cre, len(report.CreHits[cre])))
+	}
+
+	return diffs
+}
+
+func detections(report *ux.ReportT, cre string) []time.Time {
+
+	got := append([]time.Time(nil), report.CreHits[cre]...)
+
+	sort.Slice(got, func(i, j int) bool {
+		return got[i].Before(got[j])
+	})
+
+	return got
+}
+
+// diffTimestamps lists missing (-) and unexpected (+) detection timestamps.
+func diffTimestamps(cre string, want, got []time.Time) []string {
+
+	var (
+		diffs  []string
+		remain = make(map[int64]int, len(got))
+	)
+
+	for _, ts := range got {
+		remain[ts.UnixNano()] += 1
+	}
+
+	for _, ts := range want {
+		if remain[ts.UnixNano()] > 0 {
+			remain[ts.UnixNano()] -= 1
+			continue
+		}
+		diffs = append(diffs, fmt.Sprintf("%s: - %s", cre, ts.UTC().Format(time.RFC3339Nano)))
+	}
+
+	for _, ts := range got {
+		if remain[ts.UnixNano()] > 0 {
+			remain[ts.UnixNano()] -= 1
+			diffs = append(diffs, fmt.Sprintf("%s: + %s", cre, ts.UTC().Format(time.RFC3339Nano)))
+		}
+	}
+
+	return diffs
+}
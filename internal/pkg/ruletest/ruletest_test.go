@@ -0,0 +1,189 @@
+package ruletest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSpec = `rules: rules.yaml
+tests:
+  - name: match
+    fixtures:
+      - path: logs/kafka.log
+        type: cre.log.kafka
+    expect:
+      - cre: set-example
+        hits: 1
+        timestamps:
+          - 2019-02-05T12:07:38Z
+  - name: other source type
+    fixtures:
+      - path: logs/kafka.log
+        type: cre.log.nginx
+    expect:
+      - cre: set-example
+        hits: 0
+  - name: wrong count
+    fixtures:
+      - path: logs/kafka.log
+    expect:
+      - cre: set-example
+        hits: 2
+  - name: wrong timestamp
+    fixtures:
+      - path: logs/kafka.log
+    expect:
+      - cre: set-example
+        timestamps:
+          - 2019-02-05T12:07:39Z
+  - name: unexpected
+    fixtures:
+      - path: logs/kafka.log
+    expect: []
+`
+
+func copyFile(t *testing.T, src, dst string) {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(dst, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRun(t *testing.T) {
+
+	// Rules and fixture paths are relative to the spec file
+	dir := t.TempDir()
+	copyFile(t, "../../../examples/01-set-single-example.yaml", filepath.Join(dir, "rules.yaml"))
+	copyFile(t, "../../../examples/01-example.log", filepath.Join(dir, "logs", "kafka.log"))
+
+	path := filepath.Join(dir, "spec.yaml")
+	if err := os.WriteFile(path, []byte(testSpec), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	spec, err := LoadSpec(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	results, err := spec.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		passed bool
+		diffs  []string
+	}{
+		{name: "match", passed: true},
+		{name: "other source type", passed: true},
+		{name: "wrong count", diffs: []string{"set-example: expected 2 detection(s), got 1"}},
+		{name: "wrong timestamp", diffs: []string{
+			"set-example: - 2019-02-05T12:07:39Z",
+			"set-example: + 2019-02-05T12:07:38Z",
+		}},
+		{name: "unexpected", diffs: []string{"set-example: unexpected 1 detection(s)"}},
+	}
+
+	if len(results) != len(tests) {
+		t.Fatalf("Expected %d results, got %d", len(tests), len(results))
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := results[i]
+			if r.Err != nil {
+				t.Fatalf("Expected no error, got %v", r.Err)
+			}
+			if r.Passed() != tt.passed {
+				t.Errorf("Expected passed=%v, got %v (%v)", tt.passed, r.Passed(), r.Diffs)
+			}
+			if strings.Join(r.Diffs, "\n") != strings.Join(tt.diffs, "\n") {
+				t.Errorf("Expected diffs %q, got %q", tt.diffs, r.Diffs)
+			}
+		})
+	}
+}
+
+func TestRunRulesPath(t *testing.T) {
+
+	// Rules load as with preq -r: directories are walked for rule documents
+	dir := t.TempDir()
+	copyFile(t, "../../../examples/01-set-single-example.yaml", filepath.Join(dir, "rules", "kafka.yaml"))
+	copyFile(t, "../../../examples/01-example.log", filepath.Join(dir, "logs", "kafka.log"))
+
+	if err := os.WriteFile(filepath.Join(dir, "rules", "sources.yaml"), []byte("sources: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(t *testing.T, rules string) ([]ResultT, error) {
+		t.Helper()
+		spec := &SpecT{
+			Rules: rules,
+			Tests: []TestT{{
+				Name:     "match",
+				Fixtures: []FixtureT{{Path: "logs/kafka.log"}},
+				Expect:   []ExpectT{{Cre: "set-example"}},
+			}},
+			dir: dir,
+		}
+		return spec.Run(context.Background())
+	}
+
+	t.Run("Directory", func(t *testing.T) {
+		results, err := run(t, "rules")
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(results) != 1 || !results[0].Passed() {
+			t.Errorf("Expected the test to pass, got %+v", results)
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		if _, err := run(t, "missing.yaml"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected os.ErrNotExist, got %v", err)
+		}
+		if _, err := run(t, "logs"); !errors.Is(err, ErrNoRules) {
+			t.Errorf("Expected ErrNoRules, got %v", err)
+		}
+	})
+}
+
+func TestLoadSpec(t *testing.T) {
+
+	tests := []struct {
+		name string
+		spec string
+		err  error
+	}{
+		{name: "no rules", spec: "tests:\n  - fixtures: [{path: a.log}]\n", err: ErrNoRules},
+		{name: "no tests", spec: "rules: r.yaml\n", err: ErrNoTests},
+		{name: "no fixtures", spec: "rules: r.yaml\ntests:\n  - name: a\n", err: ErrNoFixtures},
+		{name: "no cre", spec: "rules: r.yaml\ntests:\n  - fixtures: [{path: a.log}]\n    expect: [{hits: 1}]\n", err: ErrNoCre},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "spec.yaml")
+			if err := os.WriteFile(path, []byte(tt.spec), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadSpec(path); !errors.Is(err, tt.err) {
+				t.Errorf("Expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
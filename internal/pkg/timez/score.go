@@ -0,0 +1,72 @@
+package timez
+
+import (
+	"bufio"
+	"bytes"
+	"time"
+
+	"github.com/prequel-dev/prequel-logmatch/pkg/format"
+)
+
+// ScoreT rates how well a timestamp format fits a log sample.
+type ScoreT struct {
+	Lines     int // Lines in the sample
+	Matched   int // Lines with a parsed timestamp
+	Ordered   int // Parsed timestamps not older than the previous one
+	Precision int // Finest sub-second unit seen: 0=s, 1=ms, 2=us, 3=ns
+}
+
+// Better reports whether s is a better fit than o. Ties keep o, so earlier candidates win.
+func (s ScoreT) Better(o ScoreT) bool {
+	switch {
+	case s.Matched != o.Matched:
+		return s.Matched > o.Matched
+	case s.Ordered != o.Ordered:
+		return s.Ordered > o.Ordered
+	default:
+		return s.Precision > o.Precision
+	}
+}
+
+// ScoreFactory parses every line of the sample with a fresh parser from the factory.
+func ScoreFactory(factory format.FactoryI, buf []byte) ScoreT {
+
+	var (
+		s       ScoreT
+		prev    int64
+		parser  = factory.New()
+		scanner = bufio.NewScanner(bytes.NewReader(buf))
+	)
+
+	for scanner.Scan() {
+		s.Lines += 1
+
+		entry, err := parser.ReadEntry(scanner.Bytes())
+		if err != nil || entry.Timestamp == 0 {
+			continue
+		}
+
+		if s.Matched > 0 && entry.Timestamp >= prev {
+			s.Ordered += 1
+		}
+
+		s.Matched += 1
+		s.Precision = max(s.Precision, precision(entry.Timestamp))
+		prev = entry.Timestamp
+	}
+
+	return s
+}
+
+func precision(ts int64) int {
+	switch {
+	case ts%int64(time.Second) == 0:
+		return 0
+	case ts%int64(time.Millisecond) == 0:
+		return 1
+	case ts%int64(time.Microsecond) == 0:
+		return 2
+	default:
+		return 3
+	}
+}
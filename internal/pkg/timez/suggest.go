@@ -0,0 +1,154 @@
+package timez
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Layout elements and the expressions that match them. Longer elements come first.
+var layoutElems = []struct {
+	elem string
+	exp  string
+}{
+	{"January", `[A-Z][a-z]+`},
+	{"Monday", `[A-Z][a-z]+`},
+	{"Z07:00", `(?:Z|[+\-]\d{2}:\d{2})`},
+	{"-07:00", `[+\-]\d{2}:\d{2}`},
+	{"-0700", `[+\-]\d{4}`},
+	{".000000000", `\.\d{9}`},
+	{".000000", `\.\d{6}`},
+	{".000", `\.\d{3}`},
+	{",000", `,\d{3}`},
+	{".999999999", `(?:\.\d+)?`},
+	{"2006", `\d{4}`},
+	{"Jan", `[A-Z][a-z]{2}`},
+	{"Mon", `[A-Z][a-z]{2}`},
+	{"MST", `[A-Z]{3,4}`},
+	{"_2", `[ \d]\d`},
+	{"01", `\d{2}`},
+	{"02", `\d{2}`},
+	{"03", `\d{2}`},
+	{"04", `\d{2}`},
+	{"05", `\d{2}`},
+	{"15", `\d{2}`},
+	{"PM", `(?:AM|PM)`},
+	{" ", `\s`},
+}
+
+// Layouts tried when suggesting a timestamp format for an unsupported log.
+var suggestLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.000000Z07:00",
+	"2006-01-02T15:04:05.000Z07:00",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02T15:04:05.000-0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05.000000-0700",
+	"2006-01-02 15:04:05.000000",
+	"2006-01-02 15:04:05,000",
+	"2006-01-02 15:04:05.000",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006/01/02 15:04:05.000000",
+	"2006/01/02 15:04:05",
+	"2006.01.02 15:04:05",
+	"02/Jan/2006:15:04:05 -0700",
+	"02-01-2006 15:04:05",
+	"02.01.2006 15:04:05",
+	"01/02/2006 03:04:05 PM",
+	"01/02/2006, 15:04:05",
+	"02 Jan 2006 15:04:05.000",
+	"Mon Jan _2 15:04:05 2006",
+	"Mon, 02 Jan 2006 15:04:05 MST",
+	"Mon Jan _2 15:04:05 MST 2006",
+	"Jan _2, 2006 03:04:05 PM",
+	"Jan _2 15:04:05.000000",
+	"Jan _2 15:04:05",
+	"0102 15:04:05.000000",
+}
+
+// LayoutRegex returns an expression that matches timestamps in the given Go time layout.
+func LayoutRegex(layout string) string {
+	var sb strings.Builder
+
+LOOP:
+	for len(layout) > 0 {
+		for _, le := range layoutElems {
+			if strings.HasPrefix(layout, le.elem) {
+				sb.WriteString(le.exp)
+				layout = layout[len(le.elem):]
+				continue LOOP
+			}
+		}
+		sb.WriteString(regexp.QuoteMeta(layout[:1]))
+		layout = layout[1:]
+	}
+
+	return sb.String()
+}
+
+type SuggestionT struct {
+	Pattern string
+	Format  TimestampFmt
+	Example string
+	Line    int
+}
+
+// Suggest looks for a known timestamp layout in the given lines and returns a timestamps pattern for the first one found.
+// Matches anchored at the start of the line are preferred.
+func Suggest(lines []string) (SuggestionT, bool) {
+
+	var (
+		best  SuggestionT
+		found bool
+	)
+
+	for idx, line := range lines {
+		for _, layout := range suggestLayouts {
+
+			exp := regexp.MustCompile(LayoutRegex(layout))
+
+			loc := exp.FindStringIndex(line)
+			if loc == nil {
+				continue
+			}
+
+			m := line[loc[0]:loc[1]]
+			if _, err := time.Parse(layout, m); err != nil {
+				continue
+			}
+
+			var (
+				pattern  = "(" + exp.String() + ")"
+				anchored = true
+			)
+
+			switch {
+			case loc[0] == 0:
+				pattern = "^" + pattern
+			case loc[0] == 1 && strings.ContainsRune("[(<", rune(line[0])):
+				pattern = "^" + regexp.QuoteMeta(line[:1]) + pattern
+			default:
+				anchored = false
+			}
+
+			s := SuggestionT{
+				Pattern: pattern,
+				Format:  TimestampFmt(layout),
+				Example: m,
+				Line:    idx + 1,
+			}
+
+			if anchored {
+				return s, true
+			}
+
+			if !found {
+				best, found = s, true
+			}
+		}
+	}
+
+	return best, found
+}
@@ -0,0 +1,90 @@
+package timez
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/prequel-dev/prequel-logmatch/pkg/format"
+)
+
+const (
+	FactorySynthetic = "synthetic"
+
+	// Each line advances the synthetic clock by this much.
+	SyntheticStep = time.Millisecond
+)
+
+type SyntheticMode string
+
+const (
+	SyntheticNone  SyntheticMode = ""
+	SyntheticLine  SyntheticMode = "line"  // Timestamp is the line number times SyntheticStep since the epoch
+	SyntheticMtime SyntheticMode = "mtime" // Timestamp is the reference time (e.g. file mtime) plus the line offset
+)
+
+var (
+	ErrSyntheticMode = errors.New("unknown synthetic timestamp mode")
+)
+
+func (m SyntheticMode) Validate() error {
+	switch m {
+	case SyntheticNone, SyntheticLine, SyntheticMtime:
+		return nil
+	}
+	return ErrSyntheticMode
+}
+
+// syntheticFactoryT assigns monotonically increasing timestamps to logs that do not carry any.
+type syntheticFactoryT struct {
+	base int64
+}
+
+// NewSyntheticFactory returns a factory for the given mode. The reference time is used by SyntheticMtime and defaults to now.
+func NewSyntheticFactory(mode SyntheticMode, refTime time.Time) (format.FactoryI, error) {
+
+	var base int64
+
+	switch mode {
+	case SyntheticLine:
+	case SyntheticMtime:
+		if refTime.IsZero() {
+			refTime = time.Now()
+		}
+		base = refTime.UnixNano()
+	default:
+		return nil, ErrSyntheticMode
+	}
+
+	return &syntheticFactoryT{base: base}, nil
+}
+
+func (f *syntheticFactoryT) New() format.ParserI {
+	return &syntheticParserT{base: f.base}
+}
+
+func (f *syntheticFactoryT) String() string {
+	return FactorySynthetic
+}
+
+type syntheticParserT struct {
+	base int64
+	line int64
+}
+
+func (p *syntheticParserT) ReadTimestamp(rdr io.Reader) (int64, error) {
+	return p.base + int64(SyntheticStep), nil
+}
+
+func (p *syntheticParserT) ReadEntry(line []byte) (format.LogEntry, error) {
+	p.line += 1
+	return format.LogEntry{
+		Line:      string(line),
+		Timestamp: p.base + p.line*int64(SyntheticStep),
+	}, nil
+}
+
+// IsSynthetic returns true if the factory assigns synthetic timestamps.
+func IsSynthetic(factory format.FactoryI) bool {
+	return factory.String() == FactorySynthetic
+}
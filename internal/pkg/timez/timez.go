@@ -97,7 +97,31 @@ func epochAny(m []byte) (int64, error) {
 
 }
 
-func TryTimestampFormat(exp string, fmtStr TimestampFmt, buf []byte, maxTries int) (format.FactoryI, int64, error) {
+type OptT func(*yearOptsT)
+
+// WithYear pins the year used for timestamp formats that do not carry one.
+func WithYear(year int) OptT {
+	return func(o *yearOptsT) {
+		o.year = year
+	}
+}
+
+// WithRefTime sets the latest expected timestamp (e.g. the file mtime) used to infer the year for timestamp formats that do not carry one.
+func WithRefTime(t time.Time) OptT {
+	return func(o *yearOptsT) {
+		o.refTime = t
+	}
+}
+
+// WithReverse resolves the year of entries read newest first, as when scanning backwards from the end of a file.
+// The first entry read is placed relative to the reference time and earlier years are taken on each rollover.
+func WithReverse() OptT {
+	return func(o *yearOptsT) {
+		o.reverse = true
+	}
+}
+
+func TryTimestampFormat(exp string, fmtStr TimestampFmt, buf []byte, maxTries int, opts ...OptT) (format.FactoryI, int64, error) {
 
 	var (
 		ts      int64
@@ -116,7 +140,7 @@ func TryTimestampFormat(exp string, fmtStr TimestampFmt, buf []byte, maxTries in
 		return nil, 0, err
 	}
 
-	if factory, err = format.NewRegexFactory(exp, cb); err != nil {
+	if factory, err = newFactory(exp, fmtStr, cb, opts...); err != nil {
 		log.Warn().Err(err).Msg("Failed to create regex factory")
 		return nil, 0, err
 	}
@@ -152,3 +176,34 @@ func TryTimestampFormat(exp string, fmtStr TimestampFmt, buf []byte, maxTries in
 
 	return factory, ts, nil
 }
+
+// NewFactory returns a regex factory for the expression and timestamp format without trying it on any data.
+func NewFactory(exp string, fmtStr TimestampFmt, opts ...OptT) (format.FactoryI, error) {
+
+	cb, err := GetTimestampFormat(fmtStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return newFactory(exp, fmtStr, cb, opts...)
+}
+
+func newFactory(exp string, fmtStr TimestampFmt, cb format.TimeFormatCbT, opts ...OptT) (format.FactoryI, error) {
+
+	if !IsYearless(fmtStr.String()) {
+		return format.NewRegexFactory(exp, cb)
+	}
+
+	var o yearOptsT
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	log.Debug().
+		Str("fmt", fmtStr.String()).
+		Int("year", o.year).
+		Time("ref", o.refTime).
+		Msg("Timestamp format has no year; inferring")
+
+	return newYearFactory(exp, fmtStr.String(), o)
+}
@@ -1,6 +1,7 @@
 package timez_test
 
 import (
+	"regexp"
 	"testing"
 	"time"
 
@@ -50,3 +51,156 @@ func TestTryTimestampFormat(t *testing.T) {
 		t.Fatalf("timestamp mismatch")
 	}
 }
+
+func TestIsYearless(t *testing.T) {
+	tests := map[string]bool{
+		"Jan 2 15:04:05":              true,
+		"0102 15:04:05.000000":        true,
+		"2006-01-02 15:04:05":         false,
+		"02/Jan/2006:15:04:05.000":    false,
+		timez.FmtEpochAny.String():    false,
+		timez.FmtRfc3339Nano.String(): false,
+	}
+
+	for layout, want := range tests {
+		if got := timez.IsYearless(layout); got != want {
+			t.Errorf("IsYearless(%q) expected %v got %v", layout, want, got)
+		}
+	}
+}
+
+func TestTryTimestampFormatYearless(t *testing.T) {
+	const exp = `^([A-Z][a-z]{2}\s{1,2}\d{1,2}\s\d{2}:\d{2}:\d{2})`
+
+	data := []byte("Dec 31 23:59:58 host app: one\nJan  1 00:00:01 host app: two\n")
+
+	t.Run("reference time", func(t *testing.T) {
+		ref := time.Date(2025, 1, 1, 0, 5, 0, 0, time.UTC)
+		factory, ts, err := timez.TryTimestampFormat(exp, "Jan 2 15:04:05", data, 1, timez.WithRefTime(ref))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if want := time.Date(2024, 12, 31, 23, 59, 58, 0, time.UTC).UnixNano(); ts != want {
+			t.Fatalf("expected %v got %v", time.Unix(0, want).UTC(), time.Unix(0, ts).UTC())
+		}
+
+		parser := factory.New()
+		first, err := parser.ReadEntry([]byte("Dec 31 23:59:58 host app: one"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		second, err := parser.ReadEntry([]byte("Jan  1 00:00:01 host app: two"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if want := time.Date(2025, 1, 1, 0, 0, 1, 0, time.UTC).UnixNano(); second.Timestamp != want {
+			t.Fatalf("expected rollover to %v got %v", time.Unix(0, want).UTC(), time.Unix(0, second.Timestamp).UTC())
+		}
+		if second.Timestamp <= first.Timestamp {
+			t.Fatalf("expected increasing timestamps across rollover")
+		}
+	})
+
+	t.Run("newest first", func(t *testing.T) {
+		ref := time.Date(2025, 1, 1, 0, 5, 0, 0, time.UTC)
+		factory, _, err := timez.TryTimestampFormat(exp, "Jan 2 15:04:05", data, 1, timez.WithRefTime(ref), timez.WithReverse())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		parser := factory.New()
+		last, err := parser.ReadEntry([]byte("Jan  1 00:00:01 host app: two"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		prev, err := parser.ReadEntry([]byte("Dec 31 23:59:58 host app: one"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if want := time.Date(2024, 12, 31, 23, 59, 58, 0, time.UTC).UnixNano(); prev.Timestamp != want {
+			t.Fatalf("expected rollover back to %v got %v", time.Unix(0, want).UTC(), time.Unix(0, prev.Timestamp).UTC())
+		}
+		if prev.Timestamp >= last.Timestamp {
+			t.Fatalf("expected decreasing timestamps across rollover")
+		}
+	})
+
+	t.Run("configured year", func(t *testing.T) {
+		_, ts, err := timez.TryTimestampFormat(exp, "Jan 2 15:04:05", data, 1, timez.WithYear(2019))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if want := time.Date(2019, 12, 31, 23, 59, 58, 0, time.UTC).UnixNano(); ts != want {
+			t.Fatalf("expected %v got %v", time.Unix(0, want).UTC(), time.Unix(0, ts).UTC())
+		}
+	})
+}
+
+func TestSuggest(t *testing.T) {
+	t.Run("Anchored", func(t *testing.T) {
+		s, ok := timez.Suggest([]string{"garbage", "[2024-03-12 10:00:01,123] ERROR boom"})
+		if !ok {
+			t.Fatal("Expected a suggestion")
+		}
+		if s.Format != "2006-01-02 15:04:05,000" || s.Line != 2 {
+			t.Errorf("Unexpected suggestion: %+v", s)
+		}
+		if !regexp.MustCompile(s.Pattern).MatchString("[2024-03-12 10:00:01,123] ERROR boom") {
+			t.Errorf("Pattern %q does not match its line", s.Pattern)
+		}
+	})
+
+	t.Run("None", func(t *testing.T) {
+		if _, ok := timez.Suggest([]string{"no timestamps here"}); ok {
+			t.Error("Expected no suggestion")
+		}
+	})
+}
+
+func TestScoreFactory(t *testing.T) {
+	buf := []byte("2025-01-02 03:04:05.123 a\nno stamp\n2025-01-02 03:04:04.000 b\n2025-01-02 03:04:06.500 c\n")
+
+	factory, _, err := timez.TryTimestampFormat(`^(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{3})`, "2006-01-02 15:04:05.000", buf, 1)
+	if err != nil {
+		t.Fatalf("TryTimestampFormat failed: %v", err)
+	}
+
+	s := timez.ScoreFactory(factory, buf)
+	if s.Lines != 4 || s.Matched != 3 || s.Ordered != 1 || s.Precision != 1 {
+		t.Errorf("Unexpected score: %+v", s)
+	}
+
+	if !s.Better(timez.ScoreT{Matched: 2}) || s.Better(s) {
+		t.Error("Unexpected score comparison")
+	}
+}
+
+func TestSyntheticFactory(t *testing.T) {
+	ref := time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	factory, err := timez.NewSyntheticFactory(timez.SyntheticMtime, ref)
+	if err != nil {
+		t.Fatalf("NewSyntheticFactory failed: %v", err)
+	}
+	if !timez.IsSynthetic(factory) {
+		t.Error("Expected synthetic factory")
+	}
+
+	p := factory.New()
+	for i := int64(1); i <= 3; i++ {
+		e, err := p.ReadEntry([]byte("no timestamp"))
+		if err != nil {
+			t.Fatalf("ReadEntry failed: %v", err)
+		}
+		if want := ref.UnixNano() + i*int64(timez.SyntheticStep); e.Timestamp != want {
+			t.Errorf("Line %d: expected %d, got %d", i, want, e.Timestamp)
+		}
+	}
+
+	if _, err := timez.NewSyntheticFactory("bogus", ref); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+}
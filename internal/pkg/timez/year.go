@@ -0,0 +1,132 @@
+package timez
+
+import (
+	"time"
+
+	"github.com/prequel-dev/prequel-logmatch/pkg/format"
+)
+
+const (
+	// Allow for clock skew and timezone offsets between the log writer and the file mtime.
+	refTimeSlack = 24 * time.Hour
+
+	// A jump of more than this many months against the reading order is treated as a year rollover (e.g. Dec -> Jan).
+	rolloverMonths = 6
+)
+
+var (
+	yearProbe = time.Date(1999, time.December, 31, 23, 59, 59, 0, time.UTC)
+)
+
+// IsYearless returns true if the layout does not contain a year component (e.g. RFC 3164 "Jan 2 15:04:05").
+func IsYearless(layout string) bool {
+
+	// Named formats are not Go layouts; "rfc3339" would otherwise parse as an hour.
+	switch TimestampFmt(layout) {
+	case FmtRfc3339, FmtRfc3339Nano, FmtUnix, FmtEpochAny, FmtEpochSeconds, FmtEpochMillis, FmtEpochMicros, FmtEpochNanos:
+		return false
+	}
+
+	probe := yearProbe.Format(layout)
+
+	t, err := time.Parse(layout, probe)
+	if err != nil {
+		return false
+	}
+	return t.Year() == 0
+}
+
+type yearOptsT struct {
+	year    int
+	refTime time.Time
+	reverse bool
+}
+
+// yearFactoryT is a regex factory that resolves timestamps without a year.
+// Each parser tracks its own rollover state, so detection does not leak into the scan.
+type yearFactoryT struct {
+	exp    string
+	layout string
+	opts   yearOptsT
+}
+
+func newYearFactory(exp, layout string, o yearOptsT) (format.FactoryI, error) {
+
+	// Validate the expression up front; New() cannot return an error.
+	if _, err := format.NewRegexFactory(exp, nil); err != nil {
+		return nil, err
+	}
+
+	if o.year == 0 && o.refTime.IsZero() {
+		o.refTime = time.Now()
+	}
+
+	return &yearFactoryT{
+		exp:    exp,
+		layout: layout,
+		opts:   o,
+	}, nil
+}
+
+func (f *yearFactoryT) New() format.ParserI {
+	yr := &yearResolverT{
+		layout:  f.layout,
+		year:    f.opts.year,
+		refTime: f.opts.refTime,
+		reverse: f.opts.reverse,
+	}
+
+	// Expression was validated in newYearFactory
+	factory, _ := format.NewRegexFactory(f.exp, yr.parse)
+	return factory.New()
+}
+
+func (f *yearFactoryT) String() string {
+	return format.FactoryRegex
+}
+
+type yearResolverT struct {
+	layout  string
+	year    int
+	refTime time.Time
+	reverse bool // Entries are read newest first
+	last    time.Month
+	init    bool
+}
+
+func (y *yearResolverT) parse(m []byte) (int64, error) {
+
+	t, err := time.Parse(y.layout, string(m))
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case !y.init:
+		y.init = true
+
+		// A configured year is used as is; otherwise pick the latest year that does not put the entry after the reference time.
+		if y.year == 0 {
+			y.year = y.refTime.Year()
+			if withYear(t, y.year).After(y.refTime.Add(refTimeSlack)) {
+				y.year -= 1
+			}
+		}
+
+	case y.reverse:
+		if t.Month()-y.last > rolloverMonths {
+			y.year -= 1
+		}
+
+	case y.last-t.Month() > rolloverMonths:
+		y.year += 1
+	}
+
+	y.last = t.Month()
+
+	return withYear(t, y.year).UnixNano(), nil
+}
+
+func withYear(t time.Time, year int) time.Time {
+	return time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
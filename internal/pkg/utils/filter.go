@@ -0,0 +1,210 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/prequel-dev/prequel-compiler/pkg/parser"
+)
+
+var (
+	ErrRuleSeverity = errors.New("invalid severity; expected critical, high, medium, low, info or 0-4")
+	ErrRuleMatch    = errors.New("invalid rule filter; expected id, tag, category or source terms")
+)
+
+const (
+	matchId       = "id"
+	matchTag      = "tag"
+	matchCategory = "category"
+	matchSource   = "source"
+)
+
+var severities = map[string]uint{
+	"critical": parser.SeverityCritical,
+	"high":     parser.SeverityHigh,
+	"medium":   parser.SeverityMedium,
+	"low":      parser.SeverityLow,
+	"info":     parser.SeverityInfo,
+}
+
+// RuleMatchT matches rules by CRE id glob, tag, category or event source type.
+// A rule matches a field if it matches any of its entries.
+type RuleMatchT struct {
+	Ids        []string `yaml:"ids,omitempty"`
+	Tags       []string `yaml:"tags,omitempty"`
+	Categories []string `yaml:"categories,omitempty"`
+	Sources    []string `yaml:"sources,omitempty"`
+}
+
+// RuleFilterT selects the rules to run:
+//
+//	include:
+//	  tags: [kafka, rabbitmq]    # every non-empty include field must match
+//	exclude:
+//	  ids: ["CRE-2024-00*"]      # any matching exclude field skips the rule
+//	severity: high               # skip rules less severe than high
+type RuleFilterT struct {
+	Include  RuleMatchT `yaml:"include,omitempty"`
+	Exclude  RuleMatchT `yaml:"exclude,omitempty"`
+	Severity string     `yaml:"severity,omitempty"`
+}
+
+// ParseRuleMatch parses a comma separated list of key:value terms, e.g. "tag:kafka,id:CRE-2025-*".
+// Values without a key are CRE id globs.
+func ParseRuleMatch(s string) (RuleMatchT, error) {
+
+	var m RuleMatchT
+
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+
+		key, val, ok := strings.Cut(term, ":")
+		if !ok {
+			key, val = matchId, term
+		}
+
+		switch key {
+		case matchId:
+			m.Ids = append(m.Ids, val)
+		case matchTag:
+			m.Tags = append(m.Tags, val)
+		case matchCategory:
+			m.Categories = append(m.Categories, val)
+		case matchSource:
+			m.Sources = append(m.Sources, val)
+		default:
+			return m, fmt.Errorf("%w: %q", ErrRuleMatch, term)
+		}
+	}
+
+	return m, nil
+}
+
+// ParseSeverity parses a severity name or number.
+func ParseSeverity(s string) (uint, error) {
+
+	if sev, ok := severities[strings.ToLower(s)]; ok {
+		return sev, nil
+	}
+
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || n > parser.SeverityInfo {
+		return 0, fmt.Errorf("%w: %q", ErrRuleSeverity, s)
+	}
+
+	return uint(n), nil
+}
+
+func (f *RuleFilterT) Validate() error {
+
+	if f.Severity != "" {
+		if _, err := ParseSeverity(f.Severity); err != nil {
+			return err
+		}
+	}
+
+	for _, ids := range [][]string{f.Include.Ids, f.Exclude.Ids} {
+		for _, id := range ids {
+			if _, err := path.Match(id, ""); err != nil {
+				return fmt.Errorf("%w: %q", err, id)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (f *RuleFilterT) IsEmpty() bool {
+	return f.Severity == "" && f.Include.isEmpty() && f.Exclude.isEmpty()
+}
+
+// Skip reports whether a rule is filtered out, and why.
+func (f *RuleFilterT) Skip(rule parser.ParseRuleT) (string, bool) {
+
+	if f.Severity != "" {
+		if sev, err := ParseSeverity(f.Severity); err == nil && rule.Cre.Severity > sev {
+			return fmt.Sprintf("severity %d below %s", rule.Cre.Severity, f.Severity), true
+		}
+	}
+
+	for _, field := range f.Include.fields(rule) {
+		if len(field.want) > 0 && field.match() == "" {
+			return fmt.Sprintf("not included by %s", field.name), true
+		}
+	}
+
+	for _, field := range f.Exclude.fields(rule) {
+		if m := field.match(); m != "" {
+			return fmt.Sprintf("excluded by %s %s", field.name, m), true
+		}
+	}
+
+	return "", false
+}
+
+// Add appends the terms of o.
+func (m *RuleMatchT) Add(o RuleMatchT) {
+	m.Ids = append(m.Ids, o.Ids...)
+	m.Tags = append(m.Tags, o.Tags...)
+	m.Categories = append(m.Categories, o.Categories...)
+	m.Sources = append(m.Sources, o.Sources...)
+}
+
+func (m RuleMatchT) isEmpty() bool {
+	return len(m.Ids) == 0 && len(m.Tags) == 0 && len(m.Categories) == 0 && len(m.Sources) == 0
+}
+
+type matchFieldT struct {
+	name string
+	want []string
+	have []string
+	glob bool
+}
+
+// match returns the first entry that matches the rule, or "".
+func (f matchFieldT) match() string {
+	for _, w := range f.want {
+		for _, h := range f.have {
+			if f.glob {
+				if ok, _ := path.Match(w, h); ok {
+					return w
+				}
+				continue
+			}
+			if strings.EqualFold(w, h) {
+				return w
+			}
+		}
+	}
+	return ""
+}
+
+func (m RuleMatchT) fields(rule parser.ParseRuleT) []matchFieldT {
+	return []matchFieldT{
+		{name: matchId, want: m.Ids, have: []string{rule.Cre.Id}, glob: true},
+		{name: matchTag, want: m.Tags, have: rule.Cre.Tags},
+		{name: matchCategory, want: m.Categories, have: []string{rule.Cre.Category}},
+		{name: matchSource, want: m.Sources, have: ruleSources(rule)},
+	}
+}
+
+func ruleSources(rule parser.ParseRuleT) []string {
+
+	var srcs []string
+
+	if seq := rule.Rule.Sequence; seq != nil && seq.Event != nil {
+		srcs = append(srcs, seq.Event.Source)
+	}
+
+	if set := rule.Rule.Set; set != nil && set.Event != nil {
+		srcs = append(srcs, set.Event.Source)
+	}
+
+	return srcs
+}
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prequel-dev/prequel-compiler/pkg/parser"
+)
+
+var (
+	ErrOverrideWindow = errors.New("invalid override window")
+)
+
+// CreOverrideT adjusts a rule by CRE id without editing its rules file, so the
+// change survives community rule updates:
+//
+//	overrides:
+//	  CRE-2024-0007:
+//	    disabled: true       # skip the rule
+//	  CRE-2025-0019:
+//	    severity: low        # critical, high, medium, low, info or 0-4
+//	    tags: [noisy]        # added to the rule's tags
+//	    window: 30s          # sequence or set window
+type CreOverrideT struct {
+	Disabled bool     `yaml:"disabled,omitempty"`
+	Severity string   `yaml:"severity,omitempty"`
+	Tags     []string `yaml:"tags,omitempty"`
+	Window   string   `yaml:"window,omitempty"`
+}
+
+type OverridesT map[string]CreOverrideT
+
+func (o OverridesT) Validate() error {
+
+	for id, ov := range o {
+		if ov.Severity != "" {
+			if _, err := ParseSeverity(ov.Severity); err != nil {
+				return fmt.Errorf("override %s: %w", id, err)
+			}
+		}
+		if ov.Window != "" {
+			if d, err := time.ParseDuration(ov.Window); err != nil || d <= 0 {
+				return fmt.Errorf("override %s: %w: %q", id, ErrOverrideWindow, ov.Window)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Apply changes the rule as configured for its CRE id and describes each change made.
+// Disabling is left to the caller, which removes the rule.
+func (o OverridesT) Apply(rule *parser.ParseRuleT) []string {
+
+	var (
+		changes []string
+		ov, ok  = o[rule.Cre.Id]
+	)
+
+	if !ok {
+		return nil
+	}
+
+	if ov.Severity != "" {
+		if sev, err := ParseSeverity(ov.Severity); err == nil && sev != rule.Cre.Severity {
+			changes = append(changes, fmt.Sprintf("severity %d -> %d", rule.Cre.Severity, sev))
+			rule.Cre.Severity = sev
+		}
+	}
+
+	var added []string
+	for _, tag := range ov.Tags {
+		if !slices.Contains(rule.Cre.Tags, tag) {
+			rule.Cre.Tags = append(rule.Cre.Tags, tag)
+			added = append(added, tag)
+		}
+	}
+	if len(added) > 0 {
+		changes = append(changes, "tags +"+strings.Join(added, ",+"))
+	}
+
+	if ov.Window != "" {
+		switch {
+		case rule.Rule.Sequence != nil && rule.Rule.Sequence.Window != ov.Window:
+			changes = append(changes, fmt.Sprintf("window %s -> %s", windowOrNone(rule.Rule.Sequence.Window), ov.Window))
+			rule.Rule.Sequence.Window = ov.Window
+		case rule.Rule.Set != nil && rule.Rule.Set.Window != ov.Window:
+			changes = append(changes, fmt.Sprintf("window %s -> %s", windowOrNone(rule.Rule.Set.Window), ov.Window))
+			rule.Rule.Set.Window = ov.Window
+		}
+	}
+
+	return changes
+}
+
+// Disabled reports whether the rule is turned off by an override.
+func (o OverridesT) Disabled(rule parser.ParseRuleT) bool {
+	return o[rule.Cre.Id].Disabled
+}
+
+func windowOrNone(w string) string {
+	if w == "" {
+		return "none"
+	}
+	return w
+}
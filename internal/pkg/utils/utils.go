@@ -14,6 +14,8 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"strings"
 
 	"github.com/prequel-dev/prequel-compiler/pkg/parser"
 
@@ -29,6 +31,9 @@ var (
 
 var (
 	sectionRules = "rules"
+
+	// Extensions of rule files picked up from directories
+	ruleExts = []string{".yaml", ".yml", ".yaml.gz", ".yml.gz"}
 )
 
 type RuleTypeT string
@@ -41,6 +46,7 @@ const (
 type RulePathT struct {
 	Path string
 	Type RuleTypeT
+	Data []byte // Contents read when the file was verified; parsed instead of re-reading Path
 }
 
 func GetStopTime() (ts int64) {
@@ -146,14 +152,11 @@ func readerOpts(opts ...ReaderOptT) *readerOptsT {
 }
 
 func ParseRulesPath(path string, opts ...ReaderOptT) (*parser.RulesT, error) {
-	o := readerOpts(opts...)
 
 	var (
-		reader     io.Reader
-		rulesBytes []byte
-		readOpts   = make([]parser.ParseOptT, 0)
-		close      func()
-		err        error
+		reader io.Reader
+		close  func()
+		err    error
 	)
 
 	if reader, close, err = OpenRulesFile(path); err != nil {
@@ -161,6 +164,34 @@ func ParseRulesPath(path string, opts ...ReaderOptT) (*parser.RulesT, error) {
 	}
 	defer close()
 
+	return readRules(reader, readerOpts(opts...))
+}
+
+// ParseRulesData parses the contents of a rules file, compressed or not.
+func ParseRulesData(data []byte, opts ...ReaderOptT) (*parser.RulesT, error) {
+
+	var reader io.Reader = bytes.NewReader(data)
+
+	if len(data) > 1 && data[0] == 0x1f && data[1] == 0x8b {
+		gzReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		defer gzReader.Close()
+		reader = gzReader
+	}
+
+	return readRules(reader, readerOpts(opts...))
+}
+
+func readRules(reader io.Reader, o *readerOptsT) (*parser.RulesT, error) {
+
+	var (
+		rulesBytes []byte
+		readOpts   = make([]parser.ParseOptT, 0)
+		err        error
+	)
+
 	if o.multiDoc {
 		if rulesBytes, err = ExtractSectionBytes(reader, sectionRules); err != nil {
 			return nil, err
@@ -261,6 +292,100 @@ func CopyFile(src, dst string) error {
 	return nil
 }
 
+// ExpandRulesPath returns the rule files for a path. Directories are walked recursively for
+// YAML files; glob patterns are expanded, and matching directories walked. Files found this
+// way are kept only if a document in them has a top-level "rules" key, so test specs and data
+// source files can sit next to the rules. Other paths are returned as is. Files are sorted so
+// rules load in a stable order.
+func ExpandRulesPath(path string) ([]string, error) {
+
+	var (
+		matches = []string{path}
+		files   = make([]string, 0)
+		seen    = make(map[string]struct{})
+		err     error
+	)
+
+	if strings.ContainsAny(path, "*?[") {
+		if matches, err = filepath.Glob(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// Files named on their own are loaded as is
+	add := func(fn string) {
+		if fn != path && !hasRulesDoc(fn) {
+			return
+		}
+		if _, ok := seen[fn]; !ok {
+			seen[fn] = struct{}{}
+			files = append(files, fn)
+		}
+	}
+
+	for _, m := range matches {
+		info, err := os.Stat(m)
+		if err != nil || !info.IsDir() {
+			add(m)
+			continue
+		}
+
+		err = filepath.WalkDir(m, func(fn string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && isRuleFile(fn) {
+				add(fn)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// hasRulesDoc returns true if a document in the file has a top-level "rules" key.
+func hasRulesDoc(fn string) bool {
+
+	reader, close, err := OpenRulesFile(fn)
+	if err != nil {
+		return false
+	}
+	defer close()
+
+	yr := utilyaml.NewYAMLReader(bufio.NewReader(reader))
+
+	for {
+		docBytes, err := yr.Read()
+		if err != nil {
+			return false
+		}
+
+		var doc map[string]any
+		if err := yaml.Unmarshal(docBytes, &doc); err != nil {
+			continue
+		}
+
+		if _, ok := doc[sectionRules]; ok {
+			return true
+		}
+	}
+}
+
+func isRuleFile(fn string) bool {
+	for _, ext := range ruleExts {
+		if strings.HasSuffix(strings.ToLower(fn), ext) {
+			return true
+		}
+	}
+	return false
+}
+
 func UrlBase(fullUrl string) (string, error) {
 	u, err := url.Parse(fullUrl)
 	if err != nil {
@@ -3,6 +3,7 @@ package utils_test
 import (
 	"bytes"
 	"compress/gzip"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
@@ -11,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/prequel-dev/preq/internal/pkg/utils"
+	"github.com/prequel-dev/prequel-compiler/pkg/parser"
 )
 
 func TestSha256Sum(t *testing.T) {
@@ -165,3 +167,179 @@ func TestGunzipBytesErrorAndCopyFileError(t *testing.T) {
 		t.Fatalf("expected error")
 	}
 }
+
+func TestExpandRulesPath(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.yaml":          "rules: []\n",
+		"sub/b.yml":       "rules: []\n",
+		"sub/deep/c.yaml": "rules: []\n",
+		"sub/notes.txt":   "rules: []\n",
+		"d.yaml.gz":       "rules: []\n",
+		"e.yaml":          "section: version\n---\nrules: []\n",
+		"sources.yaml":    "sources: []\n",
+		"sub/spec.yaml":   "tests: []\n",
+	}
+	for fn, data := range files {
+		path := filepath.Join(dir, fn)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rel := func(files []string) string {
+		out := make([]string, 0, len(files))
+		for _, fn := range files {
+			r, _ := filepath.Rel(dir, fn)
+			out = append(out, filepath.ToSlash(r))
+		}
+		return strings.Join(out, ",")
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"file", filepath.Join(dir, "a.yaml"), "a.yaml"},
+		{"directory", dir, "a.yaml,d.yaml.gz,e.yaml,sub/b.yml,sub/deep/c.yaml"},
+		{"subdirectory", filepath.Join(dir, "sub"), "sub/b.yml,sub/deep/c.yaml"},
+		{"glob", filepath.Join(dir, "*.yaml"), "a.yaml,e.yaml"},
+		{"named file without rules", filepath.Join(dir, "sources.yaml"), "sources.yaml"},
+		{"glob directory", filepath.Join(dir, "s*"), "sub/b.yml,sub/deep/c.yaml"},
+		{"glob no match", filepath.Join(dir, "*.json"), ""},
+		{"missing file", filepath.Join(dir, "missing.yaml"), "missing.yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := utils.ExpandRulesPath(tt.path)
+			if err != nil {
+				t.Fatalf("ExpandRulesPath: %v", err)
+			}
+			if got := rel(files); got != tt.want {
+				t.Errorf("expected %q got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRuleFilter(t *testing.T) {
+	rule := parser.ParseRuleT{
+		Cre: parser.ParseCreT{
+			Id:       "CRE-2025-0042",
+			Severity: parser.SeverityMedium,
+			Category: "message-queue-problems",
+			Tags:     []string{"kafka", "known-problem"},
+		},
+		Rule: parser.ParseRuleDataT{
+			Set: &parser.ParseSetT{Event: &parser.ParseEventT{Source: "cre.log.kafka"}},
+		},
+	}
+
+	match := func(s string) utils.RuleMatchT {
+		m, err := utils.ParseRuleMatch(s)
+		if err != nil {
+			t.Fatalf("ParseRuleMatch(%q): %v", s, err)
+		}
+		return m
+	}
+
+	tests := []struct {
+		name   string
+		filter utils.RuleFilterT
+		reason string
+	}{
+		{"empty", utils.RuleFilterT{}, ""},
+		{"include id glob", utils.RuleFilterT{Include: match("CRE-2025-*")}, ""},
+		{"include id miss", utils.RuleFilterT{Include: match("id:CRE-2024-*")}, "not included by id"},
+		{"include tag", utils.RuleFilterT{Include: match("tag:rabbitmq,tag:kafka")}, ""},
+		{"include tag and category", utils.RuleFilterT{Include: match("tag:kafka,category:k8s-problems")}, "not included by category"},
+		{"include source", utils.RuleFilterT{Include: match("source:cre.log.kafka")}, ""},
+		{"exclude tag", utils.RuleFilterT{Exclude: match("tag:known-problem")}, "excluded by tag known-problem"},
+		{"exclude miss", utils.RuleFilterT{Exclude: match("source:cre.log.nginx")}, ""},
+		{"severity threshold", utils.RuleFilterT{Severity: "high"}, "severity 2 below high"},
+		{"severity met", utils.RuleFilterT{Severity: "2"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.filter.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			reason, skip := tt.filter.Skip(rule)
+			if skip != (tt.reason != "") || reason != tt.reason {
+				t.Errorf("expected %q got %q (skip=%v)", tt.reason, reason, skip)
+			}
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := utils.ParseRuleMatch("label:x"); !errors.Is(err, utils.ErrRuleMatch) {
+			t.Errorf("expected ErrRuleMatch got %v", err)
+		}
+		f := utils.RuleFilterT{Severity: "urgent"}
+		if err := f.Validate(); !errors.Is(err, utils.ErrRuleSeverity) {
+			t.Errorf("expected ErrRuleSeverity got %v", err)
+		}
+		f = utils.RuleFilterT{Exclude: utils.RuleMatchT{Ids: []string{"CRE-["}}}
+		if err := f.Validate(); err == nil {
+			t.Error("expected bad pattern error")
+		}
+	})
+}
+
+func TestOverrides(t *testing.T) {
+
+	overrides := utils.OverridesT{
+		"CRE-2025-0001": {Severity: "low", Tags: []string{"known", "noisy"}, Window: "30s"},
+		"CRE-2025-0002": {Disabled: true},
+	}
+
+	if err := overrides.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	t.Run("Apply", func(t *testing.T) {
+		rule := parser.ParseRuleT{
+			Cre: parser.ParseCreT{Id: "CRE-2025-0001", Severity: parser.SeverityHigh, Tags: []string{"known"}},
+			Rule: parser.ParseRuleDataT{
+				Sequence: &parser.ParseSequenceT{Window: "10s"},
+			},
+		}
+
+		changes := overrides.Apply(&rule)
+
+		want := []string{"severity 1 -> 3", "tags +noisy", "window 10s -> 30s"}
+		if strings.Join(changes, ";") != strings.Join(want, ";") {
+			t.Errorf("Expected changes %v, got %v", want, changes)
+		}
+		if rule.Cre.Severity != parser.SeverityLow || len(rule.Cre.Tags) != 2 || rule.Rule.Sequence.Window != "30s" {
+			t.Errorf("Override not applied: %+v", rule)
+		}
+		if again := overrides.Apply(&rule); len(again) != 0 {
+			t.Errorf("Expected no changes when reapplied, got %v", again)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		if !overrides.Disabled(parser.ParseRuleT{Cre: parser.ParseCreT{Id: "CRE-2025-0002"}}) {
+			t.Error("Expected CRE-2025-0002 disabled")
+		}
+		if overrides.Disabled(parser.ParseRuleT{Cre: parser.ParseCreT{Id: "CRE-2025-0003"}}) {
+			t.Error("Expected CRE-2025-0003 enabled")
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		if err := (utils.OverridesT{"CRE-2025-0001": {Severity: "urgent"}}).Validate(); !errors.Is(err, utils.ErrRuleSeverity) {
+			t.Errorf("Expected utils.ErrRuleSeverity, got %v", err)
+		}
+		if err := (utils.OverridesT{"CRE-2025-0001": {Window: "-5s"}}).Validate(); !errors.Is(err, utils.ErrOverrideWindow) {
+			t.Errorf("Expected utils.ErrOverrideWindow, got %v", err)
+		}
+	})
+}
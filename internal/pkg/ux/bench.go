@@ -0,0 +1,81 @@
+package ux
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+// BenchT measures one rule scanning a corpus on its own. Allocations exclude those made
+// reading and parsing the corpus. Slow lists why a rule was flagged as pathological.
+type BenchT struct {
+	CreId       string        `json:"cre_id"`
+	RuleId      string        `json:"rule_id"`
+	Source      string        `json:"source"`
+	Lines       int64         `json:"lines"`
+	MatchTime   time.Duration `json:"match_ns"`
+	NsPerLine   float64       `json:"ns_per_line"`
+	LinesPerSec float64       `json:"lines_per_sec"`
+	Allocs      uint64        `json:"allocs"`
+	Bytes       uint64        `json:"bytes"`
+	Hits        int           `json:"hits"`
+	Slow        []string      `json:"slow,omitempty"`
+}
+
+// Pathological reports whether the rule was flagged as too slow for production scans.
+func (b BenchT) Pathological() bool {
+	return len(b.Slow) > 0
+}
+
+// PrintBench prints one row per rule followed by the reasons flagged rules are slow.
+func PrintBench(rows []BenchT) {
+
+	var (
+		w       = os.Stdout
+		title   = text.Colors{text.FgHiBlue, text.Bold}
+		bad     = text.Colors{text.FgHiRed, text.Bold}
+		ok      = text.Colors{text.FgHiGreen, text.Bold}
+		dim     = text.Colors{text.FgHiBlack}
+		flagged int
+	)
+
+	fmt.Fprintln(w, title.Sprintf("%-24s %-20s %10s %12s %12s %14s %10s %12s %6s",
+		"CRE", "SOURCE", "LINES", "MATCH", "NS/LINE", "LINES/SEC", "ALLOCS", "BYTES", "HITS"))
+
+	for _, b := range rows {
+		if b.Lines == 0 {
+			fmt.Fprintln(w, dim.Sprintf("%-24s %-20s %10s", b.CreId, b.Source, "no data"))
+			continue
+		}
+
+		row := fmt.Sprintf("%-24s %-20s %10d %12s %12.0f %14.0f %10d %12d %6d",
+			b.CreId, b.Source, b.Lines, b.MatchTime.Round(time.Microsecond), b.NsPerLine, b.LinesPerSec, b.Allocs, b.Bytes, b.Hits)
+
+		if b.Pathological() {
+			row = bad.Sprint(row)
+		}
+
+		fmt.Fprintln(w, row)
+	}
+
+	for _, b := range rows {
+		if !b.Pathological() {
+			continue
+		}
+		if flagged == 0 {
+			fmt.Fprintln(w)
+		}
+		flagged++
+		fmt.Fprintf(w, "%s %s: %s\n", bad.Sprint("SLOW:"), b.CreId, strings.Join(b.Slow, "; "))
+	}
+
+	if flagged == 0 {
+		fmt.Fprintf(w, "\n%s %d rule(s) benchmarked, none flagged\n", ok.Sprint("OK:"), len(rows))
+		return
+	}
+
+	fmt.Fprintf(w, "\n%s %d of %d rule(s) flagged\n", bad.Sprint("FAIL:"), flagged, len(rows))
+}
@@ -0,0 +1,110 @@
+package ux
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+const (
+	coverageMaxShown = 5
+)
+
+// CoverageT counts the rules of one source type and how many had data to run on.
+type CoverageT struct {
+	Source      string   `json:"source"`
+	Rules       int      `json:"rules"`
+	Evaluated   int      `json:"evaluated"`
+	Percent     float64  `json:"percent"`
+	Unevaluated []string `json:"unevaluated,omitempty"`
+}
+
+// AddEvaluated records whether a rule had a data source of its type to run on.
+func (r *ReportT) AddEvaluated(creId, src string, evaluated bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if evaluated {
+		r.Evaluated[creId] = src
+	} else {
+		r.Unevaluated[creId] = src
+	}
+}
+
+// Coverage returns the rules evaluated per source type, sorted by source type.
+func (r *ReportT) Coverage() []CoverageT {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.coverage()
+}
+
+func (r *ReportT) coverage() []CoverageT {
+
+	var bySrc = make(map[string]*CoverageT)
+
+	get := func(src string) *CoverageT {
+		c, ok := bySrc[src]
+		if !ok {
+			c = &CoverageT{Source: src}
+			bySrc[src] = c
+		}
+		return c
+	}
+
+	for _, src := range r.Evaluated {
+		c := get(src)
+		c.Rules++
+		c.Evaluated++
+	}
+
+	for creId, src := range r.Unevaluated {
+		c := get(src)
+		c.Rules++
+		c.Unevaluated = append(c.Unevaluated, creId)
+	}
+
+	out := make([]CoverageT, 0, len(bySrc))
+	for _, c := range bySrc {
+		c.Percent = 100 * float64(c.Evaluated) / float64(c.Rules)
+		slices.Sort(c.Unevaluated)
+		out = append(out, *c)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Source < out[j].Source
+	})
+
+	return out
+}
+
+// displayCoverage lists the source types that had no data for some of their rules.
+func (r *ReportT) displayCoverage() {
+
+	if len(r.Unevaluated) == 0 {
+		return
+	}
+
+	var (
+		dim   = text.Colors{text.FgHiBlack}
+		total = len(r.Evaluated) + len(r.Unevaluated)
+	)
+
+	r.Pw.Log(dim.Sprintf("%d of %d rules not evaluated for lack of data (%.1f%% coverage)",
+		len(r.Unevaluated), total, 100*float64(len(r.Evaluated))/float64(total)))
+
+	for _, c := range r.coverage() {
+		if len(c.Unevaluated) == 0 {
+			continue
+		}
+
+		ids := c.Unevaluated
+		if len(ids) > coverageMaxShown {
+			ids = append(slices.Clip(ids[:coverageMaxShown]), fmt.Sprintf("and %d more", len(c.Unevaluated)-coverageMaxShown))
+		}
+
+		r.Pw.Log(dim.Sprintf("  %-24s %5.1f%% (%d/%d) %s", c.Source, c.Percent, c.Evaluated, c.Rules, strings.Join(ids, ", ")))
+	}
+}
@@ -0,0 +1,87 @@
+package ux
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+	"github.com/prequel-dev/preq/internal/pkg/resolve"
+)
+
+const (
+	detectMaxLineLen = 120
+	detectSnippetFmt = `timestamps:
+  # Example: %s
+  - format: "%s"
+    pattern: |
+      %s
+`
+)
+
+// PrintDiagnosis prints the result of a timestamp format detection.
+func PrintDiagnosis(name string, d *resolve.DiagnosisT) {
+
+	var (
+		w     = os.Stdout
+		title = text.Colors{text.FgHiBlue, text.Bold}
+	)
+
+	fmt.Fprintf(w, "%s %s\n\n", title.Sprint("Source:"), name)
+
+	if d.Err != nil {
+		fmt.Fprintf(w, "%s none (%v)\n", title.Sprint("Format:"), d.Err)
+
+		if d.Suggestion == nil {
+			fmt.Fprintf(w, "\nNo known timestamp layout found. See %s for help adding a custom format.\n", ErrorHelpDataStr)
+			return
+		}
+
+		fmt.Fprintf(w, "\n%s found %q on line %d. Add to config.yaml:\n\n", title.Sprint("Suggestion:"), d.Suggestion.Example, d.Suggestion.Line)
+		fmt.Fprintf(w, detectSnippetFmt, d.Suggestion.Example, d.Suggestion.Format, d.Suggestion.Pattern)
+		return
+	}
+
+	switch d.Source {
+	case resolve.DetectAuto:
+		fmt.Fprintf(w, "%s %s (auto-detected)\n", title.Sprint("Format:"), d.Factory)
+	case resolve.DetectCustom:
+		fmt.Fprintf(w, "%s %s (data source timestamp)\n", title.Sprint("Format:"), d.Factory)
+		fmt.Fprintf(w, "  format:  %s\n  pattern: %s\n", d.Spec.Format, d.Spec.Pattern)
+	case resolve.DetectTimestamps:
+		fmt.Fprintf(w, "%s %s (config timestamps[%d])\n", title.Sprint("Format:"), d.Factory, d.Index)
+		fmt.Fprintf(w, "  format:  %s\n  pattern: %s\n", d.Spec.Format, d.Spec.Pattern)
+	}
+
+	fmt.Fprintf(w, "%s %d\n", title.Sprint("First match on line:"), d.Line)
+
+	switch {
+	case d.Multiline:
+		fmt.Fprintf(w, "%s no (multiline grouping configured)\n", title.Sprint("Fold:"))
+	case d.Fold:
+		fmt.Fprintf(w, "%s yes (unparsed lines are appended to the previous entry)\n", title.Sprint("Fold:"))
+	default:
+		fmt.Fprintf(w, "%s no (unparsed lines are dropped)\n", title.Sprint("Fold:"))
+	}
+
+	fmt.Fprintf(w, "\n%s\n", title.Sprintf("Parsed timestamps (%d):", len(d.Stamps)))
+	for _, s := range d.Stamps {
+		fmt.Fprintf(w, "  %6d  %s\n", s.Line, s.Timestamp.Format(time.RFC3339Nano))
+	}
+
+	if len(d.Failed) > 0 {
+		fmt.Fprintf(w, "\n%s\n", title.Sprintf("Lines without a timestamp (%d):", len(d.Failed)))
+		for _, f := range d.Failed {
+			fmt.Fprintf(w, "  %6d  %s\n", f.Line, truncateLine(f.Text))
+		}
+	}
+}
+
+func truncateLine(line string) string {
+	line = strings.TrimSpace(line)
+	if len(line) > detectMaxLineLen {
+		return line[:detectMaxLineLen] + "..."
+	}
+	return line
+}
@@ -0,0 +1,129 @@
+package ux
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/text"
+)
+
+const (
+	explainFmt = "preq-explain-%d.json"
+)
+
+// Kinds of explain trace events
+const (
+	ExplainMatch    = "match"    // A term matched without advancing the rule
+	ExplainProgress = "progress" // A term matched and advanced the rule
+	ExplainNegate   = "negate"   // A negate term matched
+	ExplainExpire   = "expire"   // The window expired before every term matched
+	ExplainComplete = "complete" // Every term matched within the window
+	ExplainDetect   = "detect"   // The engine reported a detection
+	ExplainMismatch = "mismatch" // The engine reported a detection the trace did not complete
+)
+
+// ExplainT traces how one rule evaluated the logs. Terms and Negate describe the
+// rule's top level terms; events refer to them by their 1-based index. Entries counts
+// the log entries scanned after multiline grouping and reordering. Mismatches counts
+// detections and traced completions that did not agree with each other.
+type ExplainT struct {
+	CreId      string          `json:"cre_id"`
+	RuleId     string          `json:"rule_id"`
+	Type       string          `json:"type"`
+	Window     string          `json:"window,omitempty"`
+	Terms      []string        `json:"terms"`
+	Negate     []string        `json:"negate,omitempty"`
+	Entries    int64           `json:"entries"`
+	Detections int             `json:"detections"`
+	Mismatches int             `json:"mismatches"`
+	Events     []ExplainEventT `json:"events"`
+	Notes      []string        `json:"notes,omitempty"`
+}
+
+// ExplainEventT is one step of a trace. Line is the line of Source the entry starts on,
+// omitted when it is not known (e.g. when tailing). Index is the entry's 1-based position
+// in the scan; both are omitted for detections on the final flush.
+type ExplainEventT struct {
+	Kind      string    `json:"kind"`
+	Source    string    `json:"source,omitempty"`
+	Line      int64     `json:"line,omitempty"`
+	Index     int64     `json:"index,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Term      int       `json:"term,omitempty"`
+	Step      int       `json:"step"`
+	Entry     string    `json:"entry,omitempty"`
+	Detail    string    `json:"detail"`
+}
+
+// PrintExplain prints a readable explain trace to w.
+func PrintExplain(w io.Writer, e *ExplainT) {
+
+	var title = text.Colors{text.FgHiBlue, text.Bold}
+
+	fmt.Fprintf(w, "\n%s %s (%s", title.Sprint("Explain:"), e.CreId, e.Type)
+	if e.Window != "" {
+		fmt.Fprintf(w, ", window %s", e.Window)
+	}
+	fmt.Fprintln(w, ")")
+
+	fmt.Fprintf(w, "\n%s\n", title.Sprint("Terms:"))
+	for i, t := range e.Terms {
+		fmt.Fprintf(w, "  %d. %s\n", i+1, t)
+	}
+
+	if len(e.Negate) > 0 {
+		fmt.Fprintf(w, "\n%s\n", title.Sprint("Negate:"))
+		for i, t := range e.Negate {
+			fmt.Fprintf(w, "  %d. %s\n", i+1, t)
+		}
+	}
+
+	fmt.Fprintf(w, "\n%s\n", title.Sprintf("Trace (%d events):", len(e.Events)))
+	for _, ev := range e.Events {
+		// Entries without a known line are shown by their position in the scan; detections on the final flush have neither
+		line := "-"
+		switch {
+		case ev.Line > 0:
+			line = fmt.Sprint(ev.Line)
+		case ev.Index > 0:
+			line = fmt.Sprintf("#%d", ev.Index)
+		}
+		fmt.Fprintf(w, "  %6s  %s  %-8s  %s\n", line, ev.Timestamp.Format(time.RFC3339Nano), ev.Kind, ev.Detail)
+		if ev.Entry != "" {
+			fmt.Fprintf(w, "  %6s  %s\n", "", text.Colors{text.FgHiBlack}.Sprint(truncateLine(ev.Entry)))
+		}
+	}
+
+	fmt.Fprintf(w, "\nScanned %d entries, %d detections\n", e.Entries, e.Detections)
+
+	if e.Mismatches > 0 {
+		warn := text.Colors{text.FgHiYellow, text.Bold}
+		fmt.Fprintf(w, "%s the trace disagrees with the engine %d time(s); it is a simplified model of the rule\n", warn.Sprint("Warning:"), e.Mismatches)
+	}
+
+	for _, n := range e.Notes {
+		fmt.Fprintf(w, "Note: %s\n", n)
+	}
+}
+
+// WriteExplain writes the explain trace as JSON to path, or a timestamped file if path is empty.
+func WriteExplain(e *ExplainT, path string) (string, error) {
+
+	if path == "" {
+		path = fmt.Sprintf(explainFmt, time.Now().Unix())
+	}
+
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if err = os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
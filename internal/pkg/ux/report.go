@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"sort"
 	"sync"
@@ -33,6 +34,8 @@ const (
 	colorLow      = text.FgHiGreen
 	colorInfo     = text.FgHiBlue
 	reportFmt     = "preq-report-%d.json"
+
+	skippedMaxShown = 5
 )
 
 var (
@@ -40,19 +43,27 @@ var (
 )
 
 type ReportT struct {
-	mux     sync.Mutex
-	CreHits map[string][]time.Time
-	Hits    map[string]map[time.Time]matchz.HitsT
-	Rules   map[string]parser.ParseRuleT
-	Pw      progress.Writer
+	mux         sync.Mutex
+	CreHits     map[string][]time.Time
+	Hits        map[string]map[time.Time]matchz.HitsT
+	Rules       map[string]parser.ParseRuleT
+	Skipped     map[string]string
+	Overrides   map[string][]string
+	Evaluated   map[string]string
+	Unevaluated map[string]string
+	Pw          progress.Writer
 }
 
 func NewReport(pw progress.Writer) *ReportT {
 	return &ReportT{
-		CreHits: make(map[string][]time.Time),                // cre -> timestamps for each detection
-		Hits:    make(map[string]map[time.Time]matchz.HitsT), // cre -> timestamp -> matchz.HitsT
-		Rules:   make(map[string]parser.ParseRuleT),          // cre -> parser.ParseRuleT
-		Pw:      pw,
+		CreHits:     make(map[string][]time.Time),                // cre -> timestamps for each detection
+		Hits:        make(map[string]map[time.Time]matchz.HitsT), // cre -> timestamp -> matchz.HitsT
+		Rules:       make(map[string]parser.ParseRuleT),          // cre -> parser.ParseRuleT
+		Skipped:     make(map[string]string),                     // cre -> reason the rule was filtered out
+		Overrides:   make(map[string][]string),                   // cre -> changes made by config overrides
+		Evaluated:   make(map[string]string),                     // cre -> source type of rules that had data
+		Unevaluated: make(map[string]string),                     // cre -> source type of rules with no data
+		Pw:          pw,
 	}
 }
 
@@ -77,6 +88,16 @@ func (r *ReportT) AddCreHit(cre *parser.ParseCreT, hit time.Time, m matchz.HitsT
 	return newDetection
 }
 
+// Results from windowed rules over synthetic timestamps only reflect line order.
+func (r *ReportT) isApproximate(creId string) bool {
+	for _, m := range r.Hits[creId] {
+		if m.Entity.Approximate {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *ReportT) AddRules(rules *parser.RulesT) {
 	r.mux.Lock()
 	defer r.mux.Unlock()
@@ -91,6 +112,18 @@ func (r *ReportT) AddRules(rules *parser.RulesT) {
 	}
 }
 
+func (r *ReportT) AddSkipped(creId, reason string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.Skipped[creId] = reason
+}
+
+func (r *ReportT) AddOverride(creId string, changes []string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.Overrides[creId] = changes
+}
+
 func (r *ReportT) GetCre(creId string) parser.ParseRuleT {
 	r.mux.Lock()
 	defer r.mux.Unlock()
@@ -184,8 +217,21 @@ func (r *ReportT) DisplayCREs() error {
 			sevS  = text.Colors{sev.color}.Sprintf(tmpl, sev.severity)
 		)
 
+		if r.isApproximate(rule.Cre.Id) {
+			count += text.Colors{text.FgYellow}.Sprint(" (approximate)")
+		}
+
 		r.Pw.Log(fmt.Sprintf("%s %s %s", cre, sevS, count))
 	}
+
+	r.displaySkipped()
+
+	if len(r.Overrides) > 0 {
+		r.Pw.Log(text.Colors{text.FgHiBlack}.Sprintf("%d rules changed by config overrides", len(r.Overrides)))
+	}
+
+	r.displayCoverage()
+
 	return nil
 }
 
@@ -254,6 +300,7 @@ func (r *ReportT) Size() int {
 	return len(r.CreHits)
 }
 
+// ReportDocT holds one document per detected CRE.
 type ReportDocT []map[string]any
 
 func (r *ReportT) CreateReport() (ReportDocT, error) {
@@ -277,6 +324,14 @@ func (r *ReportT) createReport() (ReportDocT, error) {
 		o["rule_id"] = r.Rules[id].Metadata.Id
 		o["rule_hash"] = r.Rules[id].Metadata.Hash
 
+		if r.isApproximate(id) {
+			o["approximate"] = true
+		}
+
+		if changes, ok := r.Overrides[id]; ok {
+			o["overrides"] = changes
+		}
+
 		type entryT struct {
 			Timestamp time.Time `json:"timestamp"`
 			Entry     string    `json:"entry"`
@@ -298,3 +353,77 @@ func (r *ReportT) createReport() (ReportDocT, error) {
 
 	return out, nil
 }
+
+// SummaryT describes the run rather than a detection: the rules skipped and why, and the
+// rules evaluated per source type. It is written next to the report so the report holds
+// detections only.
+type SummaryT struct {
+	Skipped  map[string]string `json:"skipped,omitempty"`
+	Coverage []CoverageT       `json:"coverage,omitempty"`
+}
+
+// Summary returns the run summary, or nil when no rule was skipped or evaluated.
+func (r *ReportT) Summary() *SummaryT {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.summary()
+}
+
+func (r *ReportT) summary() *SummaryT {
+
+	if len(r.Skipped)+len(r.Evaluated)+len(r.Unevaluated) == 0 {
+		return nil
+	}
+
+	s := &SummaryT{
+		Coverage: r.coverage(),
+	}
+
+	if len(r.Skipped) > 0 {
+		s.Skipped = maps.Clone(r.Skipped)
+	}
+
+	return s
+}
+
+func WriteSummary(s *SummaryT, path string) (string, error) {
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if err = os.WriteFile(path, data, 0644); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
+
+// displaySkipped lists the rules removed by the filter or overrides and why.
+func (r *ReportT) displaySkipped() {
+
+	if len(r.Skipped) == 0 {
+		return
+	}
+
+	var (
+		dim = text.Colors{text.FgHiBlack}
+		ids = make([]string, 0, len(r.Skipped))
+	)
+
+	r.Pw.Log(dim.Sprintf("%d rules skipped by filter or override", len(r.Skipped)))
+
+	for id := range r.Skipped {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for i, id := range ids {
+		if i == skippedMaxShown {
+			r.Pw.Log(dim.Sprintf("  and %d more", len(ids)-i))
+			break
+		}
+		r.Pw.Log(dim.Sprintf("  %-24s %s", id, r.Skipped[id]))
+	}
+}
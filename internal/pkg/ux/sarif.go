@@ -0,0 +1,297 @@
+package ux
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prequel-dev/preq/internal/pkg/verz"
+	"github.com/prequel-dev/prequel-compiler/pkg/parser"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	FormatJSON  = "json"
+	FormatSarif = "sarif"
+	FormatText  = "text"
+)
+
+const (
+	sarifVersion  = "2.1.0"
+	sarifSchema   = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifToolName = "preq"
+	sarifToolUri  = "https://docs.prequel.dev"
+	sarifFmt      = "preq-report-%d.sarif"
+	sarifError    = "error"
+	sarifWarning  = "warning"
+	sarifNote     = "note"
+)
+
+type sarifLogT struct {
+	Schema  string      `json:"$schema"`
+	Version string      `json:"version"`
+	Runs    []sarifRunT `json:"runs"`
+}
+
+type sarifRunT struct {
+	Tool       sarifToolT     `json:"tool"`
+	Results    []sarifResultT `json:"results"`
+	Properties *SummaryT      `json:"properties,omitempty"`
+}
+
+type sarifToolT struct {
+	Driver sarifDriverT `json:"driver"`
+}
+
+type sarifDriverT struct {
+	Name           string       `json:"name"`
+	Version        string       `json:"version,omitempty"`
+	InformationUri string       `json:"informationUri"`
+	Rules          []sarifRuleT `json:"rules"`
+}
+
+type sarifTextT struct {
+	Text string `json:"text"`
+}
+
+type sarifRuleT struct {
+	Id                   string              `json:"id"`
+	ShortDescription     sarifTextT          `json:"shortDescription"`
+	FullDescription      *sarifTextT         `json:"fullDescription,omitempty"`
+	Help                 *sarifTextT         `json:"help,omitempty"`
+	HelpUri              string              `json:"helpUri,omitempty"`
+	DefaultConfiguration sarifConfigurationT `json:"defaultConfiguration"`
+	Properties           sarifRulePropsT     `json:"properties"`
+}
+
+type sarifConfigurationT struct {
+	Level string `json:"level"`
+}
+
+type sarifRulePropsT struct {
+	Severity string   `json:"severity,omitempty"`
+	Category string   `json:"category,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	RuleId   string   `json:"rule_id,omitempty"`
+	RuleHash string   `json:"rule_hash,omitempty"`
+}
+
+type sarifResultT struct {
+	RuleId     string            `json:"ruleId"`
+	RuleIndex  int               `json:"ruleIndex"`
+	Level      string            `json:"level"`
+	Message    sarifTextT        `json:"message"`
+	Locations  []sarifLocationT  `json:"locations,omitempty"`
+	Properties sarifResultPropsT `json:"properties"`
+}
+
+type sarifResultPropsT struct {
+	Timestamp   string `json:"timestamp"`
+	Approximate bool   `json:"approximate,omitempty"`
+}
+
+type sarifLocationT struct {
+	PhysicalLocation sarifPhysicalT `json:"physicalLocation"`
+}
+
+type sarifPhysicalT struct {
+	ArtifactLocation sarifArtifactT `json:"artifactLocation"`
+	Region           *sarifRegionT  `json:"region,omitempty"`
+}
+
+type sarifArtifactT struct {
+	Uri string `json:"uri"`
+}
+
+type sarifRegionT struct {
+	StartLine int64       `json:"startLine"`
+	Snippet   *sarifTextT `json:"snippet,omitempty"`
+}
+
+// sarifLevel maps CRE severities onto SARIF levels; critical and high fail CI checks.
+func sarifLevel(severity uint) string {
+	switch severity {
+	case parser.SeverityCritical, parser.SeverityHigh:
+		return sarifError
+	case parser.SeverityMedium:
+		return sarifWarning
+	}
+	return sarifNote
+}
+
+// sarifUri returns the log path as a URI reference; relative paths stay relative to the run.
+func sarifUri(path string) string {
+	if filepath.IsAbs(path) {
+		return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+	}
+	return (&url.URL{Path: filepath.ToSlash(path)}).String()
+}
+
+// WriteSarif writes the detections as a SARIF 2.1.0 log. Each CRE is a rule and each
+// detection a result located at the log lines that matched.
+func (r *ReportT) WriteSarif(path string) (string, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	var (
+		reportName string
+		data       []byte
+		err        error
+	)
+
+	if path == "" {
+		reportName = fmt.Sprintf(sarifFmt, time.Now().Unix())
+	} else {
+		reportName = path
+	}
+
+	data, err = json.MarshalIndent(r.createSarif(), "", "  ")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal SARIF report")
+		return "", err
+	}
+
+	if err = os.WriteFile(reportName, data, 0644); err != nil {
+		return "", err
+	}
+
+	return reportName, nil
+}
+
+func (r *ReportT) PrintSarif() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	data, err := json.MarshalIndent(r.createSarif(), "", "  ")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal SARIF report")
+		return err
+	}
+
+	fmt.Fprintln(os.Stdout, string(data))
+
+	return nil
+}
+
+func (r *ReportT) createSarif() sarifLogT {
+
+	var (
+		version string
+		ids     = make([]string, 0, len(r.CreHits))
+		rules   = make([]sarifRuleT, 0, len(r.CreHits))
+		results = make([]sarifResultT, 0)
+	)
+
+	for id := range r.CreHits {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for i, id := range ids {
+
+		var (
+			rule  = r.Rules[id]
+			cre   = rule.Cre
+			level = sarifLevel(cre.Severity)
+			title = cre.Title
+		)
+
+		if title == "" {
+			title = id
+		}
+
+		sr := sarifRuleT{
+			Id:                   id,
+			ShortDescription:     sarifTextT{Text: title},
+			DefaultConfiguration: sarifConfigurationT{Level: level},
+			Properties: sarifRulePropsT{
+				Category: cre.Category,
+				Tags:     cre.Tags,
+				RuleId:   rule.Metadata.Id,
+				RuleHash: rule.Metadata.Hash,
+			},
+		}
+
+		if sev, err := getSeverity(cre.Severity); err == nil {
+			sr.Properties.Severity = sev.severity
+		}
+		if d := strings.TrimSpace(cre.Description); d != "" {
+			sr.FullDescription = &sarifTextT{Text: d}
+		}
+		if m := strings.TrimSpace(cre.Mitigation); m != "" {
+			sr.Help = &sarifTextT{Text: m}
+		}
+		if len(cre.References) > 0 {
+			sr.HelpUri = cre.References[0]
+		}
+
+		rules = append(rules, sr)
+
+		for _, hit := range r.CreHits[id] {
+
+			var (
+				m   = r.Hits[id][hit]
+				res = sarifResultT{
+					RuleId:    id,
+					RuleIndex: i,
+					Level:     level,
+					Message:   sarifTextT{Text: fmt.Sprintf("%s (%d matching log entries)", title, len(m.Entries))},
+					Properties: sarifResultPropsT{
+						Timestamp:   hit.Format(time.RFC3339Nano),
+						Approximate: m.Entity.Approximate,
+					},
+				}
+			)
+
+			for _, e := range m.Entries {
+				if e.File == "" {
+					continue
+				}
+				loc := sarifLocationT{
+					PhysicalLocation: sarifPhysicalT{
+						ArtifactLocation: sarifArtifactT{Uri: sarifUri(e.File)},
+					},
+				}
+				// Lines are not counted in logs scanned from an offset, such as with --tail
+				if e.Line > 0 {
+					loc.PhysicalLocation.Region = &sarifRegionT{
+						StartLine: e.Line,
+						Snippet:   &sarifTextT{Text: string(e.Entry)},
+					}
+				}
+				res.Locations = append(res.Locations, loc)
+			}
+
+			results = append(results, res)
+		}
+	}
+
+	// Development builds are not versioned
+	if verz.Major != "" {
+		version = verz.Semver()
+	}
+
+	run := sarifRunT{
+		Tool: sarifToolT{
+			Driver: sarifDriverT{
+				Name:           sarifToolName,
+				Version:        version,
+				InformationUri: sarifToolUri,
+				Rules:          rules,
+			},
+		},
+		Results:    results,
+		Properties: r.summary(),
+	}
+
+	return sarifLogT{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRunT{run},
+	}
+}
@@ -96,11 +96,63 @@ var (
 	HelpGenerate      = "Generate data sources template"
 	HelpLevel         = "Print logs at this level to stderr"
 	HelpName          = "Output name for reports, data source templates, or notifications"
+	HelpFormat        = "Output format: json, or sarif for code scanning dashboards and CI annotations. Lint and bench print text or json"
 	HelpQuiet         = "Quiet mode, do not print progress"
-	HelpRules         = "Path to a CRE rules file"
+	HelpRules         = "Path to a CRE rules file, directory or glob pattern"
 	HelpSource        = "Path to a data source Yaml file"
 	HelpVersion       = "Print version and exit"
 	HelpAcceptUpdates = "Accept updates to rules or new release"
+	HelpSynthetic     = "Assign synthetic timestamps to stdin lines without timestamps (line|mtime)"
+	HelpInclude       = "Only run rules matching these comma separated terms: id:<glob>, tag:<tag>, category:<category> or source:<type>"
+	HelpExclude       = "Skip rules matching any of these comma separated terms: id:<glob>, tag:<tag>, category:<category> or source:<type>"
+	HelpSeverity      = "Skip rules less severe than this (critical|high|medium|low|info)"
+	HelpOffline       = "Do not log in or check for updates; use installed or imported community rules"
+	HelpExplain       = "Trace how the rule with this CRE id evaluated the logs: matched terms, sequence progress, negates and expired windows. The JSON trace is written next to the report, or not at all with -o -"
+	HelpTail          = "Only scan the end of each log file: last N lines (1000), bytes (64MB) or duration (2h)"
+)
+
+var (
+	HelpDetectFormat      = "Show how the timestamp format of a log file or stdin is detected"
+	HelpDetectFormatPath  = "Path to a log file; reads stdin if omitted"
+	HelpDetectFormatLines = "Number of timestamps to parse and show"
+	HelpLint              = "Check rule files for errors without running them; exits non-zero on problems"
+	HelpLintPaths         = "Rule files, directories or glob patterns to check"
+	HelpTest              = "Run rule tests from YAML specs of log fixtures and expected detections"
+	HelpTestSpecs         = "Test spec files"
+	HelpRulesCmd          = "Manage installed community rules versions and sign user rules"
+	HelpRulesList         = "List installed community rules versions"
+	HelpRulesUse          = "Use an installed rules version instead of updating to the latest"
+	HelpRulesUseVersion   = "Rules version, or latest to follow updates again"
+	HelpRulesRollback     = "Use the installed rules version before the active one"
+	HelpRulesImport       = "Verify and install a community rules package for offline use"
+	HelpRulesImportPath   = "Rules package (.gz) with its .sha2 and .sig files alongside"
+	HelpRulesSign         = "Sign user rule files with an organization ECDSA private key; writes <file>.sig"
+	HelpRulesSignKey      = "PEM file with the organization's ECDSA private key"
+	HelpRulesSignPaths    = "Rule files, directories or glob patterns to sign"
+	HelpRulesVerify       = "Verify user rule files against their signatures; exits non-zero on unsigned or tampered files"
+	HelpRulesVerifyKey    = "PEM file with the organization's ECDSA public key; defaults to rules.signing.publicKey in the config"
+	HelpRulesVerifyPaths  = "Rule files, directories or glob patterns to verify; defaults to rules.paths in the config"
+	HelpMirror            = "Serve signed rules and preq releases to clients configured with updates.endpoint"
+	HelpMirrorDir         = "Directory of rules packages and preq_<version>_<os>_<arch> binaries, each with .sha2 and .sig files"
+	HelpMirrorListen      = "Address to serve checkins and downloads on"
+	HelpMirrorUdpListen   = "Address to answer fast update checks on (clients' updates.fastEndpoint)"
+	HelpMirrorTlsCert     = "TLS certificate file"
+	HelpMirrorTlsKey      = "TLS key file"
+	HelpMirrorUrl         = "URL clients use to reach the mirror; defaults to the request host"
+	HelpMirrorToken       = "Bearer token clients must send (their updates.token)"
+	HelpNewRule           = "Generate a CRE rule skeleton from example log lines and check that it matches them"
+	HelpNewRulePath       = "Log file with the example lines"
+	HelpNewRuleLines      = "Line numbers and ranges to use, e.g. 3,7-9"
+	HelpNewRuleMatch      = "Use the lines matching this regex"
+	HelpNewRuleKind       = "Rule type: auto uses a set for one line and a sequence for several (auto|set|sequence)"
+	HelpNewRuleId         = "CRE id of the new rule"
+	HelpNewRuleSource     = "Event source type of the new rule; defaults to cre.log.<file name>"
+	HelpNewRuleOut        = "Write the rule to this file instead of stdout"
+	HelpBench             = "Measure each rule's matcher time, allocations and hits on a sample log; exits non-zero if any rule is flagged as slow"
+	HelpBenchRules        = "Rule files, directories or glob patterns to measure"
+	HelpBenchCorpus       = "Sample log file to scan"
+	HelpBenchSource       = "Event source type of the sample log; by default every rule scans it"
+	HelpBenchLineTime     = "Flag rules whose mean matcher time per line exceeds this duration"
 )
 
 type StatsT map[string]any
@@ -2,6 +2,7 @@ package ux
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -166,17 +167,13 @@ func TestPrintDeviceAuthUrl(t *testing.T) {
 }
 
 func TestWriteDataSourceTemplate(t *testing.T) {
-	// Create a temporary directory for testing
-	tmpDir, err := os.MkdirTemp("", "preq-test")
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer os.RemoveAll(tmpDir)
+	// Write the template into a temporary directory rather than the package directory
+	tmpDir := t.TempDir()
 
 	// Call WriteDataSourceTemplate
 	ver, _ := semver.NewVersion("1.0.0")
 	template := []byte("# Test template")
-	output, err := WriteDataSourceTemplate("test", ver, template)
+	output, err := WriteDataSourceTemplate(filepath.Join(tmpDir, "test"), ver, template)
 	if err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
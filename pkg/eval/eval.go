@@ -12,15 +12,159 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	srcTypeAny = "*"
+)
+
+// SourceT is an in-memory log of one source type. An empty type matches every rule.
+type SourceT struct {
+	Name string
+	Type string
+	Data []byte
+}
+
+type sourcesFuncT func(opts ...resolve.OptT) ([]*resolve.LogData, error)
+
+type rulesFuncT func(run *engine.RuntimeT, report *ux.ReportT) (*engine.RuleMatchersT, error)
+
+// ruleData compiles rules held in memory.
+func ruleData(rule string) rulesFuncT {
+	return func(run *engine.RuntimeT, report *ux.ReportT) (*engine.RuleMatchersT, error) {
+		return run.CompileRules([]byte(rule), report)
+	}
+}
+
+// ruleFiles compiles user rule files, directories or glob patterns as preq -r does.
+func ruleFiles(paths []string) rulesFuncT {
+	return func(run *engine.RuntimeT, report *ux.ReportT) (*engine.RuleMatchersT, error) {
+
+		var rulePaths []utils.RulePathT
+
+		for _, path := range paths {
+			files, err := utils.ExpandRulesPath(path)
+			if err != nil {
+				return nil, err
+			}
+			for _, fn := range files {
+				rulePaths = append(rulePaths, utils.RulePathT{Path: fn, Type: utils.RuleTypeUser})
+			}
+		}
+
+		return run.LoadRulesPaths(report, rulePaths)
+	}
+}
+
 func Detect(ctx context.Context, cfg, data, rule string) (ux.ReportDocT, ux.StatsT, error) {
 
+	var (
+		report     *ux.ReportT
+		reportData ux.ReportDocT
+		stats      ux.StatsT
+		err        error
+	)
+
+	pipe := func(opts ...resolve.OptT) ([]*resolve.LogData, error) {
+		return resolve.PipeEval([]byte(data), opts...)
+	}
+
+	run := engine.New(utils.GetStopTime(), ux.NewUxEval())
+	defer run.Close()
+
+	if report, stats, err = detect(ctx, run, cfg, ruleData(rule), pipe); err != nil {
+		return nil, nil, err
+	}
+
+	if reportData, err = report.CreateReport(); err != nil {
+		log.Error().Err(err).Msg("Failed to create report")
+		return nil, nil, err
+	}
+
+	return reportData, stats, nil
+}
+
+// DetectSources runs the rules over logs of several source types. Logs of the same type are
+// scanned as one data source. The report holds the timestamp of every detection per CRE.
+func DetectSources(ctx context.Context, cfg, rule string, srcs []SourceT) (*ux.ReportT, ux.StatsT, error) {
+	return detectSources(ctx, cfg, ruleData(rule), srcs)
+}
+
+// DetectSourcesFiles is DetectSources with rules read from files, directories or glob
+// patterns, compiled as user rules the same way as preq -r.
+func DetectSourcesFiles(ctx context.Context, cfg string, rulePaths []string, srcs []SourceT) (*ux.ReportT, ux.StatsT, error) {
+	return detectSources(ctx, cfg, ruleFiles(rulePaths), srcs)
+}
+
+func detectSources(ctx context.Context, cfg string, rulesF rulesFuncT, srcs []SourceT) (*ux.ReportT, ux.StatsT, error) {
+
+	pipe := func(opts ...resolve.OptT) ([]*resolve.LogData, error) {
+
+		var (
+			order  = make([]string, 0, len(srcs))
+			byType = make(map[string][]SourceT)
+			out    = make([]*resolve.LogData, 0, len(srcs))
+		)
+
+		for _, src := range srcs {
+			srcType := src.Type
+			if srcType == "" {
+				srcType = srcTypeAny
+			}
+			if _, ok := byType[srcType]; !ok {
+				order = append(order, srcType)
+			}
+			byType[srcType] = append(byType[srcType], src)
+		}
+
+		for _, srcType := range order {
+			var data = make([][]byte, 0, len(byType[srcType]))
+			for _, src := range byType[srcType] {
+				data = append(data, src.Data)
+			}
+
+			ld, err := resolve.PipeEvalSource(byType[srcType][0].Name, srcType, data, opts...)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, ld)
+		}
+
+		return out, nil
+	}
+
+	run := engine.New(utils.GetStopTime(), ux.NewUxEval())
+	defer run.Close()
+
+	return detect(ctx, run, cfg, rulesF, pipe)
+}
+
+// Explain runs the rules over the data and traces how the rule with the CRE id evaluated it:
+// the terms that matched and on which lines, progress through a sequence, negate terms that
+// suppressed a match and windows that expired.
+func Explain(ctx context.Context, cfg, data, rule, creId string) (*ux.ExplainT, error) {
+
+	pipe := func(opts ...resolve.OptT) ([]*resolve.LogData, error) {
+		return resolve.PipeEval([]byte(data), opts...)
+	}
+
+	run := engine.New(utils.GetStopTime(), ux.NewUxEval())
+	defer run.Close()
+
+	run.Explain = creId
+
+	if _, _, err := detect(ctx, run, cfg, ruleData(rule), pipe); err != nil {
+		return nil, err
+	}
+
+	return run.Explanation(), nil
+}
+
+func detect(ctx context.Context, run *engine.RuntimeT, cfg string, rulesF rulesFuncT, sourcesF sourcesFuncT) (*ux.ReportT, ux.StatsT, error) {
+
 	var (
 		c            *config.Config
-		run          *engine.RuntimeT
 		report       *ux.ReportT
 		ruleMatchers *engine.RuleMatchersT
-		sources      []*engine.LogData
-		reportData   ux.ReportDocT
+		sources      []*resolve.LogData
 		stats        ux.StatsT
 		err          error
 	)
@@ -34,20 +178,19 @@ func Detect(ctx context.Context, cfg, data, rule string) (ux.ReportDocT, ux.Stat
 		return nil, nil, err
 	}
 
-	opts := c.ResolveOpts()
+	// In-memory logs have no data source of their own, like stdin
+	opts := append(c.ResolveOpts(), c.StdinOpts()...)
 	opts = append(opts, resolve.WithTimestampTries(timez.DefaultSkip))
 
-	if sources, err = resolve.PipeEval([]byte(data), opts...); err != nil {
+	if sources, err = sourcesF(opts...); err != nil {
 		log.Error().Err(err).Msg("Failed to create pipe reader")
 		return nil, nil, err
 	}
 
-	run = engine.New(utils.GetStopTime(), ux.NewUxEval())
-	defer run.Close()
-
 	report = ux.NewReport(nil)
+	run.Extracted = engine.ExtractedTypes(sources)
 
-	if ruleMatchers, err = run.CompileRules([]byte(rule), report); err != nil {
+	if ruleMatchers, err = rulesF(run, report); err != nil {
 		log.Error().Err(err).Msg("Failed to compile rules")
 		return nil, nil, err
 	}
@@ -57,16 +200,14 @@ func Detect(ctx context.Context, cfg, data, rule string) (ux.ReportDocT, ux.Stat
 		return nil, nil, err
 	}
 
-	if reportData, err = report.CreateReport(); err != nil {
-		log.Error().Err(err).Msg("Failed to create report")
-		return nil, nil, err
-	}
-
 	stats, err = run.Ux.FinalStats()
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to get final stats, continue...")
 	}
 
-	return reportData, stats, nil
+	if stats != nil {
+		stats["coverage"] = report.Coverage()
+	}
 
+	return report, stats, nil
 }
@@ -116,6 +116,10 @@ func TestSuccessExamples(t *testing.T) {
 			rulePath: "../examples/29-negate-slide-anchor-1-window.yaml",
 			dataPath: "../examples/29-example-fp-moved.log",
 		},
+		"Example42": {
+			rulePath: "../examples/42-compose-example.yaml",
+			dataPath: "../examples/42-example.log",
+		},
 		"Missing-IDs": {
 			rulePath: "missing-ids.yaml",
 			dataPath: "missing-ids.log",